@@ -0,0 +1,55 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// Bearer token for /admin endpoints, which reject all requests when unset
+var adminToken = os.Getenv("ADMIN_TOKEN")
+
+// Serve pprof profiles on /debug/pprof, behind adminAuth
+var enablePprof = envBool("ENABLE_PPROF", false)
+
+// adminRoutes mounts the admin endpoints behind adminAuth
+func adminRoutes(r chi.Router) {
+	r.Use(adminAuth)
+
+	r.Get("/ingest", getIngestHandler)
+	r.Put("/ingest", putIngestHandler)
+
+	r.Get("/responses/{batchID}", getResponsesHandler)
+
+	r.Get("/users/top", getTopUsersHandler)
+
+	r.Get("/processor", getProcessorHandler)
+
+	r.Get("/last-send", getLastSendHandler)
+
+	r.Get("/batch-size", getBatchSizeHandler)
+	r.Put("/batch-size", putBatchSizeHandler)
+}
+
+// debugRoutes mounts the pprof and expvar endpoints behind adminAuth
+func debugRoutes(r chi.Router) {
+	r.Use(adminAuth)
+
+	r.Mount("/", middleware.Profiler())
+}
+
+// adminAuth requires an "Authorization: Bearer <ADMIN_TOKEN>" header
+func adminAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if adminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+			writeJSONError(w, http.StatusUnauthorized, "unauthorized", "admin token required", nil)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
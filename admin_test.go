@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAdminAuth(t *testing.T) {
+	tests := []struct {
+		name       string
+		pprof      bool
+		configured string
+		header     string
+		wantStatus int
+	}{
+		{"pprof disabled", false, "secret", "Bearer secret", http.StatusNotFound},
+		{"no admin token configured", true, "", "Bearer ", http.StatusUnauthorized},
+		{"missing header", true, "secret", "", http.StatusUnauthorized},
+		{"wrong token", true, "secret", "Bearer guess", http.StatusUnauthorized},
+		{"valid token", true, "secret", "Bearer secret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prevToken, prevPprof := adminToken, enablePprof
+			adminToken, enablePprof = tt.configured, tt.pprof
+			defer func() { adminToken, enablePprof = prevToken, prevPprof }()
+
+			r := newServerRouter()
+			req := httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusOK && !strings.Contains(rec.Body.String(), "goroutine") {
+				t.Errorf("pprof index not served: %.100s", rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var (
+	// JSON object mapping old field paths to current ones, e.g. {"amount": "total"}
+	fieldAliasesFile = os.Getenv("FIELD_ALIASES_FILE")
+
+	// Loaded at startup, nil when FIELD_ALIASES_FILE is unset
+	fieldAliases map[string]string
+)
+
+// loadFieldAliases reads the alias mapping at path. Paths are dot-separated
+// for nested fields, e.g. "meta.phones" -> "meta.phone_numbers".
+func loadFieldAliases(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var aliases map[string]string
+	if err := json.Unmarshal(data, &aliases); err != nil {
+		return nil, err
+	}
+	for from, to := range aliases {
+		if from == "" || to == "" || from == to {
+			return nil, fmt.Errorf("invalid alias %q -> %q", from, to)
+		}
+	}
+	return aliases, nil
+}
+
+// applyFieldAliases renames aliased fields in body to their current names.
+// When both the old and current field are present the current one wins.
+// Bodies that aren't JSON objects are returned unchanged for the decoder to reject.
+func applyFieldAliases(body []byte, aliases map[string]string) ([]byte, error) {
+	var doc map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return body, nil
+	}
+
+	var changed bool
+	for from, to := range aliases {
+		value, ok := takeField(doc, strings.Split(from, "."))
+		if !ok {
+			continue
+		}
+		changed = true
+		putField(doc, strings.Split(to, "."), value)
+	}
+
+	if !changed {
+		return body, nil
+	}
+	return json.Marshal(doc)
+}
+
+// takeField removes and returns the value at path
+func takeField(doc map[string]interface{}, path []string) (interface{}, bool) {
+	for _, key := range path[:len(path)-1] {
+		next, ok := doc[key].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		doc = next
+	}
+
+	key := path[len(path)-1]
+	value, ok := doc[key]
+	if ok {
+		delete(doc, key)
+	}
+	return value, ok
+}
+
+// putField sets the value at path unless already present, creating
+// intermediate objects as needed
+func putField(doc map[string]interface{}, path []string, value interface{}) {
+	for _, key := range path[:len(path)-1] {
+		next, ok := doc[key].(map[string]interface{})
+		if !ok {
+			if _, exists := doc[key]; exists {
+				return
+			}
+			next = make(map[string]interface{})
+			doc[key] = next
+		}
+		doc = next
+	}
+
+	key := path[len(path)-1]
+	if _, exists := doc[key]; !exists {
+		doc[key] = value
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestApplyFieldAliases(t *testing.T) {
+	aliases := map[string]string{"amount": "total", "meta.phones": "meta.phone_numbers", "name": "details.title"}
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"renamed", `{"amount":5}`, `{"total":5}`},
+		{"current field wins", `{"amount":5,"total":7}`, `{"total":7}`},
+		{"nested path", `{"meta":{"phones":{"home":"1"}}}`, `{"meta":{"phone_numbers":{"home":"1"}}}`},
+		{"creates intermediate objects", `{"name":"x"}`, `{"details":{"title":"x"}}`},
+		{"no aliased fields", `{"user_id":1}`, `{"user_id":1}`},
+		{"large numbers kept exact", `{"amount":12345678901234567890}`, `{"total":12345678901234567890}`},
+		{"not an object", `[1,2]`, `[1,2]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := applyFieldAliases([]byte(tt.body), aliases)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var gotDoc, wantDoc interface{}
+			_ = json.Unmarshal(got, &gotDoc)
+			_ = json.Unmarshal([]byte(tt.want), &wantDoc)
+			if !reflect.DeepEqual(gotDoc, wantDoc) {
+				t.Errorf("aliased to %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadFieldAliases(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		wantErr bool
+	}{
+		{"valid", `{"amount":"total"}`, false},
+		{"empty target", `{"amount":""}`, true},
+		{"self alias", `{"total":"total"}`, true},
+		{"not json", `amount=total`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "aliases.json")
+			if err := os.WriteFile(path, []byte(tt.file), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := loadFieldAliases(path); (err != nil) != tt.wantErr {
+				t.Errorf("error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFieldAliasesAppliedByHandler(t *testing.T) {
+	prev := fieldAliases
+	fieldAliases = map[string]string{"amount": "total", "user": "user_id"}
+	defer func() { fieldAliases = prev }()
+
+	p := captureQueue(t)
+	if rec, _ := postLog(t, `{"user":3,"amount":9.5}`); rec.Code != http.StatusAccepted {
+		t.Fatalf("status %d, want 202", rec.Code)
+	}
+	got := queued(p)
+	if len(got) != 1 || got[0].UserID != 3 || got[0].Total != 9.5 {
+		t.Errorf("enqueued %+v, want the aliased fields decoded", got)
+	}
+}
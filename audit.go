@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Audited delivery outcomes
+const (
+	auditDelivered    = "delivered"
+	auditDeadLettered = "dead_lettered"
+)
+
+var (
+	// Append-only NDJSON file receiving one event per batch delivery outcome
+	auditFile = os.Getenv("AUDIT_FILE")
+
+	// Key for HMAC-SHA256 hashing of audited user ids, required with
+	// AUDIT_FILE since unkeyed hashes of numeric ids are easily reversed
+	auditHashKey = os.Getenv("AUDIT_HASH_KEY")
+
+	// Audit event writer, nil when AUDIT_FILE is unset
+	audit *auditLog
+)
+
+// auditEvent is one batch's delivery outcome at one destination. Seq rises
+// by one per event, across restarts, so gaps in the trail are detectable.
+type auditEvent struct {
+	Seq         uint64    `json:"seq"`
+	BatchID     string    `json:"batch_id"`
+	Destination string    `json:"destination"`
+	Outcome     string    `json:"outcome"`
+	Records     int       `json:"records"`
+	UserIDs     []string  `json:"user_ids"`
+	StartedAt   time.Time `json:"started_at"`
+	CompletedAt time.Time `json:"completed_at"`
+}
+
+// auditLog appends events from concurrent senders through a single writer
+// goroutine, which numbers them in the order they're written
+type auditLog struct {
+	f      *os.File
+	seq    uint64
+	events chan auditEvent
+	done   chan struct{}
+
+	// Guards events against sends still running past the shutdown timeout
+	mu     sync.RWMutex
+	closed bool
+}
+
+// openAuditLog opens path for appending, continuing the sequence of the
+// events already in it, and starts the writer
+func openAuditLog(path string) (*auditLog, error) {
+	seq, err := lastAuditSeq(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	a := &auditLog{
+		f:      f,
+		seq:    seq,
+		events: make(chan auditEvent, 1024),
+		done:   make(chan struct{}),
+	}
+	go a.run()
+	return a, nil
+}
+
+// lastAuditSeq returns the seq of the last event in path, 0 when there is none
+func lastAuditSeq(path string) (uint64, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var last uint64
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64<<10), 16<<20)
+	for scanner.Scan() {
+		var event struct {
+			Seq uint64 `json:"seq"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &event); err == nil {
+			last = event.Seq
+		}
+	}
+	return last, scanner.Err()
+}
+
+// Record queues the outcome of delivering batch to destination. A nil log
+// records nothing.
+func (a *auditLog) Record(batch *Batch, destination, outcome string, started time.Time) {
+	if a == nil {
+		return
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		logger.Error("Audit event recorded after close",
+			zap.String("batch_id", batch.ID),
+			zap.String("outcome", outcome))
+		return
+	}
+	a.events <- auditEvent{
+		BatchID:     batch.ID,
+		Destination: destination,
+		Outcome:     outcome,
+		Records:     len(batch.Payloads),
+		UserIDs:     hashedUserIDs(batch.Payloads),
+		StartedAt:   started,
+		CompletedAt: time.Now(),
+	}
+}
+
+func (a *auditLog) run() {
+	defer close(a.done)
+
+	for event := range a.events {
+		a.seq++
+		event.Seq = a.seq
+		line, err := json.Marshal(event)
+		if err == nil {
+			_, err = a.f.Write(append(line, '\n'))
+		}
+		if err != nil {
+			logger.Error("Failed to write audit event",
+				zap.String("audit_file", auditFile),
+				zap.Uint64("seq", event.Seq),
+				zap.String("batch_id", event.BatchID),
+				zap.Error(err))
+		}
+	}
+}
+
+// Close writes the queued events and closes the file, once no more are recorded
+func (a *auditLog) Close() error {
+	a.mu.Lock()
+	a.closed = true
+	close(a.events)
+	a.mu.Unlock()
+
+	<-a.done
+	return a.f.Close()
+}
+
+// hashedUserIDs returns the hex HMAC of each distinct user in payloads
+func hashedUserIDs(payloads []LogPayload) []string {
+	seen := make(map[int64]bool)
+	var ids []string
+	for _, payload := range payloads {
+		if seen[payload.UserID] {
+			continue
+		}
+		seen[payload.UserID] = true
+
+		mac := hmac.New(sha256.New, []byte(auditHashKey))
+		mac.Write([]byte(strconv.FormatInt(payload.UserID, 10)))
+		ids = append(ids, hex.EncodeToString(mac.Sum(nil)))
+	}
+	return ids
+}
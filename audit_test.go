@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// readAuditEvents returns the events in the audit file at path
+func readAuditEvents(t *testing.T, path string) []auditEvent {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var events []auditEvent
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var event auditEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestAuditSequenceContinuesAcrossRestarts(t *testing.T) {
+	prevKey := auditHashKey
+	auditHashKey = "test-key"
+	defer func() { auditHashKey = prevKey }()
+
+	path := filepath.Join(t.TempDir(), "audit.ndjson")
+	for run := 0; run < 2; run++ {
+		a, err := openAuditLog(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 3; i++ {
+			a.Record(&Batch{ID: newBatchID(), Payloads: []LogPayload{{UserID: 1}, {UserID: 1}, {UserID: 2}}},
+				"downstream", auditDelivered, time.Now())
+		}
+		if err := a.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	events := readAuditEvents(t, path)
+	if len(events) != 6 {
+		t.Fatalf("got %d events, want 6", len(events))
+	}
+	for i, event := range events {
+		if event.Seq != uint64(i+1) {
+			t.Errorf("event %d has seq %d, want %d", i, event.Seq, i+1)
+		}
+		if event.Records != 3 || len(event.UserIDs) != 2 {
+			t.Errorf("event %d has %d records of %d users, want 3 of 2", i, event.Records, len(event.UserIDs))
+		}
+	}
+}
+
+func TestAuditSequenceUnderConcurrentDeliveries(t *testing.T) {
+	prevKey := auditHashKey
+	auditHashKey = "test-key"
+	defer func() { auditHashKey = prevKey }()
+
+	path := filepath.Join(t.TempDir(), "audit.ndjson")
+	a, err := openAuditLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const senders = 50
+	ids := make(map[string]bool)
+	batches := make([]*Batch, senders)
+	for i := range batches {
+		batches[i] = &Batch{ID: newBatchID(), Payloads: []LogPayload{{UserID: int64(i)}}}
+		ids[batches[i].ID] = true
+	}
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for _, batch := range batches {
+		wg.Add(1)
+		go func(batch *Batch) {
+			defer wg.Done()
+			<-start
+			a.Record(batch, "downstream", auditDelivered, time.Now())
+		}(batch)
+	}
+	close(start)
+	wg.Wait()
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	events := readAuditEvents(t, path)
+	if len(events) != senders {
+		t.Fatalf("got %d events, want %d", len(events), senders)
+	}
+	for i, event := range events {
+		if event.Seq != uint64(i+1) {
+			t.Errorf("event %d has seq %d, want %d", i, event.Seq, i+1)
+		}
+		if !ids[event.BatchID] {
+			t.Errorf("event %d has unknown or repeated batch %s", i, event.BatchID)
+		}
+		delete(ids, event.BatchID)
+	}
+	if len(ids) != 0 {
+		t.Errorf("%d batches never audited", len(ids))
+	}
+}
+
+func TestHashedUserIDsDependOnKey(t *testing.T) {
+	prevKey := auditHashKey
+	defer func() { auditHashKey = prevKey }()
+
+	payloads := []LogPayload{{UserID: 42}}
+	auditHashKey = "a"
+	first := hashedUserIDs(payloads)
+	auditHashKey = "b"
+	second := hashedUserIDs(payloads)
+	if first[0] == second[0] {
+		t.Error("user id hash doesn't depend on AUDIT_HASH_KEY")
+	}
+}
+
+func TestAuditRecordsDeadLetteredRecords(t *testing.T) {
+	prevKey, prevAudit, prevDeadLetters, prevMax := auditHashKey, audit, deadLetters, downstreamMaxBytes
+	dir := t.TempDir()
+	pool, err := newDeadLetterPool(dir, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := openAuditLog(filepath.Join(dir, "audit.ndjson"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	prevAction := oversizedPayloadAction
+	auditHashKey, audit, deadLetters, downstreamMaxBytes = "test-key", a, pool, 10
+	oversizedPayloadAction = oversizedDeadLetter
+	defer func() {
+		pool.Close()
+		auditHashKey, audit, deadLetters, downstreamMaxBytes = prevKey, prevAudit, prevDeadLetters, prevMax
+		oversizedPayloadAction = prevAction
+	}()
+
+	payload := LogPayload{UserID: 1, Title: "far too long for the downstream"}
+	if !rejectOverLimit(payload, encodedSize(&payload)) {
+		t.Fatal("over-limit record not dead-lettered")
+	}
+	sendOversized(LogPayload{UserID: 2})
+	batch := &Batch{ID: "b1", Payloads: []LogPayload{{UserID: 3}, {UserID: 4}}}
+	dropRejectedRecords("downstream", batch, &recordFailure{rejected: []int{1}, reasons: map[int]string{1: "bad"}}, time.Now())
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	events := readAuditEvents(t, filepath.Join(dir, "audit.ndjson"))
+	want := []string{downstreamLimitsDestination, oversizedDestination, "downstream"}
+	if len(events) != len(want) {
+		t.Fatalf("got %d events, want %d", len(events), len(want))
+	}
+	for i, event := range events {
+		if event.Destination != want[i] || event.Outcome != auditDeadLettered || event.Records != 1 {
+			t.Errorf("event %d = %s %s %d records, want %s %s 1", i,
+				event.Destination, event.Outcome, event.Records, want[i], auditDeadLettered)
+		}
+	}
+}
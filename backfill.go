@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/json"
+	"sync"
+)
+
+var (
+	// Carry forward each user's last-known meta into payloads sent without one
+	backfillMeta = envBool("BACKFILL_META", false)
+
+	// Cap on users whose meta is remembered; the least recently seen are evicted first
+	backfillMetaMaxUsers = envInt("BACKFILL_META_MAX_USERS", 10000)
+
+	// Last-known meta per user, nil when BACKFILL_META is disabled
+	metaCache *userMetaCache
+)
+
+// userMeta is one user's last-known meta
+type userMeta struct {
+	userID int64
+	meta   Metadata
+}
+
+// userMetaCache remembers the most recent meta of at most maxUsers users
+type userMetaCache struct {
+	maxUsers int
+
+	mu     sync.Mutex
+	lru    *list.List // of *userMeta, most recently seen first
+	byUser map[int64]*list.Element
+}
+
+func newUserMetaCache(maxUsers int) *userMetaCache {
+	if maxUsers < 1 {
+		maxUsers = 1
+	}
+	return &userMetaCache{
+		maxUsers: maxUsers,
+		lru:      list.New(),
+		byUser:   make(map[int64]*list.Element),
+	}
+}
+
+// Backfill fills payload's meta from the cache when body carries no meta,
+// and otherwise remembers the payload's meta for its user. Reports whether
+// meta was backfilled.
+func (c *userMetaCache) Backfill(payload *LogPayload, body []byte) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.byUser[payload.UserID]
+	if !hasMeta(body) {
+		if !ok {
+			return false
+		}
+		c.lru.MoveToFront(el)
+		payload.Meta = copyMetadata(el.Value.(*userMeta).meta)
+		return true
+	}
+
+	meta := copyMetadata(payload.Meta)
+	if ok {
+		c.lru.MoveToFront(el)
+		el.Value.(*userMeta).meta = meta
+		return false
+	}
+
+	if c.lru.Len() >= c.maxUsers {
+		oldest := c.lru.Back()
+		delete(c.byUser, oldest.Value.(*userMeta).userID)
+		c.lru.Remove(oldest)
+	}
+	c.byUser[payload.UserID] = c.lru.PushFront(&userMeta{userID: payload.UserID, meta: meta})
+	return false
+}
+
+// hasMeta reports whether the JSON object body has a non-null meta field
+func hasMeta(body []byte) bool {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return true
+	}
+	meta, ok := fields["meta"]
+	return ok && !bytes.Equal(bytes.TrimSpace(meta), []byte("null"))
+}
+
+// copyMetadata copies meta so cached and forwarded payloads don't share logins
+func copyMetadata(meta Metadata) Metadata {
+	if meta.Logins != nil {
+		meta.Logins = append([]Login(nil), meta.Logins...)
+	}
+	return meta
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestMetaBackfilledByHandler(t *testing.T) {
+	const withMeta = `{"user_id":1,"meta":{"logins":[{"ip":"10.0.0.1"}]}}`
+	tests := []struct {
+		name    string
+		earlier []string
+		body    string
+		wantIP  string
+	}{
+		{"no earlier meta", nil, `{"user_id":1}`, ""},
+		{"backfilled", []string{withMeta}, `{"user_id":1}`, "10.0.0.1"},
+		{"null meta backfilled", []string{withMeta}, `{"user_id":1,"meta":null}`, "10.0.0.1"},
+		{"own meta kept", []string{withMeta}, `{"user_id":1,"meta":{"logins":[{"ip":"10.0.0.2"}]}}`, "10.0.0.2"},
+		{"latest meta remembered", []string{withMeta, `{"user_id":1,"meta":{"logins":[{"ip":"10.0.0.3"}]}}`}, `{"user_id":1}`, "10.0.0.3"},
+		{"other user's meta not used", []string{withMeta}, `{"user_id":2}`, ""},
+		{"evicted user", []string{withMeta, `{"user_id":2,"meta":{}}`, `{"user_id":3,"meta":{}}`}, `{"user_id":1}`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prev := metaCache
+			metaCache = newUserMetaCache(2)
+			defer func() { metaCache = prev }()
+
+			p := captureQueue(t)
+			for _, body := range tt.earlier {
+				postLog(t, body)
+			}
+			queued(p)
+			postLog(t, tt.body)
+
+			got := queued(p)
+			if len(got) != 1 {
+				t.Fatalf("enqueued %d payloads, want 1", len(got))
+			}
+			var ip string
+			if logins := got[0].Meta.Logins; len(logins) > 0 {
+				ip = logins[0].IP
+			}
+			if ip != tt.wantIP {
+				t.Errorf("login ip %q, want %q", ip, tt.wantIP)
+			}
+		})
+	}
+}
+
+func TestBackfilledMetaIsCopied(t *testing.T) {
+	c := newUserMetaCache(10)
+	c.Backfill(&LogPayload{UserID: 1, Meta: Metadata{Logins: []Login{{IP: "a"}}}}, []byte(`{"meta":{}}`))
+
+	first := LogPayload{UserID: 1}
+	if !c.Backfill(&first, []byte(`{}`)) {
+		t.Fatal("meta not backfilled")
+	}
+	first.Meta.Logins[0].IP = "changed"
+
+	second := LogPayload{UserID: 1}
+	c.Backfill(&second, []byte(`{}`))
+	if second.Meta.Logins[0].IP != "a" {
+		t.Errorf("cached meta changed through a forwarded payload to %q", second.Meta.Logins[0].IP)
+	}
+}
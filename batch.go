@@ -0,0 +1,63 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"go.uber.org/zap"
+)
+
+// Batch is a group of payloads delivered downstream together
+type Batch struct {
+	// Random id identifying the batch in logs and admin endpoints
+	ID string
+
+	// Per-process sequence number, assigned once and kept across retries
+	Sequence uint64
+
+	Payloads []LogPayload
+
+	// Earlier batches sharing a user, and the release of this batch's
+	// hold, when ORDERED_PER_USER is enabled
+	waitFor []chan struct{}
+	release func()
+
+	// Set once sendBatch starts delivering the batch
+	sending int32
+}
+
+// newBatch wraps payloads in a Batch, assigning its sequence number
+func newBatch(payloads []LogPayload) *Batch {
+	batch := &Batch{ID: newBatchID(), Payloads: payloads}
+
+	if batchSequence != nil {
+		seq, err := batchSequence.Next()
+		if err != nil {
+			logger.Error("Failed to persist batch sequence", zap.Error(err))
+		}
+		batch.Sequence = seq
+	}
+
+	if userOrdering != nil {
+		batch.waitFor, batch.release = userOrdering.Reserve(payloads)
+	}
+
+	unsent.Add(batch)
+	return batch
+}
+
+// Bytes is the total request body size of the batch's payloads
+func (b *Batch) Bytes() int {
+	var n int
+	for _, payload := range b.Payloads {
+		n += payload.size
+	}
+	return n
+}
+
+// newBatchID returns a random 128-bit hex id
+func newBatchID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
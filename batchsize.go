@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+)
+
+// Largest batch size settable at runtime. Partition queues are sized for
+// it at startup, so raising the batch size never outgrows their headroom.
+var batchSizeMax = envInt("BATCH_SIZE_MAX", 0)
+
+// Batch size in effect, starting at BATCH_SIZE and changed on /admin/batch-size
+var activeBatchSize = int64(batchSize)
+
+// batchSizeState is the body of the /admin/batch-size endpoint
+type batchSizeState struct {
+	BatchSize int `json:"batch_size"`
+	Max       int `json:"max,omitempty"`
+}
+
+// queueCapacity is the capacity of each partition's payload queue
+func queueCapacity() int {
+	if batchSizeMax > batchSize {
+		return batchSizeMax
+	}
+	return batchSize
+}
+
+func currentBatchSize() int {
+	return int(atomic.LoadInt64(&activeBatchSize))
+}
+
+// setBatchSize changes the batch size, which must be within 1 and the
+// queue capacity, and has every processor re-check its current batch
+func setBatchSize(n int) error {
+	if n < 1 || n > queueCapacity() {
+		return fmt.Errorf("batch size %d must be between 1 and %d", n, queueCapacity())
+	}
+
+	atomic.StoreInt64(&activeBatchSize, int64(n))
+	for _, p := range partitions {
+		select {
+		case p.resized <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// flushFull sends every full batch from the front of logBatch at the
+// current batch size, returning the remainder. Checking with >= keeps a
+// batch that outgrew a lowered size from waiting for the interval.
+func (p *partition) flushFull(wg *sync.WaitGroup, logBatch []LogPayload) []LogPayload {
+	size := currentBatchSize()
+	for size > 0 && len(logBatch) >= size {
+		p.flush(wg, logBatch[:size:size])
+		logBatch = append([]LogPayload(nil), logBatch[size:]...)
+	}
+	return logBatch
+}
+
+// Report the batch size in effect
+
+func getBatchSizeHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, batchSizeState{
+		BatchSize: currentBatchSize(),
+		Max:       queueCapacity(),
+	})
+}
+
+// Change the batch size
+
+func putBatchSizeHandler(w http.ResponseWriter, r *http.Request) {
+	var req batchSizeState
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid_body", err.Error(), nil)
+		return
+	}
+
+	previous := currentBatchSize()
+	if err := setBatchSize(req.BatchSize); err != nil {
+		writeJSONError(w, http.StatusUnprocessableEntity, "invalid_batch_size", err.Error(), nil)
+		return
+	}
+	logger.Info("Batch size changed", zap.Int("previous", previous), zap.Int("batch_size", req.BatchSize))
+
+	getBatchSizeHandler(w, r)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestPutBatchSize(t *testing.T) {
+	prevMax := batchSizeMax
+	batchSizeMax = 20
+	defer func() { batchSizeMax = prevMax }()
+	startPipeline(t, 10)
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantSize   int
+	}{
+		{"raised within max", `{"batch_size":20}`, http.StatusOK, 20},
+		{"lowered", `{"batch_size":5}`, http.StatusOK, 5},
+		{"above max", `{"batch_size":21}`, http.StatusUnprocessableEntity, 5},
+		{"zero", `{"batch_size":0}`, http.StatusUnprocessableEntity, 5},
+		{"not json", `five`, http.StatusBadRequest, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := adminRequest(t, http.MethodPut, "/admin/batch-size", tt.body); rec.Code != tt.wantStatus {
+				t.Errorf("status %d, want %d", rec.Code, tt.wantStatus)
+			}
+
+			var state batchSizeState
+			rec := adminRequest(t, http.MethodGet, "/admin/batch-size", "")
+			if err := json.Unmarshal(rec.Body.Bytes(), &state); err != nil {
+				t.Fatal(err)
+			}
+			if state.BatchSize != tt.wantSize || state.Max != 20 {
+				t.Errorf("state %+v, want batch size %d of max 20", state, tt.wantSize)
+			}
+		})
+	}
+}
+
+func TestLoweredBatchSizeFlushesFullBatch(t *testing.T) {
+	d := startDownstream(t, http.StatusOK, "")
+	startPipeline(t, 10, d.sink(formatJSON))
+	for i := 0; i < 3; i++ {
+		postLog(t, `{"user_id":1}`)
+	}
+
+	if rec := adminRequest(t, http.MethodPut, "/admin/batch-size", `{"batch_size":2}`); rec.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200", rec.Code)
+	}
+	eventually(t, "full batch sent", func() bool { return len(d.Requests()) == 1 })
+	if n := deliveredCount(t, d); n != 2 {
+		t.Errorf("sent a batch of %d, want the new size of 2", n)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import "go.uber.org/zap"
+
+// Log a one-line composition summary of every flushed batch
+var batchSummaryLog = envBool("BATCH_SUMMARY_LOG", false)
+
+// batchSummary describes what a flushed batch contains
+type batchSummary struct {
+	Count       int
+	UniqueUsers int
+	Completed   int
+	Pending     int
+	TotalSum    float64
+	Bytes       int
+}
+
+// summarizeBatch computes the composition of payloads
+func summarizeBatch(payloads []LogPayload) batchSummary {
+	summary := batchSummary{Count: len(payloads)}
+	users := make(map[int64]struct{}, len(payloads))
+	for _, payload := range payloads {
+		users[payload.UserID] = struct{}{}
+		if payload.Completed {
+			summary.Completed++
+		} else {
+			summary.Pending++
+		}
+		summary.TotalSum += payload.Total
+		summary.Bytes += payload.size
+	}
+	summary.UniqueUsers = len(users)
+	return summary
+}
+
+// logBatchSummary logs the composition of a flushed batch
+func logBatchSummary(payloads []LogPayload) {
+	summary := summarizeBatch(payloads)
+	logger.Info("Batch flushed",
+		zap.Int("batch_size", summary.Count),
+		zap.Int("unique_users", summary.UniqueUsers),
+		zap.Int("completed", summary.Completed),
+		zap.Int("pending", summary.Pending),
+		zap.Float64("total_sum", summary.TotalSum),
+		zap.Int("bytes", summary.Bytes))
+}
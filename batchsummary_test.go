@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestSummarizeBatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		payloads []LogPayload
+		want     batchSummary
+	}{
+		{"empty", nil, batchSummary{}},
+		{"mixed", []LogPayload{
+			{UserID: 1, Total: 2.5, Completed: true, size: 10},
+			{UserID: 1, Total: 1, size: 20},
+			{UserID: 2, Total: 0.5, Completed: true, size: 5},
+		}, batchSummary{Count: 3, UniqueUsers: 2, Completed: 2, Pending: 1, TotalSum: 4, Bytes: 35}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := summarizeBatch(tt.payloads); got != tt.want {
+				t.Errorf("summary %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBatchSummaryLogged(t *testing.T) {
+	prev := batchSummaryLog
+	batchSummaryLog = true
+	defer func() { batchSummaryLog = prev }()
+	logs := observeLogs(t)
+
+	d := startDownstream(t, http.StatusOK, "")
+	startPipeline(t, 3, d.sink(formatJSON))
+	for i := 0; i < 3; i++ {
+		postLog(t, fmt.Sprintf(`{"user_id":%d,"total":1,"completed":%v}`, i%2, i == 0))
+	}
+	eventually(t, "batch summary", func() bool { return logs.FilterMessage("Batch flushed").Len() == 1 })
+
+	fields := logs.FilterMessage("Batch flushed").All()[0].ContextMap()
+	if fields["batch_size"] != int64(3) || fields["unique_users"] != int64(2) || fields["completed"] != int64(1) || fields["total_sum"] != float64(3) {
+		t.Errorf("summary fields %v", fields)
+	}
+}
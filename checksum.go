@@ -0,0 +1,40 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+)
+
+// Checksum algorithms for BATCH_CHECKSUM
+const (
+	checksumMD5    = "md5"
+	checksumSHA256 = "sha256"
+)
+
+// Send a checksum of each outgoing body: md5 as Content-MD5, sha256 as
+// Content-Digest; empty sends neither
+var batchChecksum = envString("BATCH_CHECKSUM", "")
+
+// validBatchChecksum reports whether algorithm is a supported BATCH_CHECKSUM
+func validBatchChecksum(algorithm string) bool {
+	switch algorithm {
+	case "", checksumMD5, checksumSHA256:
+		return true
+	}
+	return false
+}
+
+// setChecksumHeader sets the algorithm's checksum header over data, the
+// exact bytes sent after compression and encryption
+func setChecksumHeader(header http.Header, algorithm string, data []byte) {
+	switch algorithm {
+	case checksumMD5:
+		sum := md5.Sum(data)
+		header.Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+	case checksumSHA256:
+		sum := sha256.Sum256(data)
+		header.Set("Content-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(sum[:])+":")
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestBatchChecksumHeaders(t *testing.T) {
+	md5Sum := func(b []byte) string {
+		sum := md5.Sum(b)
+		return base64.StdEncoding.EncodeToString(sum[:])
+	}
+	sha256Digest := func(b []byte) string {
+		sum := sha256.Sum256(b)
+		return "sha-256=:" + base64.StdEncoding.EncodeToString(sum[:]) + ":"
+	}
+	tests := []struct {
+		algorithm string
+		encoding  string
+		header    string
+		sum       func([]byte) string
+	}{
+		{checksumMD5, encodingIdentity, "Content-MD5", md5Sum},
+		{checksumSHA256, encodingIdentity, "Content-Digest", sha256Digest},
+		{checksumSHA256, encodingGzip, "Content-Digest", sha256Digest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.algorithm+"/"+tt.encoding, func(t *testing.T) {
+			prev := batchChecksum
+			batchChecksum = tt.algorithm
+			defer func() { batchChecksum = prev }()
+
+			d := startDownstream(t, http.StatusOK, "")
+			s := d.sink(formatJSON)
+			s.encoding = tt.encoding
+			if _, err := s.Send(context.Background(), &Batch{Payloads: []LogPayload{{UserID: 1}}}); err != nil {
+				t.Fatal(err)
+			}
+
+			// The checksum covers the bytes on the wire, compressed or not
+			req := d.Requests()[0]
+			if got, want := req.header.Get(tt.header), tt.sum(req.body); got != want {
+				t.Errorf("%s %q, want %q", tt.header, got, want)
+			}
+			if tt.encoding == encodingGzip {
+				zr, err := gzip.NewReader(bytes.NewReader(req.body))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if plain, _ := io.ReadAll(zr); !strings.Contains(string(plain), `"user_id":1`) {
+					t.Errorf("decompressed body %s", plain)
+				}
+			}
+		})
+	}
+}
+
+func TestNoChecksumByDefault(t *testing.T) {
+	d := startDownstream(t, http.StatusOK, "")
+	if _, err := d.sink(formatJSON).Send(context.Background(), &Batch{Payloads: []LogPayload{{UserID: 1}}}); err != nil {
+		t.Fatal(err)
+	}
+	header := d.Requests()[0].header
+	if header.Get("Content-MD5") != "" || header.Get("Content-Digest") != "" {
+		t.Errorf("checksum headers sent while disabled: %v", header)
+	}
+}
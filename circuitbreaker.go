@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// Consecutive failed sends that open a destination's breaker, 0 disables breakers
+	circuitFailureThreshold = envInt("CIRCUIT_FAILURE_THRESHOLD", 0)
+
+	// How long an open breaker rejects sends before letting a probe through
+	circuitOpenDuration = envDuration("CIRCUIT_OPEN_DURATION", 30*time.Second)
+
+	// Breakers keyed by sink destination, nil when disabled
+	breakers map[string]*circuitBreaker
+
+	circuitStateGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "circuit_breaker_state",
+		Help: "Per-destination circuit breaker state: 0 closed, 1 open, 2 half-open.",
+	}, []string{"destination"})
+)
+
+// Returned instead of sending while a destination's breaker is open
+var errCircuitOpen = errors.New("circuit breaker open")
+
+// Circuit breaker states, as reported by circuit_breaker_state
+const (
+	circuitClosed = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// circuitBreaker stops sends to one destination after threshold
+// consecutive failures. Once openFor has passed a single probe is let
+// through; its success closes the breaker and its failure reopens it.
+type circuitBreaker struct {
+	destination string
+	threshold   int
+	openFor     time.Duration
+
+	mu       sync.Mutex
+	state    int
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// newCircuitBreakers builds an independent breaker for every sink
+func newCircuitBreakers(sinks []Sink, threshold int, openFor time.Duration) map[string]*circuitBreaker {
+	built := make(map[string]*circuitBreaker, len(sinks))
+	for _, s := range sinks {
+		b := &circuitBreaker{destination: s.Destination(), threshold: threshold, openFor: openFor}
+		b.setState(circuitClosed)
+		built[s.Destination()] = b
+	}
+	return built
+}
+
+// Allow reports whether a send may go ahead. A nil breaker allows everything.
+func (b *circuitBreaker) Allow(now time.Time) bool {
+	if b == nil {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case circuitOpen:
+		if now.Sub(b.openedAt) < b.openFor {
+			return false
+		}
+		b.setState(circuitHalfOpen)
+		b.probing = true
+		return true
+	case circuitHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	}
+	return true
+}
+
+// Record updates the breaker with the outcome of an allowed send
+func (b *circuitBreaker) Record(ok bool, now time.Time) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if ok {
+		b.failures = 0
+		if b.state != circuitClosed {
+			b.setState(circuitClosed)
+		}
+		return
+	}
+
+	b.failures++
+	if b.state == circuitHalfOpen || b.failures >= b.threshold {
+		b.openedAt = now
+		b.setState(circuitOpen)
+	}
+}
+
+// setState moves the breaker to state. Callers hold b.mu, except during construction.
+func (b *circuitBreaker) setState(state int) {
+	b.state = state
+	circuitStateGauge.WithLabelValues(b.destination).Set(float64(state))
+}
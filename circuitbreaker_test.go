@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	type step struct {
+		after  time.Duration
+		result string // "ok", "fail" or "" for only asking
+	}
+	tests := []struct {
+		name      string
+		steps     []step
+		checkAt   time.Duration
+		wantAllow bool
+		wantState int
+	}{
+		{"closed below threshold", []step{{0, "fail"}}, 0, true, circuitClosed},
+		{"opens at threshold", []step{{0, "fail"}, {0, "fail"}}, 0, false, circuitOpen},
+		{"success resets failures", []step{{0, "fail"}, {0, "ok"}, {0, "fail"}}, 0, true, circuitClosed},
+		{"probe after open duration", []step{{0, "fail"}, {0, "fail"}}, time.Minute, true, circuitHalfOpen},
+		{"single probe at a time", []step{{0, "fail"}, {0, "fail"}, {time.Minute, ""}}, time.Minute, false, circuitHalfOpen},
+		{"probe success closes", []step{{0, "fail"}, {0, "fail"}, {time.Minute, "ok"}}, time.Minute, true, circuitClosed},
+		{"probe failure reopens", []step{{0, "fail"}, {0, "fail"}, {time.Minute, "fail"}}, time.Minute, false, circuitOpen},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newCircuitBreakers([]Sink{&httpSink{url: "http://breaker-test/" + tt.name}}, 2, 30*time.Second)["breaker-test/"+tt.name]
+			for _, s := range tt.steps {
+				now := start.Add(s.after)
+				if b.Allow(now) && s.result != "" {
+					b.Record(s.result == "ok", now)
+				}
+			}
+			if got := b.Allow(start.Add(tt.checkAt)); got != tt.wantAllow {
+				t.Errorf("allow %v, want %v", got, tt.wantAllow)
+			}
+			if b.state != tt.wantState {
+				t.Errorf("state %d, want %d", b.state, tt.wantState)
+			}
+		})
+	}
+}
+
+func TestOpenBreakerSkipsSend(t *testing.T) {
+	useDeadLetters(t)
+	d := startDownstream(t, http.StatusOK, "")
+	s := d.sink(formatJSON)
+
+	prev := breakers
+	breakers = newCircuitBreakers([]Sink{s}, 1, time.Hour)
+	defer func() { breakers = prev }()
+	breakers[s.Destination()].Record(false, time.Now())
+
+	if ok, _ := deliver(s, &Batch{Payloads: []LogPayload{{UserID: 1}}}); ok {
+		t.Error("delivered through an open breaker")
+	}
+	if n := len(d.Requests()); n != 0 {
+		t.Errorf("downstream received %d requests while the breaker was open", n)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"net/http"
+	"time"
+)
+
+var (
+	// Overall per-request timeout, including body transfer
+	requestTimeout = envDuration("REQUEST_TIMEOUT", 0)
+
+	// Connection-level timeouts on the outgoing transport
+	dialTimeout           = envDuration("DIAL_TIMEOUT", 30*time.Second)
+	tlsHandshakeTimeout   = envDuration("TLS_HANDSHAKE_TIMEOUT", 10*time.Second)
+	responseHeaderTimeout = envDuration("RESPONSE_HEADER_TIMEOUT", 0)
+
+	// Local IP outgoing connections bind to, for egress firewall rules on multi-homed hosts
+	sourceAddrSetting = os.Getenv("SOURCE_ADDR")
+
+	// Parsed from SOURCE_ADDR at startup, nil to let the OS choose
+	sourceAddr *net.TCPAddr
+
+	// Shared client for all outgoing requests, built at startup
+	httpClient *http.Client
+)
+
+// parseSourceAddr parses SOURCE_ADDR as an IP assigned to a local interface
+func parseSourceAddr(s string) (*net.TCPAddr, error) {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("source address %q is not an IP address", s)
+	}
+
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+			return &net.TCPAddr{IP: ip}, nil
+		}
+	}
+	return nil, fmt.Errorf("source address %s is not assigned to any local interface", ip)
+}
+
+// newHTTPClient builds the shared outgoing client from the configured timeouts
+func newHTTPClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   dialTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+	if sourceAddr != nil {
+		dialer.LocalAddr = sourceAddr
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.TLSHandshakeTimeout = tlsHandshakeTimeout
+	transport.ResponseHeaderTimeout = responseHeaderTimeout
+
+	if !connectionMetrics {
+		return &http.Client{
+			Timeout:   requestTimeout,
+			Transport: transport,
+		}
+	}
+
+	transport.DialContext = countingDial(dialer.DialContext)
+	return &http.Client{
+		Timeout:   requestTimeout,
+		Transport: countingTransport{next: transport},
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTTPClientTimeouts(t *testing.T) {
+	downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer downstream.Close()
+
+	tests := []struct {
+		name           string
+		request        time.Duration
+		responseHeader time.Duration
+		wantErr        bool
+	}{
+		{"no timeouts", 0, 0, false},
+		{"response header timeout", 0, 20 * time.Millisecond, true},
+		{"request timeout", 20 * time.Millisecond, 0, true},
+		{"generous timeouts", time.Second, time.Second, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prevRequest, prevHeader := requestTimeout, responseHeaderTimeout
+			requestTimeout, responseHeaderTimeout = tt.request, tt.responseHeader
+			defer func() { requestTimeout, responseHeaderTimeout = prevRequest, prevHeader }()
+
+			client := newHTTPClient()
+			transport := client.Transport.(*http.Transport)
+			if transport.TLSHandshakeTimeout != tlsHandshakeTimeout || transport.ResponseHeaderTimeout != tt.responseHeader {
+				t.Errorf("transport timeouts %s, %s", transport.TLSHandshakeTimeout, transport.ResponseHeaderTimeout)
+			}
+
+			resp, err := client.Get(downstream.URL)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHTTPClientTLSHandshakeTimeout(t *testing.T) {
+	// Accept connections but never answer the ClientHello
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	prev := tlsHandshakeTimeout
+	tlsHandshakeTimeout = 100 * time.Millisecond
+	defer func() { tlsHandshakeTimeout = prev }()
+
+	start := time.Now()
+	resp, err := newHTTPClient().Get("https://" + ln.Addr().String())
+	elapsed := time.Since(start)
+	if err == nil {
+		resp.Body.Close()
+		t.Fatal("request succeeded through a stalled handshake")
+	}
+	if !strings.Contains(err.Error(), "TLS handshake timeout") {
+		t.Errorf("error %v, want a TLS handshake timeout", err)
+	}
+	if elapsed < tlsHandshakeTimeout || elapsed > tlsHandshakeTimeout+time.Second {
+		t.Errorf("failed after %s, want about %s", elapsed, tlsHandshakeTimeout)
+	}
+}
+
+func TestParseSourceAddr(t *testing.T) {
+	tests := []struct {
+		addr    string
+		wantErr bool
+	}{
+		{"127.0.0.1", false},
+		{"192.0.2.1", true},
+		{"localhost", true},
+		{"", true},
+	}
+	for _, tt := range tests {
+		addr, err := parseSourceAddr(tt.addr)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseSourceAddr(%q) error %v, want error %v", tt.addr, err, tt.wantErr)
+		}
+		if err == nil && !addr.IP.Equal(net.ParseIP(tt.addr)) {
+			t.Errorf("parseSourceAddr(%q) = %s", tt.addr, addr)
+		}
+	}
+}
+
+func TestHTTPClientDialsFromSourceAddr(t *testing.T) {
+	addr, err := parseSourceAddr("127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := sourceAddr
+	sourceAddr = addr
+	defer func() { sourceAddr = prev }()
+
+	var remote string
+	downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remote = r.RemoteAddr
+	}))
+	defer downstream.Close()
+
+	resp, err := newHTTPClient().Get(downstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if host, _, _ := net.SplitHostPort(remote); host != "127.0.0.1" {
+		t.Errorf("request came from %s, want 127.0.0.1", remote)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Clock skew handling modes for login timestamps
+const (
+	clockSkewReject = "reject"
+	clockSkewClamp  = "clamp"
+	clockSkewAccept = "accept"
+)
+
+var (
+	maxClockSkew  = envDuration("MAX_CLOCK_SKEW", 0)
+	clockSkewMode = envString("CLOCK_SKEW_MODE", clockSkewReject)
+)
+
+// validClockSkewMode reports whether mode is a supported CLOCK_SKEW_MODE
+func validClockSkewMode(mode string) bool {
+	switch mode {
+	case clockSkewReject, clockSkewClamp, clockSkewAccept:
+		return true
+	}
+	return false
+}
+
+// checkClockSkew rejects or clamps login timestamps further than maxSkew
+// from now, depending on mode. Zero timestamps are left untouched.
+func checkClockSkew(payload *LogPayload, now time.Time, maxSkew time.Duration, mode string) error {
+	if maxSkew <= 0 || mode == clockSkewAccept {
+		return nil
+	}
+
+	earliest, latest := now.Add(-maxSkew), now.Add(maxSkew)
+
+	for i := range payload.Meta.Logins {
+		login := &payload.Meta.Logins[i]
+		if login.Time.IsZero() {
+			continue
+		}
+
+		var bound time.Time
+		switch {
+		case login.Time.After(latest):
+			bound = latest
+		case login.Time.Before(earliest):
+			bound = earliest
+		default:
+			continue
+		}
+
+		if mode == clockSkewClamp {
+			login.Time = bound
+			continue
+		}
+		return fmt.Errorf("meta.logins[%d].time %s is more than %s from server time",
+			i, login.Time.Format(time.RFC3339), maxSkew)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCheckClockSkew(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		mode     string
+		maxSkew  time.Duration
+		login    time.Time
+		wantErr  bool
+		wantTime time.Time
+	}{
+		{"within skew", clockSkewReject, time.Minute, now.Add(30 * time.Second), false, now.Add(30 * time.Second)},
+		{"future rejected", clockSkewReject, time.Minute, now.Add(time.Hour), true, now.Add(time.Hour)},
+		{"past rejected", clockSkewReject, time.Minute, now.Add(-time.Hour), true, now.Add(-time.Hour)},
+		{"future clamped", clockSkewClamp, time.Minute, now.Add(time.Hour), false, now.Add(time.Minute)},
+		{"past clamped", clockSkewClamp, time.Minute, now.Add(-time.Hour), false, now.Add(-time.Minute)},
+		{"accept mode", clockSkewAccept, time.Minute, now.Add(time.Hour), false, now.Add(time.Hour)},
+		{"disabled", clockSkewReject, 0, now.Add(time.Hour), false, now.Add(time.Hour)},
+		{"zero time untouched", clockSkewReject, time.Minute, time.Time{}, false, time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := LogPayload{Meta: Metadata{Logins: []Login{{Time: tt.login}}}}
+			err := checkClockSkew(&payload, now, tt.maxSkew, tt.mode)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error %v, want error %v", err, tt.wantErr)
+			}
+			if got := payload.Meta.Logins[0].Time; !got.Equal(tt.wantTime) {
+				t.Errorf("login time %s, want %s", got, tt.wantTime)
+			}
+		})
+	}
+}
+
+func TestClockSkewRejectedByHandler(t *testing.T) {
+	prevSkew, prevMode := maxClockSkew, clockSkewMode
+	maxClockSkew, clockSkewMode = time.Minute, clockSkewReject
+	defer func() { maxClockSkew, clockSkewMode = prevSkew, prevMode }()
+
+	p := captureQueue(t)
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	rec, e := postLog(t, fmt.Sprintf(`{"user_id":1,"meta":{"logins":[{"time":%q}]}}`, future))
+	if rec.Code != http.StatusUnprocessableEntity || e.Error != "clock_skew" {
+		t.Errorf("got %d %q, want 422 clock_skew", rec.Code, e.Error)
+	}
+	if n := len(queued(p)); n != 0 {
+		t.Errorf("enqueued %d payloads, want 0", n)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Merge batches a partition flushes within this window into one send, 0 disables it
+var coalesceWindow = envDuration("COALESCE_WINDOW", 0)
+
+// coalescer holds flushed batches for a short window so flushes fired
+// close together, e.g. by the interval right after a full batch, reach
+// every sink as one request. It is owned by its partition's processor.
+type coalescer struct {
+	window time.Duration
+
+	pending []LogPayload
+	timer   *time.Timer
+}
+
+func newCoalescer(window time.Duration) *coalescer {
+	return &coalescer{window: window}
+}
+
+// Add holds payloads, starting the window when nothing was pending
+func (c *coalescer) Add(payloads []LogPayload) {
+	if len(c.pending) == 0 {
+		c.timer = time.NewTimer(c.window)
+	}
+	c.pending = append(c.pending, payloads...)
+}
+
+// C fires when the window closes, and is nil while nothing is pending or
+// for a nil coalescer
+func (c *coalescer) C() <-chan time.Time {
+	if c == nil || c.timer == nil {
+		return nil
+	}
+	return c.timer.C
+}
+
+// Take returns and clears the pending payloads
+func (c *coalescer) Take() []LogPayload {
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	payloads := c.pending
+	c.pending = nil
+	return payloads
+}
+
+// sendCoalesced sends the partition's coalesced payloads, if any
+func (p *partition) sendCoalesced(wg *sync.WaitGroup) {
+	if payloads := p.coalesce.Take(); len(payloads) > 0 {
+		p.send(wg, payloads)
+	}
+}
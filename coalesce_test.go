@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCoalesceWindowMergesFlushes(t *testing.T) {
+	tests := []struct {
+		name         string
+		window       time.Duration
+		wantRequests int
+	}{
+		{"disabled", 0, 2},
+		{"merged within window", 50 * time.Millisecond, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prev := coalesceWindow
+			coalesceWindow = tt.window
+			defer func() { coalesceWindow = prev }()
+
+			d := startDownstream(t, http.StatusOK, "")
+			startPipeline(t, 2, d.sink(formatJSON))
+			for i := 0; i < 4; i++ {
+				postLog(t, `{"user_id":1}`)
+			}
+			eventually(t, "payloads sent", func() bool { return deliveredCount(t, d) == 4 })
+
+			if n := len(d.Requests()); n != tt.wantRequests {
+				t.Errorf("sent %d requests, want %d", n, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestCoalescedPayloadsDrainedOnStop(t *testing.T) {
+	prev := coalesceWindow
+	coalesceWindow = time.Hour
+	defer func() { coalesceWindow = prev }()
+
+	d := startDownstream(t, http.StatusOK, "")
+	p := startPipeline(t, 1, d.sink(formatJSON))
+	postLog(t, `{"user_id":1}`)
+	postLog(t, `{"user_id":2}`)
+
+	close(p.stop)
+	<-p.done
+	if n := deliveredCount(t, d); n != 2 {
+		t.Errorf("delivered %d payloads held in the window, want 2", n)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"strconv"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Supported outgoing Content-Encodings, selectable per sink
+const (
+	encodingIdentity = "identity"
+	encodingGzip     = "gzip"
+	encodingZstd     = "zstd"
+)
+
+var (
+	// Gzip outgoing batches at GZIP_LEVEL
+	outgoingGzip     = envBool("OUTGOING_GZIP", false)
+	gzipLevelSetting = envString("GZIP_LEVEL", "default")
+
+	// Parsed from GZIP_LEVEL at startup
+	gzipLevel = gzip.DefaultCompression
+)
+
+// sinkEncoding validates a configured encoding, defaulting to gzip when
+// OUTGOING_GZIP is set and identity otherwise
+func sinkEncoding(encoding string) (string, error) {
+	switch encoding {
+	case "":
+		if outgoingGzip {
+			return encodingGzip, nil
+		}
+		return encodingIdentity, nil
+	case encodingIdentity, encodingGzip, encodingZstd:
+		return encoding, nil
+	}
+	return "", fmt.Errorf("unknown encoding %q, must be identity, gzip or zstd", encoding)
+}
+
+// compressBytes encodes data with the given Content-Encoding
+func compressBytes(data []byte, encoding string) ([]byte, error) {
+	switch encoding {
+	case encodingGzip:
+		return gzipBytes(data, gzipLevel)
+	case encodingZstd:
+		return zstdBytes(data)
+	}
+	return data, nil
+}
+
+// parseGzipLevel accepts 1-9, "best-speed", "best-compression" or "default"
+func parseGzipLevel(s string) (int, error) {
+	switch s {
+	case "default":
+		return gzip.DefaultCompression, nil
+	case "best-speed":
+		return gzip.BestSpeed, nil
+	case "best-compression":
+		return gzip.BestCompression, nil
+	}
+
+	level, err := strconv.Atoi(s)
+	if err != nil || level < gzip.BestSpeed || level > gzip.BestCompression {
+		return 0, fmt.Errorf("gzip level %q must be 1-9, best-speed, best-compression or default", s)
+	}
+	return level, nil
+}
+
+// gzipBytes compresses data at the given level
+func gzipBytes(data []byte, level int) ([]byte, error) {
+	var buf bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&buf, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// zstdBytes compresses data with zstd at the default level
+func zstdBytes(data []byte) ([]byte, error) {
+	zw, err := zstd.NewWriter(nil)
+	if err != nil {
+		return nil, err
+	}
+	defer zw.Close()
+	return zw.EncodeAll(data, nil), nil
+}
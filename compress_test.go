@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestParseGzipLevel(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int
+		wantErr bool
+	}{
+		{"default", gzip.DefaultCompression, false},
+		{"best-speed", gzip.BestSpeed, false},
+		{"best-compression", gzip.BestCompression, false},
+		{"1", 1, false},
+		{"9", 9, false},
+		{"0", 0, true},
+		{"10", 0, true},
+		{"fast", 0, true},
+		{"", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseGzipLevel(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseGzipLevel(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if err == nil && got != tt.want {
+			t.Errorf("parseGzipLevel(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestGzipBytesRoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte(`{"user_id":1,"title":"a"}`), 100)
+	for _, level := range []int{gzip.BestSpeed, gzip.DefaultCompression, gzip.BestCompression} {
+		compressed, err := gzipBytes(data, level)
+		if err != nil {
+			t.Fatalf("level %d: %v", level, err)
+		}
+		zr, err := gzip.NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			t.Fatalf("level %d: %v", level, err)
+		}
+		got, err := io.ReadAll(zr)
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("level %d: round trip mismatch, err %v", level, err)
+		}
+	}
+}
+
+func TestSinkEncoding(t *testing.T) {
+	tests := []struct {
+		encoding string
+		gzipAll  bool
+		want     string
+		wantErr  bool
+	}{
+		{"", false, encodingIdentity, false},
+		{"", true, encodingGzip, false},
+		{encodingIdentity, true, encodingIdentity, false},
+		{encodingZstd, false, encodingZstd, false},
+		{"br", false, "", true},
+	}
+	for _, tt := range tests {
+		prev := outgoingGzip
+		outgoingGzip = tt.gzipAll
+		got, err := sinkEncoding(tt.encoding)
+		outgoingGzip = prev
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("sinkEncoding(%q) with OUTGOING_GZIP %v = %q, %v, want %q", tt.encoding, tt.gzipAll, got, err, tt.want)
+		}
+	}
+}
+
+func TestSinksEncodeForTheirDestination(t *testing.T) {
+	gunzip := func(b []byte) ([]byte, error) {
+		zr, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(zr)
+	}
+	unzstd := func(b []byte) ([]byte, error) {
+		zr, err := zstd.NewReader(nil)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return zr.DecodeAll(b, nil)
+	}
+	identity := func(b []byte) ([]byte, error) { return b, nil }
+
+	tests := []struct {
+		encoding   string
+		wantHeader string
+		decode     func([]byte) ([]byte, error)
+	}{
+		{encodingGzip, "gzip", gunzip},
+		{encodingZstd, "zstd", unzstd},
+		{encodingIdentity, "", identity},
+	}
+	batch := &Batch{Payloads: []LogPayload{{UserID: 1, Title: "a"}}}
+	for _, tt := range tests {
+		t.Run(tt.encoding, func(t *testing.T) {
+			d := startDownstream(t, http.StatusOK, "")
+			s := d.sink(formatJSON)
+			s.encoding = tt.encoding
+			if _, err := s.Send(context.Background(), batch); err != nil {
+				t.Fatal(err)
+			}
+
+			req := d.Requests()[0]
+			if got := req.header.Get("Content-Encoding"); got != tt.wantHeader {
+				t.Errorf("Content-Encoding %q, want %q", got, tt.wantHeader)
+			}
+			plain, err := tt.decode(req.body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var payloads []LogPayload
+			if err := json.Unmarshal(plain, &payloads); err != nil || len(payloads) != 1 || payloads[0].Title != "a" {
+				t.Errorf("decoded body %s", plain)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Count open and idle outgoing connections for /metrics
+var connectionMetrics = envBool("CONNECTION_METRICS", false)
+
+var (
+	// Outgoing connections currently open, and requests currently holding one
+	openConns   int64
+	activeConns int64
+
+	openConnsGauge = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "outgoing_connections_open",
+		Help: "Outgoing downstream connections currently open.",
+	}, func() float64 {
+		return float64(atomic.LoadInt64(&openConns))
+	})
+
+	idleConnsGauge = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "outgoing_connections_idle",
+		Help: "Open outgoing downstream connections not carrying a request, i.e. idle in the pool.",
+	}, func() float64 {
+		return float64(idleConnCount())
+	})
+)
+
+// idleConnCount estimates pooled idle connections as open minus active
+func idleConnCount() int64 {
+	idle := atomic.LoadInt64(&openConns) - atomic.LoadInt64(&activeConns)
+	if idle < 0 {
+		return 0
+	}
+	return idle
+}
+
+// countingDial wraps dial so every connection it opens is counted until closed
+func countingDial(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		atomic.AddInt64(&openConns, 1)
+		return &countedConn{Conn: conn}, nil
+	}
+}
+
+// countedConn decrements the open count once when closed
+type countedConn struct {
+	net.Conn
+	once sync.Once
+}
+
+func (c *countedConn) Close() error {
+	c.once.Do(func() { atomic.AddInt64(&openConns, -1) })
+	return c.Conn.Close()
+}
+
+// countingTransport counts requests from send until their response body is closed
+type countingTransport struct {
+	next http.RoundTripper
+}
+
+func (t countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt64(&activeConns, 1)
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		atomic.AddInt64(&activeConns, -1)
+		return nil, err
+	}
+	resp.Body = &countedBody{ReadCloser: resp.Body}
+	return resp, nil
+}
+
+// CloseIdleConnections forwards to the wrapped transport, so
+// http.Client.CloseIdleConnections still reaches the pool
+func (t countingTransport) CloseIdleConnections() {
+	if c, ok := t.next.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
+
+// countedBody releases its request's active count once when closed
+type countedBody struct {
+	io.ReadCloser
+	once sync.Once
+}
+
+func (b *countedBody) Close() error {
+	b.once.Do(func() { atomic.AddInt64(&activeConns, -1) })
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestConnectionMetrics(t *testing.T) {
+	prev := connectionMetrics
+	connectionMetrics = true
+	defer func() { connectionMetrics = prev }()
+
+	inHandler, release := make(chan struct{}), make(chan struct{})
+	downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inHandler <- struct{}{}
+		<-release
+	}))
+	defer downstream.Close()
+
+	client := newHTTPClient()
+	openBefore := atomic.LoadInt64(&openConns)
+	done := make(chan error, 1)
+	go func() {
+		resp, err := client.Get(downstream.URL)
+		if err == nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		done <- err
+	}()
+
+	steps := []struct {
+		name     string
+		advance  func()
+		wantOpen int64
+		wantIdle int64
+	}{
+		{"request in flight", func() { <-inHandler }, 1, 0},
+		{"connection back in the pool", func() {
+			close(release)
+			if err := <-done; err != nil {
+				t.Fatal(err)
+			}
+		}, 1, 1},
+		{"idle connection closed", client.CloseIdleConnections, 0, 0},
+	}
+	for _, step := range steps {
+		step.advance()
+		eventually(t, step.name, func() bool {
+			return atomic.LoadInt64(&openConns)-openBefore == step.wantOpen && idleConnCount() == step.wantIdle
+		})
+	}
+}
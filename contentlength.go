@@ -0,0 +1,25 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Reject /log bodies whose size differs from the declared Content-Length
+var strictContentLength = envBool("STRICT_CONTENT_LENGTH", false)
+
+// contentLengthMismatch describes how the body read (n bytes, ending with
+// readErr) disagrees with the declared Content-Length, or returns "" when
+// it matches or no length was declared. net/http stops reading at the
+// declared length and parses any bytes past it as the next request,
+// answering 400 and closing the connection when they aren't one.
+func contentLengthMismatch(declared int64, n int, readErr error) string {
+	if declared < 0 {
+		return ""
+	}
+	if errors.Is(readErr, io.ErrUnexpectedEOF) || int64(n) != declared {
+		return fmt.Sprintf("declared Content-Length %d but body ended after %d bytes", declared, n)
+	}
+	return ""
+}
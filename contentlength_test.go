@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// startLogServer serves handleLog on a loopback listener
+func startLogServer(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(handleLog), ConnContext: withConn}
+	go server.Serve(ln)
+	t.Cleanup(func() { server.Close() })
+	return ln.Addr().String()
+}
+
+// rawPost sends a POST /log declaring length, writes body, and returns the
+// error code of the first response and the status of every response read
+// before the server closed the connection
+func rawPost(t *testing.T, addr string, length int, body string) ([]int, string) {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	fmt.Fprintf(conn, "POST /log HTTP/1.1\r\nHost: test\r\nContent-Length: %d\r\n\r\n%s", length, body)
+	conn.(*net.TCPConn).CloseWrite()
+
+	var statuses []int
+	var code string
+	br := bufio.NewReader(conn)
+	for {
+		resp, err := http.ReadResponse(br, nil)
+		if err != nil {
+			return statuses, code
+		}
+		data, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if statuses == nil {
+			var e errorResponse
+			_ = json.Unmarshal(data, &e)
+			code = e.Error
+		}
+		statuses = append(statuses, resp.StatusCode)
+	}
+}
+
+func TestStrictContentLength(t *testing.T) {
+	strictContentLength = true
+	defer func() { strictContentLength = false }()
+	p := captureQueue(t)
+	addr := startLogServer(t)
+
+	const payload = `{"user_id":1,"title":"a"}`
+	tests := []struct {
+		name         string
+		length       int
+		body         string
+		wantStatuses []int
+		wantCode     string
+		wantQueued   int
+	}{
+		{"matching", len(payload), payload, []int{http.StatusAccepted}, "", 1},
+		{"declared longer than body", len(payload) + 5, payload, []int{http.StatusBadRequest}, "length_mismatch", 0},
+		{"declared shorter than body", len(payload) - 1, payload, []int{http.StatusBadRequest}, "", 0},
+		// The excess is refused as a malformed request, never read as body
+		{"body continues past declared length", len(payload), payload + "  {\"user_id\":2}\r\n", []int{http.StatusAccepted, http.StatusBadRequest}, "", 1},
+		{"pipelined request after body", len(payload), payload + fmt.Sprintf("POST /log HTTP/1.1\r\nHost: test\r\nContent-Length: %d\r\n\r\n%s", len(payload), payload), []int{http.StatusAccepted, http.StatusAccepted}, "", 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statuses, code := rawPost(t, addr, tt.length, tt.body)
+			if !reflect.DeepEqual(statuses, tt.wantStatuses) || code != tt.wantCode {
+				t.Errorf("got %v %q, want %v %q", statuses, code, tt.wantStatuses, tt.wantCode)
+			}
+			if got := len(queued(p)); got != tt.wantQueued {
+				t.Errorf("enqueued %d payloads, want %d", got, tt.wantQueued)
+			}
+		})
+	}
+}
+
+func TestContentLengthMismatch(t *testing.T) {
+	tests := []struct {
+		declared int64
+		n        int
+		readErr  error
+		want     bool
+	}{
+		{-1, 10, nil, false},
+		{10, 10, nil, false},
+		{10, 4, io.ErrUnexpectedEOF, true},
+		{10, 4, nil, true},
+	}
+	for _, tt := range tests {
+		if got := contentLengthMismatch(tt.declared, tt.n, tt.readErr) != ""; got != tt.want {
+			t.Errorf("contentLengthMismatch(%d, %d, %v) mismatch = %v, want %v", tt.declared, tt.n, tt.readErr, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// readCPUTimes returns the busy and total jiffies summed over all CPUs
+// from the aggregate line of /proc/stat
+func readCPUTimes() (busy, total uint64, err error) {
+	f, err := os.Open("/proc/stat")
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	if !scanner.Scan() {
+		return 0, 0, fmt.Errorf("read /proc/stat: %w", scanner.Err())
+	}
+	fields := strings.Fields(scanner.Text())
+	if len(fields) < 5 || fields[0] != "cpu" {
+		return 0, 0, fmt.Errorf("unexpected /proc/stat line %q", scanner.Text())
+	}
+
+	// user nice system idle iowait irq softirq steal; the guest fields
+	// that may follow are already included in user and nice
+	values := fields[1:]
+	if len(values) > 8 {
+		values = values[:8]
+	}
+	for i, field := range values {
+		v, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return 0, 0, err
+		}
+		total += v
+		if i != 3 && i != 4 {
+			busy += v
+		}
+	}
+	return busy, total, nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// CPU sampling reads /proc/stat, which only Linux provides
+func readCPUTimes() (busy, total uint64, err error) {
+	return 0, 0, errors.New("CPU sampling is not supported on this platform")
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"container/list"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	deadLetterDir      = os.Getenv("DEADLETTER_DIR")
+	maxDeadLetterFiles = envInt("MAX_DEADLETTER_FILES", 16)
+
+	// Store each payload's original request bytes alongside the parsed batch
+	deadLetterIncludeRaw = envBool("DEADLETTER_INCLUDE_RAW", false)
+
+	// Dead-letter writers, nil when DEADLETTER_DIR is unset and failed
+	// sends remain fatal
+	deadLetters *deadLetterPool
+
+	unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+)
+
+// deadLetterRecord is a batch that could not be delivered, written as one NDJSON line
+type deadLetterRecord struct {
+	Time        time.Time    `json:"time"`
+	Destination string       `json:"destination"`
+	Reason      string       `json:"reason"`
+	StatusCode  int          `json:"status_code,omitempty"`
+	Batch       []LogPayload `json:"batch"`
+
+	// Original request bodies, index-aligned with Batch
+	Raw []json.RawMessage `json:"raw,omitempty"`
+}
+
+// deadLetterPool appends dead-letter records to one file per destination,
+// keeping at most max files open and closing the least recently used
+type deadLetterPool struct {
+	dir string
+	max int
+
+	mu    sync.Mutex
+	lru   *list.List // of *deadLetterFile, most recently used first
+	files map[string]*list.Element
+}
+
+// deadLetterFile is an open dead-letter file for a destination
+type deadLetterFile struct {
+	destination string
+	f           *os.File
+}
+
+func newDeadLetterPool(dir string, max int) (*deadLetterPool, error) {
+	if max < 1 {
+		max = 1
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &deadLetterPool{
+		dir:   dir,
+		max:   max,
+		lru:   list.New(),
+		files: make(map[string]*list.Element),
+	}, nil
+}
+
+// Write appends rec to the dead-letter file of its destination
+func (p *deadLetterPool) Write(rec deadLetterRecord) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	f, err := p.file(rec.Destination)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(line)
+	return err
+}
+
+// file returns the open file for destination, reopening it and evicting
+// the least recently used file when over the limit. Callers hold p.mu.
+func (p *deadLetterPool) file(destination string) (*os.File, error) {
+	if el, ok := p.files[destination]; ok {
+		p.lru.MoveToFront(el)
+		return el.Value.(*deadLetterFile).f, nil
+	}
+
+	for p.lru.Len() >= p.max {
+		oldest := p.lru.Back()
+		dlf := oldest.Value.(*deadLetterFile)
+		p.lru.Remove(oldest)
+		delete(p.files, dlf.destination)
+		_ = dlf.f.Close()
+	}
+
+	name := unsafeFileChars.ReplaceAllString(destination, "_") + ".ndjson"
+	f, err := os.OpenFile(filepath.Join(p.dir, name), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	p.files[destination] = p.lru.PushFront(&deadLetterFile{destination: destination, f: f})
+	return f, nil
+}
+
+// Close closes all open dead-letter files
+func (p *deadLetterPool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var firstErr error
+	for el := p.lru.Front(); el != nil; el = el.Next() {
+		if err := el.Value.(*deadLetterFile).f.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	p.lru.Init()
+	p.files = make(map[string]*list.Element)
+	return firstErr
+}
+
+// deadLetterBatch writes a batch that failed delivery to the destination's dead-letter file
+func deadLetterBatch(destination string, batch []LogPayload, status int, cause error) {
+	rec := deadLetterRecord{
+		Time:        time.Now().UTC(),
+		Destination: destination,
+		StatusCode:  status,
+		Batch:       batch,
+	}
+	if cause != nil {
+		rec.Reason = cause.Error()
+	}
+	if deadLetterIncludeRaw {
+		rec.Raw = make([]json.RawMessage, len(batch))
+		for i, payload := range batch {
+			rec.Raw[i] = payload.raw
+		}
+	}
+
+	if err := deadLetters.Write(rec); err != nil {
+		logger.Error("Failed to write dead letter",
+			zap.String("destination", rec.Destination),
+			zap.Int("batch_size", len(batch)),
+			zap.Error(err))
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// countLines returns the number of lines in the file at path
+func countLines(t *testing.T, path string) int {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var n int
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		n++
+	}
+	return n
+}
+
+func TestDeadLetterPoolLimitsOpenFiles(t *testing.T) {
+	dir := t.TempDir()
+	pool, err := newDeadLetterPool(dir, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	destinations := []string{"a.example/logs", "b.example/logs", "c.example/logs", "a.example/logs"}
+	for _, destination := range destinations {
+		if err := pool.Write(deadLetterRecord{Destination: destination, Reason: "test"}); err != nil {
+			t.Fatal(err)
+		}
+		if n := pool.lru.Len(); n > 2 {
+			t.Fatalf("%d files open, want at most 2", n)
+		}
+	}
+
+	// The least recently used file was closed and reopened for appending
+	if n := countLines(t, filepath.Join(dir, "a.example_logs.ndjson")); n != 2 {
+		t.Errorf("a.example has %d records, want 2", n)
+	}
+	if _, ok := pool.files["b.example/logs"]; ok {
+		t.Error("least recently used file still open")
+	}
+}
+
+func TestDeadLetterBatchRecordsCause(t *testing.T) {
+	dir := useDeadLetters(t)
+	deadLetterBatch("downstream", []LogPayload{{UserID: 1}, {UserID: 2}}, 503, errors.New("unavailable"))
+
+	if n := countLines(t, filepath.Join(dir, "downstream.ndjson")); n != 1 {
+		t.Errorf("got %d records, want 1 per batch", n)
+	}
+}
+
+func TestDeadLetterIncludeRaw(t *testing.T) {
+	for _, includeRaw := range []bool{false, true} {
+		dir := useDeadLetters(t)
+		prev := deadLetterIncludeRaw
+		deadLetterIncludeRaw = includeRaw
+
+		// The handler keeps the request bytes as received
+		p := captureQueue(t)
+		const body = `{"user_id": 1, "title": "raw", "legacy": true}`
+		postLog(t, body)
+		payload := queued(p)[0]
+		deadLetterBatch("downstream", []LogPayload{payload}, 500, errors.New("failed"))
+		deadLetterIncludeRaw = prev
+
+		data, err := os.ReadFile(filepath.Join(dir, "downstream.ndjson"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var rec deadLetterRecord
+		if err := json.Unmarshal(data, &rec); err != nil {
+			t.Fatal(err)
+		}
+		if !includeRaw {
+			if rec.Raw != nil {
+				t.Errorf("raw bytes recorded while disabled: %s", rec.Raw)
+			}
+			continue
+		}
+		// Raw JSON is compacted when the record is encoded
+		var want bytes.Buffer
+		_ = json.Compact(&want, []byte(body))
+		if len(rec.Raw) != 1 || string(rec.Raw[0]) != want.String() {
+			t.Errorf("raw %s, want the original body", rec.Raw)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Deadline for reading and decoding a /log body, 0 disables it
+var decodeTimeout = envDuration("DECODE_TIMEOUT", 0)
+
+// Context key holding the request's underlying connection
+type connContextKey struct{}
+
+// withConn stores the connection in every request context on it, for http.Server.ConnContext
+func withConn(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connContextKey{}, c)
+}
+
+// setReadDeadline sets the read deadline of the connection under r, so a
+// body read blocked past it fails instead of holding the handler. Returns
+// a func clearing the deadline again for keep-alive reuse.
+func setReadDeadline(r *http.Request, deadline time.Time) func() {
+	conn, ok := requestConn(r)
+	if !ok || conn.SetReadDeadline(deadline) != nil {
+		return func() {}
+	}
+	return clearReadDeadline(conn)
+}
+
+// requestConn returns the connection r arrived on
+func requestConn(r *http.Request) (net.Conn, bool) {
+	conn, ok := r.Context().Value(connContextKey{}).(net.Conn)
+	return conn, ok
+}
+
+func clearReadDeadline(conn net.Conn) func() {
+	return func() { _ = conn.SetReadDeadline(time.Time{}) }
+}
+
+// isTimeout reports whether err is a deadline being exceeded
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, os.ErrDeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout())
+}
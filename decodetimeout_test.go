@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// trickledPost sends a POST /log declaring length, writing each chunk after
+// waiting gap, and returns the response status and error code. Chunks
+// shorter than length leave the server waiting for the rest.
+func trickledPost(t *testing.T, addr string, length int, chunks []string, gap time.Duration) (int, string) {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	fmt.Fprintf(conn, "POST /log HTTP/1.1\r\nHost: test\r\nContent-Length: %d\r\n\r\n", length)
+	for _, chunk := range chunks {
+		time.Sleep(gap)
+		if _, err := io.WriteString(conn, chunk); err != nil {
+			break
+		}
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	var e errorResponse
+	_ = json.Unmarshal(data, &e)
+	return resp.StatusCode, e.Error
+}
+
+func TestDecodeTimeout(t *testing.T) {
+	const body = `{"user_id":1}`
+	tests := []struct {
+		name       string
+		chunks     []string
+		wantStatus int
+		wantError  string
+	}{
+		{"read in time", []string{body}, http.StatusAccepted, ""},
+		{"body never completed", []string{body[:5]}, http.StatusRequestTimeout, "decode_timeout"},
+		{"body trickling past the deadline", []string{body[:3], body[3:6], body[6:9]}, http.StatusRequestTimeout, "decode_timeout"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prev := decodeTimeout
+			decodeTimeout = 200 * time.Millisecond
+			defer func() { decodeTimeout = prev }()
+			captureQueue(t)
+
+			status, code := trickledPost(t, startLogServer(t), len(body), tt.chunks, 80*time.Millisecond)
+			if status != tt.wantStatus || code != tt.wantError {
+				t.Errorf("got %d %q, want %d %q", status, code, tt.wantStatus, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestDecodeTimeoutClearedForKeepAlive(t *testing.T) {
+	prev := decodeTimeout
+	decodeTimeout = 100 * time.Millisecond
+	defer func() { decodeTimeout = prev }()
+	captureQueue(t)
+
+	conn, err := net.Dial("tcp", startLogServer(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	br := bufio.NewReader(conn)
+
+	// A second request arriving after the first's deadline reuses the connection
+	const req = "POST /log HTTP/1.1\r\nHost: test\r\nContent-Length: 13\r\n\r\n{\"user_id\":1}"
+	for i := 0; i < 2; i++ {
+		if i > 0 {
+			time.Sleep(200 * time.Millisecond)
+		}
+		io.WriteString(conn, req)
+		resp, err := http.ReadResponse(br, nil)
+		if err != nil {
+			t.Fatalf("request %d: %v", i+1, err)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusAccepted {
+			t.Errorf("request %d: status %d, want 202", i+1, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Cap on a request body's size after Content-Encoding is undone, so small
+// compressed bodies can't expand without bound
+var maxDecompressedBytes = envInt("MAX_DECOMPRESSED_BYTES", 10<<20)
+
+// Returned once a body decompresses past MAX_DECOMPRESSED_BYTES
+var errDecompressedTooLarge = errors.New("decompressed body too large")
+
+// Returned for a Content-Encoding /log can't undo
+var errUnsupportedEncoding = errors.New("unsupported content encoding")
+
+// decompressBody undoes the request's Content-Encoding, reading at most
+// limit decompressed bytes
+func decompressBody(body []byte, encoding string, limit int) ([]byte, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", encodingIdentity:
+		return body, nil
+	case encodingGzip:
+	default:
+		return nil, fmt.Errorf("%w %q", errUnsupportedEncoding, encoding)
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	// Read one byte past the limit to tell a body at the limit from one over it
+	data, err := io.ReadAll(io.LimitReader(zr, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > limit {
+		return nil, errDecompressedTooLarge
+	}
+	return data, nil
+}
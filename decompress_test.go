@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGzippedLogBodies(t *testing.T) {
+	gzipped := func(s string) []byte {
+		data, err := gzipBytes([]byte(s), gzipLevel)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	bomb := gzipped(`{"user_id":1,"title":"` + string(bytes.Repeat([]byte("x"), 4096)) + `"}`)
+
+	tests := []struct {
+		name       string
+		body       []byte
+		encoding   string
+		wantStatus int
+		wantError  string
+	}{
+		{"plain", []byte(`{"user_id":1}`), "", http.StatusAccepted, ""},
+		{"gzip", gzipped(`{"user_id":1}`), "gzip", http.StatusAccepted, ""},
+		{"gzip in capitals", gzipped(`{"user_id":1}`), " GZIP ", http.StatusAccepted, ""},
+		{"expands past the limit", bomb, "gzip", http.StatusRequestEntityTooLarge, "decompressed_too_large"},
+		{"unsupported encoding", []byte(`{"user_id":1}`), "br", http.StatusUnsupportedMediaType, "unsupported_encoding"},
+		{"corrupt gzip", []byte("not gzip"), "gzip", http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prev := maxDecompressedBytes
+			maxDecompressedBytes = 1024
+			defer func() { maxDecompressedBytes = prev }()
+			p := captureQueue(t)
+
+			req := httptest.NewRequest(http.MethodPost, "/log", bytes.NewReader(tt.body))
+			if tt.encoding != "" {
+				req.Header.Set("Content-Encoding", tt.encoding)
+			}
+			rec := httptest.NewRecorder()
+			handleLog(rec, req)
+
+			var e errorResponse
+			_ = json.Unmarshal(rec.Body.Bytes(), &e)
+			if rec.Code != tt.wantStatus || e.Error != tt.wantError {
+				t.Errorf("got %d %q, want %d %q", rec.Code, e.Error, tt.wantStatus, tt.wantError)
+			}
+			wantQueued := 0
+			if tt.wantStatus == http.StatusAccepted {
+				wantQueued = 1
+			}
+			if n := len(queued(p)); n != wantQueued {
+				t.Errorf("enqueued %d payloads, want %d", n, wantQueued)
+			}
+		})
+	}
+}
+
+func TestDecompressBodyAtLimit(t *testing.T) {
+	data := bytes.Repeat([]byte("a"), 100)
+	compressed, err := gzipBytes(data, gzipLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := decompressBody(compressed, "gzip", 100); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("body at the limit: %v", err)
+	}
+	if _, err := decompressBody(compressed, "gzip", 99); err != errDecompressedTooLarge {
+		t.Errorf("body over the limit: %v, want %v", err, errDecompressedTooLarge)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+var (
+	// Drop payloads whose content was already seen within this window, 0 disables it
+	dedupeWindow = envDuration("DEDUPE_WINDOW", 0)
+
+	// Cap on remembered content hashes; the oldest are forgotten first
+	dedupeMaxEntries = envInt("DEDUPE_MAX_ENTRIES", 100000)
+
+	// Content-hash deduplicator, nil when DEDUPE_WINDOW is unset
+	contentDedupe *contentDeduper
+)
+
+// dedupeEntry is one remembered content hash
+type dedupeEntry struct {
+	hash [sha256.Size]byte
+	seen time.Time
+}
+
+// contentDeduper remembers the hashes of payloads seen within a sliding
+// window. Hashes live in a fixed-size ring ordered by first sighting, so
+// memory is capped at maxEntries regardless of traffic; under heavier
+// traffic the effective window shrinks rather than memory growing.
+type contentDeduper struct {
+	window time.Duration
+
+	mu   sync.Mutex
+	ring []dedupeEntry
+	head int
+	n    int
+	seen map[[sha256.Size]byte]time.Time
+}
+
+func newContentDeduper(window time.Duration, maxEntries int) *contentDeduper {
+	if maxEntries < 1 {
+		maxEntries = 1
+	}
+	return &contentDeduper{
+		window: window,
+		ring:   make([]dedupeEntry, maxEntries),
+		seen:   make(map[[sha256.Size]byte]time.Time, maxEntries),
+	}
+}
+
+// Duplicate reports whether payload's content was seen within the window,
+// remembering it otherwise
+func (d *contentDeduper) Duplicate(payload *LogPayload, now time.Time) bool {
+	hash, err := payloadHash(payload)
+	if err != nil {
+		return false
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.expire(now)
+	if _, ok := d.seen[hash]; ok {
+		return true
+	}
+
+	// Forget the oldest hash when the ring is full
+	if d.n == len(d.ring) {
+		d.evictOldest()
+	}
+	d.ring[(d.head+d.n)%len(d.ring)] = dedupeEntry{hash: hash, seen: now}
+	d.n++
+	d.seen[hash] = now
+	return false
+}
+
+// expire forgets hashes that slid out of the window
+func (d *contentDeduper) expire(now time.Time) {
+	for d.n > 0 && now.Sub(d.ring[d.head].seen) >= d.window {
+		d.evictOldest()
+	}
+}
+
+func (d *contentDeduper) evictOldest() {
+	oldest := d.ring[d.head]
+	if d.seen[oldest.hash].Equal(oldest.seen) {
+		delete(d.seen, oldest.hash)
+	}
+	d.ring[d.head] = dedupeEntry{}
+	d.head = (d.head + 1) % len(d.ring)
+	d.n--
+}
+
+// payloadHash hashes the normalized payload, so formatting and key order
+// in the request body don't affect deduplication
+func payloadHash(payload *LogPayload) ([sha256.Size]byte, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256(data), nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestContentDeduperDuplicate(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	a, b, c := LogPayload{UserID: 1}, LogPayload{UserID: 2}, LogPayload{UserID: 3}
+	type sighting struct {
+		payload LogPayload
+		after   time.Duration
+	}
+	tests := []struct {
+		name       string
+		maxEntries int
+		earlier    []sighting
+		last       sighting
+		want       bool
+	}{
+		{"first sighting", 10, nil, sighting{a, 0}, false},
+		{"within window", 10, []sighting{{a, 0}}, sighting{a, 30 * time.Second}, true},
+		{"window passed", 10, []sighting{{a, 0}}, sighting{a, time.Minute}, false},
+		{"different content", 10, []sighting{{a, 0}}, sighting{b, time.Second}, false},
+		{"evicted by a full ring", 2, []sighting{{a, 0}, {b, 0}, {c, 0}}, sighting{a, time.Second}, false},
+		{"kept while the ring has room", 3, []sighting{{a, 0}, {b, 0}, {c, 0}}, sighting{a, time.Second}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newContentDeduper(time.Minute, tt.maxEntries)
+			for _, s := range tt.earlier {
+				d.Duplicate(&s.payload, start.Add(s.after))
+			}
+			if got := d.Duplicate(&tt.last.payload, start.Add(tt.last.after)); got != tt.want {
+				t.Errorf("duplicate %v, want %v", got, tt.want)
+			}
+			if len(d.seen) > tt.maxEntries {
+				t.Errorf("remembering %d hashes, cap is %d", len(d.seen), tt.maxEntries)
+			}
+		})
+	}
+}
+
+func TestDuplicatesDroppedByHandler(t *testing.T) {
+	prev := contentDedupe
+	contentDedupe = newContentDeduper(time.Minute, 10)
+	defer func() { contentDedupe = prev }()
+
+	p := captureQueue(t)
+	// Same content, differently formatted
+	for _, body := range []string{`{"user_id":1,"title":"a"}`, `{ "title": "a", "user_id": 1 }`, `{"user_id":2}`} {
+		if rec, _ := postLog(t, body); rec.Code != http.StatusAccepted {
+			t.Fatalf("status %d, want 202", rec.Code)
+		}
+	}
+	if n := len(queued(p)); n != 2 {
+		t.Errorf("enqueued %d payloads, want the duplicate dropped", n)
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import "sync"
+
+var (
+	// Flag accepted /log responses while downstream delivery is failing
+	reportDegraded = envBool("REPORT_DEGRADED", false)
+
+	// Destinations whose last send failed, each cleared by its next successful send
+	degradedMu    sync.Mutex
+	degradedSinks = make(map[string]bool)
+)
+
+// setDegraded records whether delivery to destination is currently failing
+func setDegraded(destination string, degraded bool) {
+	degradedMu.Lock()
+	defer degradedMu.Unlock()
+
+	if degraded {
+		degradedSinks[destination] = true
+	} else {
+		delete(degradedSinks, destination)
+	}
+}
+
+// isDegraded reports whether the last send to any destination failed
+func isDegraded() bool {
+	degradedMu.Lock()
+	defer degradedMu.Unlock()
+	return len(degradedSinks) > 0
+}
@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+func TestDegradedPerDestination(t *testing.T) {
+	type step struct {
+		destination string
+		failed      bool
+	}
+	tests := []struct {
+		name  string
+		steps []step
+		want  bool
+	}{
+		{"no sends", nil, false},
+		{"one failing", []step{{"a", true}}, true},
+		{"failure then success", []step{{"a", true}, {"a", false}}, false},
+		{"other sink succeeds", []step{{"a", true}, {"b", false}}, true},
+		{"both recover", []step{{"a", true}, {"b", true}, {"a", false}, {"b", false}}, false},
+		{"one of two still failing", []step{{"a", true}, {"b", true}, {"b", false}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			degradedSinks = make(map[string]bool)
+			for _, s := range tt.steps {
+				setDegraded(s.destination, s.failed)
+			}
+			if got := isDegraded(); got != tt.want {
+				t.Errorf("isDegraded() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
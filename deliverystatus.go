@@ -0,0 +1,206 @@
+package main
+
+import (
+	"container/list"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Delivery states reported on /log/status
+const (
+	deliveryPending      = "pending"
+	deliveryDelivered    = "delivered"
+	deliveryFailed       = "failed"
+	deliveryDeadLettered = "dead_lettered"
+)
+
+var (
+	// How long each request's delivery outcome is kept, 0 disables tracking
+	deliveryStatusRetention = envDuration("DELIVERY_STATUS_RETENTION", 0)
+
+	// Bound on tracked requests; the least recently updated are evicted first
+	deliveryStatusMax = envInt("DELIVERY_STATUS_MAX", 10000)
+
+	// Tracked delivery outcomes, nil when DELIVERY_STATUS_RETENTION is unset
+	deliveryStatuses *deliveryStatusStore
+)
+
+// deliveryStatus is the latest known delivery state of one request. A
+// request carrying several payloads, like an NDJSON body, reports each
+// one's state in Records, in the order they were queued, and as its
+// DeliveryState the least settled of them.
+type deliveryStatus struct {
+	RequestID     string    `json:"request_id"`
+	DeliveryState string    `json:"delivery_state"`
+	Records       []string  `json:"records,omitempty"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// trackedRequest is the per-payload delivery states of one request
+type trackedRequest struct {
+	requestID string
+	records   []string
+	updatedAt time.Time
+}
+
+// deliveryStatusStore keeps each request's delivery state for ttl after
+// its last update, holding at most max requests
+type deliveryStatusStore struct {
+	ttl time.Duration
+	max int
+
+	mu        sync.Mutex
+	order     *list.List // of *trackedRequest, least recently updated first
+	byRequest map[string]*list.Element
+}
+
+func newDeliveryStatusStore(ttl time.Duration, max int) *deliveryStatusStore {
+	if max < 1 {
+		max = 1
+	}
+	return &deliveryStatusStore{
+		ttl:       ttl,
+		max:       max,
+		order:     list.New(),
+		byRequest: make(map[string]*list.Element),
+	}
+}
+
+// Track records a pending payload of the request, returning its index
+// among the request's payloads for Set
+func (s *deliveryStatusStore) Track(requestID string, now time.Time) int {
+	if requestID == "" {
+		return 0
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.evictExpired(now)
+
+	if el, ok := s.byRequest[requestID]; ok {
+		req := el.Value.(*trackedRequest)
+		req.records = append(req.records, deliveryPending)
+		req.updatedAt = now
+		s.order.MoveToBack(el)
+		return len(req.records) - 1
+	}
+
+	s.byRequest[requestID] = s.order.PushBack(&trackedRequest{
+		requestID: requestID,
+		records:   []string{deliveryPending},
+		updatedAt: now,
+	})
+	for s.order.Len() > s.max {
+		s.remove(s.order.Front())
+	}
+	return 0
+}
+
+// Set records state as the latest delivery state of the request's payload
+// at index record. Requests no longer tracked are ignored.
+func (s *deliveryStatusStore) Set(requestID string, record int, state string, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.evictExpired(now)
+
+	el, ok := s.byRequest[requestID]
+	if !ok {
+		return
+	}
+	req := el.Value.(*trackedRequest)
+	if record < 0 || record >= len(req.records) {
+		return
+	}
+	req.records[record], req.updatedAt = state, now
+	s.order.MoveToBack(el)
+}
+
+// Get returns the request's unexpired delivery state
+func (s *deliveryStatusStore) Get(requestID string, now time.Time) (deliveryStatus, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.evictExpired(now)
+
+	el, ok := s.byRequest[requestID]
+	if !ok {
+		return deliveryStatus{}, false
+	}
+	req := el.Value.(*trackedRequest)
+	status := deliveryStatus{
+		RequestID:     req.requestID,
+		DeliveryState: leastSettled(req.records),
+		UpdatedAt:     req.updatedAt,
+	}
+	if len(req.records) > 1 {
+		status.Records = append([]string(nil), req.records...)
+	}
+	return status, true
+}
+
+// leastSettled summarizes payload states as pending while any is,
+// then failed, then dead-lettered, and delivered only when all were
+func leastSettled(records []string) string {
+	summary := deliveryDelivered
+	for _, state := range records {
+		switch {
+		case state == deliveryPending:
+			return deliveryPending
+		case state == deliveryFailed:
+			summary = deliveryFailed
+		case state == deliveryDeadLettered && summary != deliveryFailed:
+			summary = deliveryDeadLettered
+		}
+	}
+	return summary
+}
+
+// evictExpired drops requests not updated within ttl. Callers hold s.mu.
+func (s *deliveryStatusStore) evictExpired(now time.Time) {
+	for el := s.order.Front(); el != nil; el = s.order.Front() {
+		if now.Sub(el.Value.(*trackedRequest).updatedAt) < s.ttl {
+			return
+		}
+		s.remove(el)
+	}
+}
+
+// remove deletes el from both indexes. Callers hold s.mu.
+func (s *deliveryStatusStore) remove(el *list.Element) {
+	req := s.order.Remove(el).(*trackedRequest)
+	delete(s.byRequest, req.requestID)
+}
+
+// setDeliveryState records state for every tracked payload
+func setDeliveryState(payloads []LogPayload, state string) {
+	if deliveryStatuses == nil {
+		return
+	}
+	now := time.Now()
+	for _, payload := range payloads {
+		if payload.requestID != "" {
+			deliveryStatuses.Set(payload.requestID, payload.record, state, now)
+		}
+	}
+}
+
+// Report a request's delivery state
+
+func getDeliveryStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if deliveryStatuses == nil {
+		writeJSONError(w, http.StatusNotFound, "not_enabled", "delivery status tracking is disabled", nil)
+		return
+	}
+
+	status, ok := deliveryStatuses.Get(chi.URLParam(r, "requestID"), time.Now())
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "not_found", "no delivery status for request", nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
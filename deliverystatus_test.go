@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+func TestDeliveryStatusStore(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		sets      []string
+		getAfter  time.Duration
+		get       string
+		wantState string
+	}{
+		{"tracked", []string{"a"}, time.Second, "a", deliveryPending},
+		{"expired", []string{"a"}, time.Minute, "a", ""},
+		{"unknown", []string{"a"}, time.Second, "b", ""},
+		{"oldest evicted at capacity", []string{"a", "b", "c"}, time.Second, "a", ""},
+		{"update refreshes eviction order", []string{"a", "b", "a", "c"}, time.Second, "a", deliveryPending},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newDeliveryStatusStore(time.Minute, 2)
+			for _, id := range tt.sets {
+				s.Track(id, start)
+			}
+			status, ok := s.Get(tt.get, start.Add(tt.getAfter))
+			if status.DeliveryState != tt.wantState || ok != (tt.wantState != "") {
+				t.Errorf("state %q, %v, want %q", status.DeliveryState, ok, tt.wantState)
+			}
+		})
+	}
+}
+
+func TestDeliveryStatusPolling(t *testing.T) {
+	tests := []struct {
+		name       string
+		downstream int
+		wantState  string
+	}{
+		{"delivered", http.StatusOK, deliveryDelivered},
+		{"dead-lettered", http.StatusBadRequest, deliveryDeadLettered},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prevStatuses, prevRetry := deliveryStatuses, retryOnlyOnConnect
+			deliveryStatuses, retryOnlyOnConnect = newDeliveryStatusStore(time.Minute, 10), true
+			defer func() { deliveryStatuses, retryOnlyOnConnect = prevStatuses, prevRetry }()
+			useDeadLetters(t)
+
+			d := startDownstream(t, tt.downstream, "")
+			startPipeline(t, 1, d.sink(formatJSON))
+
+			r := chi.NewRouter()
+			r.Use(middleware.RequestID)
+			r.Post("/log", handleLog)
+			r.Get("/log/status/{requestID}", getDeliveryStatusHandler)
+
+			req := httptest.NewRequest(http.MethodPost, "/log", strings.NewReader(`{"user_id":1}`))
+			req.Header.Set(middleware.RequestIDHeader, "req-1")
+			r.ServeHTTP(httptest.NewRecorder(), req)
+
+			var status deliveryStatus
+			eventually(t, tt.wantState, func() bool {
+				rec := httptest.NewRecorder()
+				r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/log/status/req-1", nil))
+				return rec.Code == http.StatusOK && json.Unmarshal(rec.Body.Bytes(), &status) == nil && status.DeliveryState == tt.wantState
+			})
+
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/log/status/unknown", nil))
+			if rec.Code != http.StatusNotFound {
+				t.Errorf("unknown request answered %d, want 404", rec.Code)
+			}
+		})
+	}
+}
+
+func TestDeliveryStatusRecords(t *testing.T) {
+	tests := []struct {
+		name        string
+		states      []string
+		wantState   string
+		wantRecords []string
+	}{
+		{"single record", []string{deliveryDelivered}, deliveryDelivered, nil},
+		{"one still pending", []string{deliveryDelivered, deliveryPending}, deliveryPending, []string{deliveryDelivered, deliveryPending}},
+		{"one dead-lettered", []string{deliveryDeadLettered, deliveryDelivered}, deliveryDeadLettered, []string{deliveryDeadLettered, deliveryDelivered}},
+		{"failed over dead-lettered", []string{deliveryFailed, deliveryDeadLettered}, deliveryFailed, []string{deliveryFailed, deliveryDeadLettered}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
+			s := newDeliveryStatusStore(time.Minute, 10)
+			for range tt.states {
+				s.Track("req", now)
+			}
+			for i, state := range tt.states {
+				s.Set("req", i, state, now)
+			}
+			status, _ := s.Get("req", now)
+			if status.DeliveryState != tt.wantState || !reflect.DeepEqual(status.Records, tt.wantRecords) {
+				t.Errorf("got %q %v, want %q %v", status.DeliveryState, status.Records, tt.wantState, tt.wantRecords)
+			}
+		})
+	}
+}
+
+func TestDeliveryStatusPollingNDJSON(t *testing.T) {
+	prevStatuses, prevRetry, prevMode := deliveryStatuses, retryOnlyOnConnect, trailingDataMode
+	deliveryStatuses, retryOnlyOnConnect, trailingDataMode = newDeliveryStatusStore(time.Minute, 10), true, trailingDataNDJSON
+	t.Cleanup(func() { deliveryStatuses, retryOnlyOnConnect, trailingDataMode = prevStatuses, prevRetry, prevMode })
+	useDeadLetters(t)
+
+	// Reject the batch holding user 1, so the request's payloads settle differently
+	d := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(data), `"user_id":1,`) {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	t.Cleanup(d.Close)
+	startPipeline(t, 1, &httpSink{url: d.URL, format: formatJSON, encoding: encodingIdentity, client: d.Client()})
+
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Post("/log", handleLog)
+	r.Get("/log/status/{requestID}", getDeliveryStatusHandler)
+
+	req := httptest.NewRequest(http.MethodPost, "/log", strings.NewReader(`{"user_id":1}`+"\n"+`{"user_id":2}`))
+	req.Header.Set(middleware.RequestIDHeader, "req-1")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	want := []string{deliveryDeadLettered, deliveryDelivered}
+	var status deliveryStatus
+	eventually(t, "both records settled", func() bool {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/log/status/req-1", nil))
+		return rec.Code == http.StatusOK && json.Unmarshal(rec.Body.Bytes(), &status) == nil && reflect.DeepEqual(status.Records, want)
+	})
+	if status.DeliveryState != deliveryDeadLettered {
+		t.Errorf("request state %q, want %q", status.DeliveryState, deliveryDeadLettered)
+	}
+}
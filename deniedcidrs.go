@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Actions for payloads whose latest login IP is in a denied CIDR
+const (
+	deniedActionReject = "reject"
+	deniedActionDrop   = "drop"
+	deniedActionFlag   = "flag"
+)
+
+var (
+	// Comma-separated IPv4/IPv6 CIDRs whose logins are denied
+	deniedCIDRsSetting = envString("DENIED_CIDRS", "")
+
+	deniedCIDRAction = envString("DENIED_CIDR_ACTION", deniedActionReject)
+
+	// Compiled DENIED_CIDRS, nil when unset
+	deniedNets []*net.IPNet
+)
+
+// validDeniedCIDRAction reports whether action is a supported DENIED_CIDR_ACTION
+func validDeniedCIDRAction(action string) bool {
+	switch action {
+	case deniedActionReject, deniedActionDrop, deniedActionFlag:
+		return true
+	}
+	return false
+}
+
+// parseDeniedCIDRs compiles a comma-separated CIDR list
+func parseDeniedCIDRs(setting string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, field := range strings.Split(setting, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(field)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, ipNet)
+	}
+	if len(nets) == 0 {
+		return nil, fmt.Errorf("no CIDRs in %q", setting)
+	}
+	return nets, nil
+}
+
+// latestLoginIP returns the IP of the payload's most recent login, or nil
+// when it has none or the IP doesn't parse
+func latestLoginIP(payload *LogPayload) net.IP {
+	var latest *Login
+	for i := range payload.Meta.Logins {
+		login := &payload.Meta.Logins[i]
+		if latest == nil || login.Time.After(latest.Time) {
+			latest = login
+		}
+	}
+	if latest == nil {
+		return nil
+	}
+	return net.ParseIP(strings.TrimSpace(latest.IP))
+}
+
+// deniedLogin returns the denied CIDR containing the payload's latest
+// login IP, or "" when it is allowed
+func deniedLogin(payload *LogPayload, nets []*net.IPNet) string {
+	ip := latestLoginIP(payload)
+	if ip == nil {
+		return ""
+	}
+	for _, ipNet := range nets {
+		if ipNet.Contains(ip) {
+			return ipNet.String()
+		}
+	}
+	return ""
+}
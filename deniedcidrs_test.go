@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestDeniedLogin(t *testing.T) {
+	nets, err := parseDeniedCIDRs("10.0.0.0/8, 2001:db8::/32")
+	if err != nil {
+		t.Fatal(err)
+	}
+	earlier := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	later := earlier.Add(time.Hour)
+	tests := []struct {
+		name   string
+		logins []Login
+		want   string
+	}{
+		{"no logins", nil, ""},
+		{"allowed", []Login{{Time: later, IP: "192.0.2.1"}}, ""},
+		{"denied ipv4", []Login{{Time: later, IP: "10.1.2.3"}}, "10.0.0.0/8"},
+		{"denied ipv6", []Login{{Time: later, IP: "2001:db8::1"}}, "2001:db8::/32"},
+		{"only the latest login counts", []Login{{Time: later, IP: "192.0.2.1"}, {Time: earlier, IP: "10.1.2.3"}}, ""},
+		{"latest login denied", []Login{{Time: earlier, IP: "192.0.2.1"}, {Time: later, IP: " 10.1.2.3 "}}, "10.0.0.0/8"},
+		{"unparsable ip", []Login{{Time: later, IP: "not an ip"}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := LogPayload{Meta: Metadata{Logins: tt.logins}}
+			if got := deniedLogin(&payload, nets); got != tt.want {
+				t.Errorf("denied by %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDeniedCIDRs(t *testing.T) {
+	for _, setting := range []string{"", " , ", "10.0.0.0", "10.0.0.0/33"} {
+		if _, err := parseDeniedCIDRs(setting); err == nil {
+			t.Errorf("parsed %q", setting)
+		}
+	}
+}
+
+func TestDeniedCIDRActions(t *testing.T) {
+	const denied = `{"user_id":1,"meta":{"logins":[{"ip":"10.0.0.1"}]}}`
+	tests := []struct {
+		action     string
+		wantStatus int
+		wantQueued int
+	}{
+		{deniedActionReject, http.StatusForbidden, 0},
+		{deniedActionDrop, http.StatusAccepted, 0},
+		{deniedActionFlag, http.StatusAccepted, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.action, func(t *testing.T) {
+			nets, err := parseDeniedCIDRs("10.0.0.0/8")
+			if err != nil {
+				t.Fatal(err)
+			}
+			prevNets, prevAction := deniedNets, deniedCIDRAction
+			deniedNets, deniedCIDRAction = nets, tt.action
+			defer func() { deniedNets, deniedCIDRAction = prevNets, prevAction }()
+
+			p := captureQueue(t)
+			rec, e := postLog(t, denied)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status %d %q, want %d", rec.Code, e.Error, tt.wantStatus)
+			}
+			if n := len(queued(p)); n != tt.wantQueued {
+				t.Errorf("enqueued %d payloads, want %d", n, tt.wantQueued)
+			}
+		})
+	}
+}
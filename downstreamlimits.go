@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+// Split reason reported on batch_splits_total
+const splitDownstreamLimits = "downstream_limits"
+
+// Destination recorded for dead-lettered records no request could carry
+const downstreamLimitsDestination = "downstream_limits"
+
+var (
+	// Limits the downstream declares per request; batches are split to fit
+	// before sending, 0 disables the respective check. Bytes are measured
+	// as the JSON encoding of the records, before compression.
+	downstreamMaxRecords = envInt("DOWNSTREAM_MAX_RECORDS", 0)
+	downstreamMaxBytes   = envInt("DOWNSTREAM_MAX_BYTES", 0)
+)
+
+// downstreamLimited reports whether any downstream limit is configured
+func downstreamLimited() bool {
+	return downstreamMaxRecords > 0 || downstreamMaxBytes > 0
+}
+
+// fitDownstreamLimits splits each chunk into consecutive sub-chunks within
+// the downstream's record and byte limits. A record exceeding the byte
+// limit on its own is dead-lettered when enabled, and otherwise sent alone.
+func fitDownstreamLimits(chunks [][]LogPayload) [][]LogPayload {
+	var fitted [][]LogPayload
+	for _, chunk := range chunks {
+		parts := splitForDownstream(chunk)
+		if len(parts) > 1 {
+			observeSplit(splitDownstreamLimits, parts)
+		}
+		fitted = append(fitted, parts...)
+	}
+	return fitted
+}
+
+func splitForDownstream(payloads []LogPayload) [][]LogPayload {
+	var parts [][]LogPayload
+	var current []LogPayload
+	currentBytes := 2 // enclosing brackets
+
+	for _, payload := range payloads {
+		n := encodedSize(&payload)
+		if downstreamMaxBytes > 0 && n+2 > downstreamMaxBytes {
+			if rejectOverLimit(payload, n) {
+				continue
+			}
+
+			// Send it alone after the records before it, keeping batch order
+			if len(current) > 0 {
+				parts = append(parts, current)
+				current, currentBytes = nil, 2
+			}
+			parts = append(parts, []LogPayload{payload})
+			continue
+		}
+
+		full := downstreamMaxRecords > 0 && len(current) >= downstreamMaxRecords
+		tooBig := downstreamMaxBytes > 0 && currentBytes+n > downstreamMaxBytes
+		if len(current) > 0 && (full || tooBig) {
+			parts = append(parts, current)
+			current, currentBytes = nil, 2
+		}
+		current = append(current, payload)
+		currentBytes += n
+	}
+	if len(current) > 0 {
+		parts = append(parts, current)
+	}
+	return parts
+}
+
+// encodedSize is payload's JSON encoding plus its separator
+func encodedSize(payload *LogPayload) int {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return payload.size + 1
+	}
+	return len(data) + 1
+}
+
+// rejectOverLimit dead-letters a record larger than DOWNSTREAM_MAX_BYTES,
+// reporting whether it did
+func rejectOverLimit(payload LogPayload, n int) bool {
+	logger.Warn("Record exceeds DOWNSTREAM_MAX_BYTES",
+		zap.Int64("user_id", payload.UserID),
+		zap.Int("record_bytes", n),
+		zap.Int("downstream_max_bytes", downstreamMaxBytes),
+		zap.Bool("dead_lettered", deadLetters != nil))
+
+	if deadLetters == nil {
+		return false
+	}
+
+	err := fmt.Errorf("record of %d bytes exceeds DOWNSTREAM_MAX_BYTES %d", n, downstreamMaxBytes)
+	deadLetterBatch(downstreamLimitsDestination, []LogPayload{payload}, 0, err)
+	audit.Record(&Batch{ID: newBatchID(), Payloads: []LogPayload{payload}}, downstreamLimitsDestination, auditDeadLettered, payload.enqueuedAt)
+	setDeliveryState([]LogPayload{payload}, deliveryDeadLettered)
+	if payload.ack != nil {
+		payload.ack <- err
+	}
+	return true
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitForDownstream(t *testing.T) {
+	small := LogPayload{UserID: 1}
+	large := LogPayload{UserID: 2, Title: strings.Repeat("x", 200)}
+	n := encodedSize(&small)
+
+	tests := []struct {
+		name        string
+		maxRecords  int
+		maxBytes    int
+		deadLetter  bool
+		payloads    []LogPayload
+		wantSizes   []int
+		wantDropped int
+	}{
+		{"within limits", 10, 0, false, []LogPayload{small, small}, []int{2}, 0},
+		{"record limit", 2, 0, false, []LogPayload{small, small, small, small, small}, []int{2, 2, 1}, 0},
+		{"byte limit", 0, 2 + 2*n, false, []LogPayload{small, small, small}, []int{2, 1}, 0},
+		{"both limits", 2, 2 + 3*n, false, []LogPayload{small, small, small}, []int{2, 1}, 0},
+		{"oversized record sent alone", 0, 2 + 2*n, false, []LogPayload{small, large, small}, []int{1, 1, 1}, 0},
+		{"oversized record dead-lettered", 0, 2 + 2*n, true, []LogPayload{small, large, small}, []int{2}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prevRecords, prevBytes := downstreamMaxRecords, downstreamMaxBytes
+			downstreamMaxRecords, downstreamMaxBytes = tt.maxRecords, tt.maxBytes
+			defer func() { downstreamMaxRecords, downstreamMaxBytes = prevRecords, prevBytes }()
+			var dir string
+			if tt.deadLetter {
+				dir = useDeadLetters(t)
+			}
+
+			var sizes []int
+			var order []int64
+			for _, part := range splitForDownstream(tt.payloads) {
+				sizes = append(sizes, len(part))
+				for _, payload := range part {
+					order = append(order, payload.UserID)
+				}
+			}
+			if !reflect.DeepEqual(sizes, tt.wantSizes) {
+				t.Errorf("split into %v, want %v", sizes, tt.wantSizes)
+			}
+			if want := sentUsers(tt.payloads, tt.wantDropped > 0); !reflect.DeepEqual(order, want) {
+				t.Errorf("records sent in order %v, want %v", order, want)
+			}
+			if tt.wantDropped > 0 {
+				if got := countLines(t, filepath.Join(dir, downstreamLimitsDestination+".ndjson")); got != tt.wantDropped {
+					t.Errorf("dead-lettered %d records, want %d", got, tt.wantDropped)
+				}
+			}
+		})
+	}
+}
+
+// sentUsers lists the users of payloads in order, without the oversized
+// user 2 when it was dead-lettered
+func sentUsers(payloads []LogPayload, dropped bool) []int64 {
+	var users []int64
+	for _, payload := range payloads {
+		if !dropped || payload.UserID != 2 {
+			users = append(users, payload.UserID)
+		}
+	}
+	return users
+}
+
+func TestBatchesFitDownstreamLimits(t *testing.T) {
+	prevRecords := downstreamMaxRecords
+	downstreamMaxRecords = 2
+	defer func() { downstreamMaxRecords = prevRecords }()
+
+	d := startDownstream(t, http.StatusOK, "")
+	startPipeline(t, 5, d.sink(formatJSON))
+	for i := 0; i < 5; i++ {
+		postLog(t, fmt.Sprintf(`{"user_id":%d}`, i))
+	}
+	eventually(t, "batch sent", func() bool { return len(d.Requests()) == 3 })
+
+	for _, req := range d.Requests() {
+		var payloads []LogPayload
+		if err := json.Unmarshal(req.body, &payloads); err != nil || len(payloads) > 2 {
+			t.Errorf("request carried %s, over the limit of 2 records", req.body)
+		}
+	}
+	if n := deliveredCount(t, d); n != 5 {
+		t.Errorf("delivered %d records, want 5", n)
+	}
+}
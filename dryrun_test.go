@@ -0,0 +1,30 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func TestDryRunNeverSends(t *testing.T) {
+	d := startDownstream(t, http.StatusOK, "")
+	prevDryRun, prevSinks := dryRun, sinks
+	dryRun, sinks = true, []Sink{d.sink(formatJSON)}
+	defer func() { dryRun, sinks = prevDryRun, prevSinks }()
+
+	logs := observeLogs(t)
+	batch := &Batch{ID: "b1", Payloads: []LogPayload{{UserID: 1, ack: make(chan error, 1)}}}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	sendBatch(&wg, batch)
+
+	if n := len(d.Requests()); n != 0 {
+		t.Errorf("downstream received %d requests in dry-run mode", n)
+	}
+	if err := <-batch.Payloads[0].ack; err != nil {
+		t.Errorf("payload acked with %v, want success", err)
+	}
+	if n := logs.FilterMessage("Dry run, batch not sent").Len(); n != 1 {
+		t.Errorf("logged %d dry-run lines, want 1 per sink", n)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+)
+
+var (
+	encryptionKey = os.Getenv("ENCRYPTION_KEY")
+
+	// AES-GCM cipher for outgoing batches, nil when encryption is disabled
+	batchCipher cipher.AEAD
+)
+
+// newBatchCipher builds an AES-GCM cipher from a base64-encoded 16, 24 or 32 byte key
+func newBatchCipher(encodedKey string) (cipher.AEAD, error) {
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return nil, fmt.Errorf("decode key: %w", err)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptBatch seals data with a fresh random nonce. The output is the
+// nonce followed by the ciphertext, so the downstream opens it by splitting
+// off the first NonceSize() bytes.
+func encryptBatch(aead cipher.AEAD, data []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(data)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, data, nil), nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestNewBatchCipher(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		wantErr bool
+	}{
+		{"aes-128", base64.StdEncoding.EncodeToString(make([]byte, 16)), false},
+		{"aes-256", base64.StdEncoding.EncodeToString(make([]byte, 32)), false},
+		{"wrong length", base64.StdEncoding.EncodeToString(make([]byte, 10)), true},
+		{"not base64", "not base64!", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newBatchCipher(tt.key); (err != nil) != tt.wantErr {
+				t.Errorf("error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEncryptedBatchOpensDownstream(t *testing.T) {
+	aead, err := newBatchCipher(base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := batchCipher
+	batchCipher = aead
+	defer func() { batchCipher = prev }()
+
+	d := startDownstream(t, http.StatusOK, "")
+	batch := &Batch{Payloads: []LogPayload{{UserID: 1, Title: "secret"}}}
+	for i := 0; i < 2; i++ {
+		if _, err := d.sink(formatJSON).Send(context.Background(), batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	requests := d.Requests()
+	if bytes.Equal(requests[0].body, requests[1].body) {
+		t.Error("identical ciphertexts for two sends, nonce reused")
+	}
+	req := requests[0]
+	if req.header.Get("X-Encryption") != "aes-gcm" || req.header.Get("Content-Type") != "application/octet-stream" {
+		t.Errorf("headers %v", req.header)
+	}
+	if bytes.Contains(req.body, []byte("secret")) {
+		t.Fatal("payload sent in the clear")
+	}
+
+	n := aead.NonceSize()
+	plain, err := aead.Open(nil, req.body[:n], req.body[n:], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var payloads []LogPayload
+	if err := json.Unmarshal(plain, &payloads); err != nil || len(payloads) != 1 || payloads[0].Title != "secret" {
+		t.Errorf("decrypted %s", plain)
+	}
+}
+
+func TestEncryptedBatchCompressedBeforeEncryption(t *testing.T) {
+	aead, err := newBatchCipher(base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := batchCipher
+	batchCipher = aead
+	defer func() { batchCipher = prev }()
+
+	d := startDownstream(t, http.StatusOK, "")
+	s := d.sink(formatJSON)
+	s.encoding = encodingGzip
+	if _, err := s.Send(context.Background(), &Batch{Payloads: []LogPayload{{UserID: 1, Title: "secret"}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	req := d.Requests()[0]
+	if got := req.header.Get("Content-Encoding"); got != "" {
+		t.Errorf("Content-Encoding %q on a ciphertext body", got)
+	}
+	if got := req.header.Get("X-Encryption-Content-Encoding"); got != "gzip" {
+		t.Errorf("X-Encryption-Content-Encoding %q, want gzip", got)
+	}
+
+	n := aead.NonceSize()
+	compressed, err := aead.Open(nil, req.body[:n], req.body[n:], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatalf("decrypted body isn't gzip: %v", err)
+	}
+	plain, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var payloads []LogPayload
+	if err := json.Unmarshal(plain, &payloads); err != nil || len(payloads) != 1 || payloads[0].Title != "secret" {
+		t.Errorf("decoded body %s", plain)
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Policies for payloads whose enrichment lookup fails
+const (
+	enrichFailureProceed = "proceed"
+	enrichFailureDrop    = "drop"
+)
+
+// Cap on a lookup response attached to a payload
+const maxEnrichmentBytes = 64 << 10
+
+var (
+	// Lookup endpoint for per-user enrichment; {user_id} is replaced with the
+	// payload's user, otherwise it is sent as a user_id query parameter
+	enrichmentURL = envString("ENRICHMENT_URL", "")
+
+	enrichmentTimeout       = envDuration("ENRICHMENT_TIMEOUT", 500*time.Millisecond)
+	enrichmentCacheTTL      = envDuration("ENRICHMENT_CACHE_TTL", 5*time.Minute)
+	enrichmentCacheMaxUsers = envInt("ENRICHMENT_CACHE_MAX_USERS", 10000)
+	enrichmentFailurePolicy = envString("ENRICHMENT_FAILURE_POLICY", enrichFailureProceed)
+
+	// Lookup client and cache, nil when ENRICHMENT_URL is unset
+	enricher *enrichmentLookup
+)
+
+// validEnrichmentFailurePolicy reports whether policy is a supported ENRICHMENT_FAILURE_POLICY
+func validEnrichmentFailurePolicy(policy string) bool {
+	return policy == enrichFailureProceed || policy == enrichFailureDrop
+}
+
+// enrichment is one user's cached lookup result
+type enrichment struct {
+	userID  int64
+	value   json.RawMessage
+	expires time.Time
+}
+
+// enrichmentLookup fetches per-user enrichment from an endpoint, caching
+// results for ttl for at most maxUsers users, least recently used evicted first
+type enrichmentLookup struct {
+	endpoint string
+	timeout  time.Duration
+	ttl      time.Duration
+	maxUsers int
+	client   *http.Client
+
+	mu     sync.Mutex
+	lru    *list.List // of *enrichment, most recently used first
+	byUser map[int64]*list.Element
+}
+
+func newEnrichmentLookup(endpoint string, timeout, ttl time.Duration, maxUsers int, client *http.Client) *enrichmentLookup {
+	if maxUsers < 1 {
+		maxUsers = 1
+	}
+	return &enrichmentLookup{
+		endpoint: endpoint,
+		timeout:  timeout,
+		ttl:      ttl,
+		maxUsers: maxUsers,
+		client:   client,
+		lru:      list.New(),
+		byUser:   make(map[int64]*list.Element),
+	}
+}
+
+// Enrich attaches the user's enrichment to payload, from the cache when
+// fresh and from the endpoint otherwise
+func (e *enrichmentLookup) Enrich(ctx context.Context, payload *LogPayload) error {
+	now := time.Now()
+	if value, ok := e.cached(payload.UserID, now); ok {
+		payload.Enrichment = value
+		return nil
+	}
+
+	value, err := e.fetch(ctx, payload.UserID)
+	if err != nil {
+		return fmt.Errorf("enrichment lookup for user %d: %w", payload.UserID, err)
+	}
+	e.store(payload.UserID, value, now)
+	payload.Enrichment = value
+	return nil
+}
+
+// cached returns the user's unexpired enrichment
+func (e *enrichmentLookup) cached(userID int64, now time.Time) (json.RawMessage, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	el, ok := e.byUser[userID]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*enrichment)
+	if !now.Before(entry.expires) {
+		delete(e.byUser, userID)
+		e.lru.Remove(el)
+		return nil, false
+	}
+	e.lru.MoveToFront(el)
+	return entry.value, true
+}
+
+// store caches value for the user, evicting the least recently used user when full
+func (e *enrichmentLookup) store(userID int64, value json.RawMessage, now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	expires := now.Add(e.ttl)
+	if el, ok := e.byUser[userID]; ok {
+		e.lru.MoveToFront(el)
+		entry := el.Value.(*enrichment)
+		entry.value, entry.expires = value, expires
+		return
+	}
+
+	if e.lru.Len() >= e.maxUsers {
+		oldest := e.lru.Back()
+		delete(e.byUser, oldest.Value.(*enrichment).userID)
+		e.lru.Remove(oldest)
+	}
+	e.byUser[userID] = e.lru.PushFront(&enrichment{userID: userID, value: value, expires: expires})
+}
+
+// lookupURL is the endpoint URL for userID
+func (e *enrichmentLookup) lookupURL(userID int64) string {
+	id := strconv.FormatInt(userID, 10)
+	if strings.Contains(e.endpoint, "{user_id}") {
+		return strings.ReplaceAll(e.endpoint, "{user_id}", id)
+	}
+	sep := "?"
+	if strings.Contains(e.endpoint, "?") {
+		sep = "&"
+	}
+	return e.endpoint + sep + "user_id=" + id
+}
+
+func (e *enrichmentLookup) fetch(ctx context.Context, userID int64) (json.RawMessage, error) {
+	ctx, cancel := context.WithTimeout(ctx, e.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, e.lookupURL(userID), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("lookup returned status code %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxEnrichmentBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxEnrichmentBytes {
+		return nil, fmt.Errorf("lookup response exceeds %d bytes", maxEnrichmentBytes)
+	}
+	if !json.Valid(body) {
+		return nil, fmt.Errorf("lookup returned invalid JSON")
+	}
+	return json.RawMessage(body), nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// startLookup serves {"tier":"gold"} for every user with status, counting lookups
+func startLookup(t *testing.T, status int) (*httptest.Server, *int32) {
+	t.Helper()
+	var lookups int32
+	lookup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&lookups, 1)
+		w.WriteHeader(status)
+		fmt.Fprintf(w, `{"tier":"gold","user":%q}`, r.URL.Query().Get("user_id"))
+	}))
+	t.Cleanup(lookup.Close)
+	return lookup, &lookups
+}
+
+func TestEnrichmentLookupURL(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		want     string
+	}{
+		{"http://lookup/users/{user_id}", "http://lookup/users/42"},
+		{"http://lookup/users", "http://lookup/users?user_id=42"},
+		{"http://lookup/users?fields=tier", "http://lookup/users?fields=tier&user_id=42"},
+	}
+	for _, tt := range tests {
+		e := newEnrichmentLookup(tt.endpoint, time.Second, time.Minute, 10, http.DefaultClient)
+		if got := e.lookupURL(42); got != tt.want {
+			t.Errorf("lookupURL for %s = %s, want %s", tt.endpoint, got, tt.want)
+		}
+	}
+}
+
+func TestEnrichmentCache(t *testing.T) {
+	tests := []struct {
+		name        string
+		ttl         time.Duration
+		users       []int64
+		wantLookups int32
+	}{
+		{"cached per user", time.Minute, []int64{1, 1, 2, 1}, 2},
+		{"expired immediately", 0, []int64{1, 1}, 2},
+		{"least recently used evicted", time.Minute, []int64{1, 2, 3, 1}, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lookup, lookups := startLookup(t, http.StatusOK)
+			e := newEnrichmentLookup(lookup.URL, time.Second, tt.ttl, 2, lookup.Client())
+			for _, userID := range tt.users {
+				payload := LogPayload{UserID: userID}
+				if err := e.Enrich(context.Background(), &payload); err != nil {
+					t.Fatal(err)
+				}
+				if want := fmt.Sprintf(`{"tier":"gold","user":"%d"}`, userID); string(payload.Enrichment) != want {
+					t.Errorf("enrichment %s, want %s", payload.Enrichment, want)
+				}
+			}
+			if got := atomic.LoadInt32(lookups); got != tt.wantLookups {
+				t.Errorf("%d lookups, want %d", got, tt.wantLookups)
+			}
+		})
+	}
+}
+
+func TestEnrichmentFailurePolicy(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		policy     string
+		wantQueued int
+		wantEnrich bool
+	}{
+		{"enriched", http.StatusOK, enrichFailureDrop, 1, true},
+		{"failure proceeds", http.StatusInternalServerError, enrichFailureProceed, 1, false},
+		{"failure drops", http.StatusInternalServerError, enrichFailureDrop, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lookup, _ := startLookup(t, tt.status)
+			prevEnricher, prevPolicy := enricher, enrichmentFailurePolicy
+			enricher = newEnrichmentLookup(lookup.URL, time.Second, time.Minute, 10, lookup.Client())
+			enrichmentFailurePolicy = tt.policy
+			defer func() { enricher, enrichmentFailurePolicy = prevEnricher, prevPolicy }()
+
+			p := captureQueue(t)
+			if rec, _ := postLog(t, `{"user_id":1}`); rec.Code != http.StatusAccepted {
+				t.Fatalf("status %d, want 202", rec.Code)
+			}
+			got := queued(p)
+			if len(got) != tt.wantQueued {
+				t.Fatalf("enqueued %d payloads, want %d", len(got), tt.wantQueued)
+			}
+			if len(got) > 0 && (got[0].Enrichment != nil) != tt.wantEnrich {
+				t.Errorf("enrichment %s, want enriched %v", got[0].Enrichment, tt.wantEnrich)
+			}
+		})
+	}
+}
+
+func TestClientEnrichmentIgnored(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int // lookup status, 0 for no ENRICHMENT_URL
+		want   string
+	}{
+		{"no lookup", 0, ""},
+		{"lookup overwrites", http.StatusOK, `{"tier":"gold","user":"1"}`},
+		{"failed lookup proceeds", http.StatusInternalServerError, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prevEnricher, prevPolicy := enricher, enrichmentFailurePolicy
+			enricher, enrichmentFailurePolicy = nil, enrichFailureProceed
+			defer func() { enricher, enrichmentFailurePolicy = prevEnricher, prevPolicy }()
+			if tt.status != 0 {
+				lookup, _ := startLookup(t, tt.status)
+				enricher = newEnrichmentLookup(lookup.URL, time.Second, time.Minute, 10, lookup.Client())
+			}
+
+			p := captureQueue(t)
+			if rec, _ := postLog(t, `{"user_id":1,"enrichment":{"tier":"platinum"}}`); rec.Code != http.StatusAccepted {
+				t.Fatalf("status %d, want 202", rec.Code)
+			}
+			got := queued(p)
+			if len(got) != 1 {
+				t.Fatalf("enqueued %d payloads, want 1", len(got))
+			}
+			if string(got[0].Enrichment) != tt.want {
+				t.Errorf("enrichment %s, want %q", got[0].Enrichment, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// EXPECT_CONTINUE modes
+const (
+	expectContinueAccept = "accept"
+	expectContinueReject = "reject"
+)
+
+var (
+	// Largest /log request body read, 0 for unlimited
+	maxBodyBytes = envInt("MAX_BODY_BYTES", 0)
+
+	// Whether Expect: 100-continue requests passing the pre-check get a 100 Continue or a 417
+	expectContinueMode = envString("EXPECT_CONTINUE", expectContinueAccept)
+)
+
+// validExpectContinueMode reports whether mode is a supported EXPECT_CONTINUE
+func validExpectContinueMode(mode string) bool {
+	return mode == expectContinueAccept || mode == expectContinueReject
+}
+
+// expectContinueRejection returns why an Expect: 100-continue request
+// should be refused before its body is sent, or "" to let it continue.
+// net/http sends the 100 Continue on the handler's first body read, so
+// refusing here saves the client from uploading the body at all.
+func expectContinueRejection(r *http.Request, mode string, maxBody int) string {
+	if !strings.EqualFold(r.Header.Get("Expect"), "100-continue") {
+		return ""
+	}
+	if mode == expectContinueReject {
+		return "100-continue is not accepted"
+	}
+	if maxBody > 0 && r.ContentLength > int64(maxBody) {
+		return fmt.Sprintf("declared Content-Length %d exceeds %d bytes", r.ContentLength, maxBody)
+	}
+	return ""
+}
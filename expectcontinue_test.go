@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestExpectContinue(t *testing.T) {
+	const body = `{"user_id":1}`
+	tests := []struct {
+		name       string
+		mode       string
+		maxBody    int
+		wantStatus int
+	}{
+		{"continued", expectContinueAccept, 0, http.StatusAccepted},
+		{"within max body", expectContinueAccept, 100, http.StatusAccepted},
+		{"declared length over max body", expectContinueAccept, 5, http.StatusExpectationFailed},
+		{"reject mode", expectContinueReject, 0, http.StatusExpectationFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prevMode, prevMax := expectContinueMode, maxBodyBytes
+			expectContinueMode, maxBodyBytes = tt.mode, tt.maxBody
+			defer func() { expectContinueMode, maxBodyBytes = prevMode, prevMax }()
+			p := captureQueue(t)
+
+			conn, err := net.Dial("tcp", startLogServer(t))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+			fmt.Fprintf(conn, "POST /log HTTP/1.1\r\nHost: test\r\nContent-Length: %d\r\nExpect: 100-continue\r\n\r\n", len(body))
+
+			// The body is only sent once the server asks for it
+			br := bufio.NewReader(conn)
+			resp, err := http.ReadResponse(br, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode == http.StatusContinue {
+				fmt.Fprint(conn, body)
+				if resp, err = http.ReadResponse(br, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			wantQueued := 0
+			if tt.wantStatus == http.StatusAccepted {
+				wantQueued = 1
+			}
+			if n := len(queued(p)); n != wantQueued {
+				t.Errorf("enqueued %d payloads, want %d", n, wantQueued)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+)
+
+var (
+	// JSON object every 2xx downstream response body must contain, e.g. {"status":"ok"}
+	expectedResponse = os.Getenv("EXPECTED_RESPONSE")
+
+	// Parsed at startup, nil when EXPECTED_RESPONSE is unset
+	expectedResponseBody map[string]interface{}
+)
+
+// Bound on response body bytes read when checking EXPECTED_RESPONSE or PER_RECORD_RESULTS
+const maxInspectedResponseBytes = 64 << 10
+
+// parseExpectedResponse parses the EXPECTED_RESPONSE object
+func parseExpectedResponse(s string) (map[string]interface{}, error) {
+	var expected map[string]interface{}
+	if err := json.Unmarshal([]byte(s), &expected); err != nil {
+		return nil, err
+	}
+	return expected, nil
+}
+
+// responseMatches reports whether body is JSON containing every field of expected
+func responseMatches(body []byte, expected map[string]interface{}) bool {
+	var actual interface{}
+	if err := json.Unmarshal(body, &actual); err != nil {
+		return false
+	}
+	return containsJSON(actual, expected)
+}
+
+// containsJSON reports whether actual contains expected: objects match when
+// actual has every expected key with a matching value, anything else must be equal
+func containsJSON(actual, expected interface{}) bool {
+	expectedObj, ok := expected.(map[string]interface{})
+	if !ok {
+		return reflect.DeepEqual(actual, expected)
+	}
+
+	actualObj, ok := actual.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	for key, want := range expectedObj {
+		got, ok := actualObj[key]
+		if !ok || !containsJSON(got, want) {
+			return false
+		}
+	}
+	return true
+}
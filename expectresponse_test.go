@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestResponseMatches(t *testing.T) {
+	expected, err := parseExpectedResponse(`{"status":"ok","result":{"accepted":true}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		body string
+		want bool
+	}{
+		{"exact", `{"status":"ok","result":{"accepted":true}}`, true},
+		{"extra fields", `{"status":"ok","id":4,"result":{"accepted":true,"n":2}}`, true},
+		{"wrong value", `{"status":"error","result":{"accepted":true}}`, false},
+		{"missing nested field", `{"status":"ok","result":{}}`, false},
+		{"nested not an object", `{"status":"ok","result":true}`, false},
+		{"not json", `ok`, false},
+		{"empty", ``, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := responseMatches([]byte(tt.body), expected); got != tt.want {
+				t.Errorf("matches %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseExpectedResponseRequiresObject(t *testing.T) {
+	for _, s := range []string{`[1]`, `"ok"`, `{`} {
+		if _, err := parseExpectedResponse(s); err == nil {
+			t.Errorf("parsed %s as an expected response", s)
+		}
+	}
+}
+
+func TestHTTPSinkChecksExpectedResponse(t *testing.T) {
+	prev := expectedResponseBody
+	expectedResponseBody = map[string]interface{}{"status": "ok"}
+	defer func() { expectedResponseBody = prev }()
+
+	tests := []struct {
+		name    string
+		body    string
+		wantErr bool
+	}{
+		{"expected body", `{"status":"ok"}`, false},
+		{"unexpected body", `{"status":"queued"}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := startDownstream(t, http.StatusOK, tt.body)
+			status, err := d.sink(formatJSON).Send(context.Background(), &Batch{Payloads: []LogPayload{{UserID: 1}}})
+			if status != http.StatusOK || (err != nil) != tt.wantErr {
+				t.Errorf("Send = %d, %v, want 200, error %v", status, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// fileSink appends encoded batches to a local file, e.g. for archival
+type fileSink struct {
+	path   string
+	format string
+
+	mu sync.Mutex
+}
+
+func (s *fileSink) Destination() string {
+	return "file-" + s.path
+}
+
+func (s *fileSink) Send(ctx context.Context, batch *Batch) (int, error) {
+	data, err := encodeBatch(batch.Payloads, s.format)
+	if err != nil {
+		return 0, err
+	}
+	if s.format == formatJSON {
+		data = append(data, '\n')
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return 0, err
+	}
+	if err := f.Close(); err != nil {
+		return 0, err
+	}
+
+	// Report success like an HTTP sink, so status metrics don't count it as "none"
+	return http.StatusOK, nil
+}
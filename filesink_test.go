@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileSinkSend(t *testing.T) {
+	tests := []struct {
+		format    string
+		wantLines int
+	}{
+		{formatJSON, 2},
+		{formatNDJSON, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "archive")
+			s := &fileSink{path: path, format: tt.format}
+
+			for i := 0; i < 2; i++ {
+				batch := &Batch{Payloads: []LogPayload{{UserID: 1}, {UserID: 2}}}
+				status, err := s.Send(context.Background(), batch)
+				if err != nil {
+					t.Fatalf("Send: %v", err)
+				}
+				if status != http.StatusOK {
+					t.Errorf("Send status = %d, want %d", status, http.StatusOK)
+				}
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+			if len(lines) != tt.wantLines {
+				t.Fatalf("got %d lines, want %d:\n%s", len(lines), tt.wantLines, data)
+			}
+			for _, line := range lines {
+				if !json.Valid([]byte(line)) {
+					t.Errorf("line is not JSON: %s", line)
+				}
+			}
+		})
+	}
+}
+
+func TestFileSinkSendFailure(t *testing.T) {
+	s := &fileSink{path: filepath.Join(t.TempDir(), "missing", "archive"), format: formatNDJSON}
+	status, err := s.Send(context.Background(), &Batch{Payloads: []LogPayload{{UserID: 1}}})
+	if err == nil {
+		t.Fatal("Send into a missing directory succeeded")
+	}
+	if status != 0 {
+		t.Errorf("status = %d, want 0", status)
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import "math"
+
+// Reject totals that almost always indicate a client bug
+var financeStrict = envBool("FINANCE_STRICT", false)
+
+// checkFinanceTotal returns an error code and message for a total that is
+// NaN, infinite, zero or negative, or "" when the total is acceptable.
+// encoding/json already refuses NaN and Infinity literals, so the first two
+// only guard against payloads built by other decoders.
+func checkFinanceTotal(total float64) (string, string) {
+	switch {
+	case math.IsNaN(total):
+		return "total_nan", "total must be a number"
+	case math.IsInf(total, 0):
+		return "total_infinite", "total must be finite"
+	case total == 0:
+		return "total_zero", "total must not be zero"
+	case total < 0:
+		return "total_negative", "total must not be negative"
+	}
+	return "", ""
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"testing"
+)
+
+func TestCheckFinanceTotal(t *testing.T) {
+	tests := []struct {
+		total float64
+		want  string
+	}{
+		{12.5, ""},
+		{0, "total_zero"},
+		{-1, "total_negative"},
+		{math.NaN(), "total_nan"},
+		{math.Inf(1), "total_infinite"},
+	}
+	for _, tt := range tests {
+		if code, _ := checkFinanceTotal(tt.total); code != tt.want {
+			t.Errorf("checkFinanceTotal(%v) = %q, want %q", tt.total, code, tt.want)
+		}
+	}
+}
+
+func TestFinanceStrictHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		strict     bool
+		body       string
+		wantStatus int
+		wantCode   string
+	}{
+		{"strict accepts positive", true, `{"user_id":1,"total":9.99}`, http.StatusAccepted, ""},
+		{"strict rejects zero", true, `{"user_id":1,"total":0}`, http.StatusUnprocessableEntity, "total_zero"},
+		{"strict rejects missing total", true, `{"user_id":1}`, http.StatusUnprocessableEntity, "total_zero"},
+		{"strict rejects negative", true, `{"user_id":1,"total":-5}`, http.StatusUnprocessableEntity, "total_negative"},
+		{"lenient accepts zero", false, `{"user_id":1,"total":0}`, http.StatusAccepted, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prev := financeStrict
+			financeStrict = tt.strict
+			defer func() { financeStrict = prev }()
+			captureQueue(t)
+
+			rec, e := postLog(t, tt.body)
+			if rec.Code != tt.wantStatus || e.Error != tt.wantCode {
+				t.Errorf("got %d %q, want %d %q", rec.Code, e.Error, tt.wantStatus, tt.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Batch encodings
+const (
+	// A single JSON array of payloads
+	formatJSON = "json"
+
+	// One JSON payload per line
+	formatNDJSON = "ndjson"
+
+	// A JSON envelope storing identical meta blocks once, see metaTableEnvelope
+	formatMetaTable = "meta_table"
+)
+
+// sinkFormat validates a configured format, defaulting to def when empty
+func sinkFormat(format, def string) (string, error) {
+	switch format {
+	case "":
+		return def, nil
+	case formatJSON, formatNDJSON, formatMetaTable:
+		return format, nil
+	}
+	return "", fmt.Errorf("unknown format %q", format)
+}
+
+// encodeBatch serializes payloads in the given format
+func encodeBatch(payloads []LogPayload, format string) ([]byte, error) {
+	if format == formatMetaTable {
+		return encodeMetaTable(payloads)
+	}
+	if format != formatNDJSON {
+		return json.Marshal(payloads)
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, payload := range payloads {
+		if err := enc.Encode(payload); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// formatContentType is the Content-Type for a batch format
+func formatContentType(format string) string {
+	switch format {
+	case formatNDJSON:
+		return "application/x-ndjson"
+	case formatMetaTable:
+		return metaTableContentType
+	}
+	return "application/json"
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// decodeBatch reverses encodeBatch, rebuilding meta from the table for meta_table
+func decodeBatch(t *testing.T, data []byte, format string) []LogPayload {
+	t.Helper()
+	var payloads []LogPayload
+	switch format {
+	case formatJSON:
+		if err := json.Unmarshal(data, &payloads); err != nil {
+			t.Fatal(err)
+		}
+	case formatNDJSON:
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			var payload LogPayload
+			if err := json.Unmarshal(scanner.Bytes(), &payload); err != nil {
+				t.Fatal(err)
+			}
+			payloads = append(payloads, payload)
+		}
+	case formatMetaTable:
+		var env metaTableEnvelope
+		if err := json.Unmarshal(data, &env); err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range env.Payloads {
+			payloads = append(payloads, LogPayload{UserID: p.UserID, Total: p.Total, Title: p.Title,
+				Meta: env.Meta[p.MetaRef], Completed: p.Completed})
+		}
+	}
+	return payloads
+}
+
+func TestEncodeBatchRoundTrip(t *testing.T) {
+	login := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	shared := Metadata{Logins: []Login{{Time: login, IP: "10.0.0.1"}}}
+	payloads := []LogPayload{
+		{UserID: 1, Total: 1.5, Title: "a", Meta: shared, Completed: true},
+		{UserID: 1, Total: 2, Title: "b", Meta: shared},
+		{UserID: 2, Title: "c", Meta: Metadata{Logins: []Login{{Time: login, IP: "10.0.0.2"}}}},
+	}
+
+	sizes := make(map[string]int)
+	for _, format := range []string{formatJSON, formatNDJSON, formatMetaTable} {
+		t.Run(format, func(t *testing.T) {
+			data, err := encodeBatch(payloads, format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sizes[format] = len(data)
+			if got := decodeBatch(t, data, format); !reflect.DeepEqual(got, payloads) {
+				t.Errorf("decoded %+v, want %+v", got, payloads)
+			}
+		})
+	}
+	if sizes[formatMetaTable] >= sizes[formatJSON] {
+		t.Errorf("meta table of %d bytes not smaller than %d bytes of json", sizes[formatMetaTable], sizes[formatJSON])
+	}
+}
+
+func TestSinkFormat(t *testing.T) {
+	tests := []struct {
+		format          string
+		want            string
+		wantContentType string
+		wantErr         bool
+	}{
+		{"", formatNDJSON, "application/x-ndjson", false},
+		{formatJSON, formatJSON, "application/json", false},
+		{formatMetaTable, formatMetaTable, metaTableContentType, false},
+		{"xml", "", "", true},
+	}
+	for _, tt := range tests {
+		got, err := sinkFormat(tt.format, formatNDJSON)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("sinkFormat(%q) = %q, %v, want %q", tt.format, got, err, tt.want)
+			continue
+		}
+		if err == nil && formatContentType(got) != tt.wantContentType {
+			t.Errorf("content type for %q is %q, want %q", got, formatContentType(got), tt.wantContentType)
+		}
+	}
+}
+
+func TestHTTPSinkSendsMetaTable(t *testing.T) {
+	d := startDownstream(t, http.StatusOK, "")
+	payloads := []LogPayload{{UserID: 1}, {UserID: 2}}
+	if _, err := d.sink(formatMetaTable).Send(context.Background(), &Batch{Payloads: payloads}); err != nil {
+		t.Fatal(err)
+	}
+
+	req := d.Requests()[0]
+	if got := req.header.Get("Content-Type"); got != metaTableContentType {
+		t.Errorf("Content-Type %q, want %q", got, metaTableContentType)
+	}
+	if got := decodeBatch(t, req.body, formatMetaTable); !reflect.DeepEqual(got, payloads) {
+		t.Errorf("downstream received %+v", got)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/status"
+)
+
+// Collector method called when a grpc sink configures none
+const defaultGRPCMethod = "/collector.v1.Ingest/Send"
+
+// Deadline for each collector call, 0 for none
+var grpcTimeout = envDuration("GRPC_TIMEOUT", 30*time.Second)
+
+// jsonCodec marshals gRPC messages as JSON (content-subtype "json"), so
+// the collector API needs no generated protobuf code on this side
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+func (jsonCodec) Name() string                               { return "json" }
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+// grpcBatchRequest is the collector's ingest request
+type grpcBatchRequest struct {
+	BatchID  string       `json:"batch_id"`
+	Sequence uint64       `json:"sequence,omitempty"`
+	Records  []LogPayload `json:"records"`
+}
+
+// grpcBatchResponse is the collector's ingest response
+type grpcBatchResponse struct {
+	Accepted int `json:"accepted"`
+}
+
+// grpcSink sends each batch as one unary call to a gRPC collector
+type grpcSink struct {
+	conn    *grpc.ClientConn
+	target  string
+	method  string
+	timeout time.Duration
+}
+
+// newGRPCSink connects lazily to target, using TLS when useTLS is set and
+// bounding each call by GRPC_TIMEOUT
+func newGRPCSink(target, method string, useTLS bool) (*grpcSink, error) {
+	creds := insecure.NewCredentials()
+	if useTLS {
+		creds = credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12})
+	}
+
+	conn, err := grpc.Dial(target, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, err
+	}
+	if method == "" {
+		method = defaultGRPCMethod
+	}
+	return &grpcSink{conn: conn, target: target, method: method, timeout: grpcTimeout}, nil
+}
+
+func (s *grpcSink) Destination() string {
+	return "grpc-" + s.target
+}
+
+// Send makes one call per attempt, so a hung collector fails the attempt
+// with DeadlineExceeded and the batch is retried or dead-lettered
+func (s *grpcSink) Send(ctx context.Context, batch *Batch) (int, error) {
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+
+	req := grpcBatchRequest{BatchID: batch.ID, Sequence: batch.Sequence, Records: batch.Payloads}
+	var resp grpcBatchResponse
+	if err := s.conn.Invoke(ctx, s.method, &req, &resp, grpc.CallContentSubtype("json")); err != nil {
+		return grpcHTTPStatus(status.Code(err)), err
+	}
+	return http.StatusOK, nil
+}
+
+// permanentGRPCError reports whether err is a gRPC status the collector
+// would return again for the same batch, so retrying can't help
+func permanentGRPCError(err error) bool {
+	switch status.Code(err) {
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange,
+		codes.Unauthenticated, codes.PermissionDenied, codes.NotFound,
+		codes.AlreadyExists, codes.Unimplemented:
+		return true
+	}
+	return false
+}
+
+// grpcHTTPStatus maps a gRPC status code onto the HTTP status the retry
+// and dead-letter logic understands. Unavailable means the collector
+// couldn't be reached, reported as 0 like a failed HTTP connection.
+func grpcHTTPStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Unavailable:
+		return 0
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.Canceled:
+		return 499
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// startCollector serves a gRPC collector answering every call with code,
+// counting the calls it receives
+func startCollector(t *testing.T, code codes.Code) (string, *int32) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var calls int32
+	server := grpc.NewServer(grpc.UnknownServiceHandler(func(srv interface{}, stream grpc.ServerStream) error {
+		atomic.AddInt32(&calls, 1)
+		var req grpcBatchRequest
+		if err := stream.RecvMsg(&req); err != nil {
+			return err
+		}
+		if code != codes.OK {
+			return status.Error(code, "collector says no")
+		}
+		return stream.SendMsg(&grpcBatchResponse{Accepted: len(req.Records)})
+	}))
+	go server.Serve(ln)
+	t.Cleanup(server.Stop)
+	return ln.Addr().String(), &calls
+}
+
+func TestGRPCSinkSend(t *testing.T) {
+	tests := []struct {
+		code       codes.Code
+		wantStatus int
+	}{
+		{codes.OK, http.StatusOK},
+		{codes.InvalidArgument, http.StatusBadRequest},
+		{codes.ResourceExhausted, http.StatusTooManyRequests},
+		{codes.Internal, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code.String(), func(t *testing.T) {
+			addr, _ := startCollector(t, tt.code)
+			s, err := newGRPCSink(addr, "", false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.conn.Close()
+
+			got, err := s.Send(context.Background(), &Batch{ID: "b1", Payloads: []LogPayload{{UserID: 1}}})
+			if got != tt.wantStatus || (err != nil) != (tt.code != codes.OK) {
+				t.Errorf("Send = %d, %v, want %d", got, err, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestDeliverDoesNotRetryPermanentGRPCErrors(t *testing.T) {
+	pool, err := newDeadLetterPool(t.TempDir(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := deadLetters
+	deadLetters = pool
+	defer func() {
+		pool.Close()
+		deadLetters = prev
+	}()
+
+	for _, code := range []codes.Code{codes.InvalidArgument, codes.PermissionDenied, codes.Unimplemented} {
+		t.Run(code.String(), func(t *testing.T) {
+			addr, calls := startCollector(t, code)
+			s, err := newGRPCSink(addr, "", false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.conn.Close()
+
+			if ok, _ := deliver(s, &Batch{ID: "b1", Payloads: []LogPayload{{UserID: 1}}}); ok {
+				t.Fatal("delivered despite a permanent error")
+			}
+			if n := atomic.LoadInt32(calls); n != 1 {
+				t.Errorf("collector called %d times, want 1", n)
+			}
+		})
+	}
+}
+
+func TestPermanentGRPCError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{status.Error(codes.InvalidArgument, ""), true},
+		{status.Error(codes.Unauthenticated, ""), true},
+		{status.Error(codes.Unavailable, ""), false},
+		{status.Error(codes.DeadlineExceeded, ""), false},
+		{status.Error(codes.ResourceExhausted, ""), false},
+		{errCircuitOpen, false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := permanentGRPCError(tt.err); got != tt.want {
+			t.Errorf("permanentGRPCError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestDeliverRetriesHungGRPCCollector(t *testing.T) {
+	useDeadLetters(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var calls int32
+	server := grpc.NewServer(grpc.UnknownServiceHandler(func(srv interface{}, stream grpc.ServerStream) error {
+		atomic.AddInt32(&calls, 1)
+		<-stream.Context().Done()
+		return stream.Context().Err()
+	}))
+	go server.Serve(ln)
+	defer server.Stop()
+
+	s, err := newGRPCSink(ln.Addr().String(), "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.conn.Close()
+	s.timeout = 50 * time.Millisecond
+
+	got, err := s.Send(context.Background(), &Batch{ID: "b1", Payloads: []LogPayload{{UserID: 1}}})
+	if status.Code(err) != codes.DeadlineExceeded || got != http.StatusGatewayTimeout {
+		t.Fatalf("Send = %d, %v, want 504 DeadlineExceeded", got, err)
+	}
+
+	atomic.StoreInt32(&calls, 0)
+	if ok, _ := deliver(s, &Batch{ID: "b2", Payloads: []LogPayload{{UserID: 1}}}); ok {
+		t.Fatal("delivered to a hung collector")
+	}
+	if n := atomic.LoadInt32(&calls); n != 3 {
+		t.Errorf("collector called %d times, want 3", n)
+	}
+}
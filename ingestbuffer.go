@@ -0,0 +1,112 @@
+package main
+
+import (
+	"runtime"
+	"sync"
+	"time"
+)
+
+var (
+	// Payloads accumulated per shard before one guarded channel send, 0 disables buffering
+	ingestBufferSize   = envInt("INGEST_BUFFER_SIZE", 0)
+	ingestBufferLinger = envDuration("INGEST_BUFFER_LINGER", 10*time.Millisecond)
+	ingestBufferShards = envInt("INGEST_BUFFER_SHARDS", runtime.GOMAXPROCS(0))
+)
+
+// ingestBuffer coalesces payloads from many handlers into fewer channel
+// sends. Payloads are spread across mutex-guarded shards by user, so a
+// user's payloads stay in order, and a shard is handed to the processor
+// in one send once it fills up or the linger interval elapses. Flush must
+// run before exit so buffered payloads are not lost.
+type ingestBuffer struct {
+	size int
+	out  chan<- []LogPayload
+
+	shards []ingestShard
+}
+
+// ingestShard is one independently locked buffer
+type ingestShard struct {
+	mu       sync.Mutex
+	payloads []LogPayload
+}
+
+func newIngestBuffer(size, shards int, out chan<- []LogPayload) *ingestBuffer {
+	if shards < 1 {
+		shards = 1
+	}
+	return &ingestBuffer{
+		size:   size,
+		out:    out,
+		shards: make([]ingestShard, shards),
+	}
+}
+
+// Add buffers payload, sending its shard to the processor when full
+func (b *ingestBuffer) Add(payload LogPayload) {
+	shard := &b.shards[shardFor(payload.UserID, len(b.shards))]
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	shard.payloads = append(shard.payloads, payload)
+	if len(shard.payloads) >= b.size {
+		b.send(shard)
+	}
+}
+
+// shardFor maps a user to one of n shards. It mixes the id with the
+// splitmix64 finalizer rather than reusing partitionFor's FNV hash, so the
+// users of one partition still spread across its shards.
+func shardFor(userID int64, n int) int {
+	x := uint64(userID)
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return int(x % uint64(n))
+}
+
+// Flush sends every non-empty shard to the processor
+func (b *ingestBuffer) Flush() {
+	for i := range b.shards {
+		shard := &b.shards[i]
+		shard.mu.Lock()
+		if len(shard.payloads) > 0 {
+			b.send(shard)
+		}
+		shard.mu.Unlock()
+	}
+}
+
+// Take removes and returns every buffered payload without sending it,
+// for recording what shutdown couldn't deliver
+func (b *ingestBuffer) Take() []LogPayload {
+	var payloads []LogPayload
+	for i := range b.shards {
+		shard := &b.shards[i]
+		shard.mu.Lock()
+		payloads = append(payloads, shard.payloads...)
+		shard.payloads = make([]LogPayload, 0, b.size)
+		shard.mu.Unlock()
+	}
+	return payloads
+}
+
+// Run flushes lingering payloads every interval
+func (b *ingestBuffer) Run(linger time.Duration) {
+	tick := time.NewTicker(linger)
+	defer tick.Stop()
+
+	for range tick.C {
+		b.Flush()
+	}
+}
+
+// send hands the shard's payloads to the processor. Callers hold shard.mu,
+// which keeps sends from a shard in order.
+func (b *ingestBuffer) send(shard *ingestShard) {
+	b.out <- shard.payloads
+	shard.payloads = make([]LogPayload, 0, b.size)
+}
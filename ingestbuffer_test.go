@@ -0,0 +1,125 @@
+package main
+
+import (
+	"runtime"
+	"sync/atomic"
+	"testing"
+)
+
+func TestIngestBufferKeepsUserOrder(t *testing.T) {
+	tests := []struct {
+		name   string
+		size   int
+		shards int
+		users  []int64
+	}{
+		{"one user", 3, 4, []int64{7}},
+		{"interleaved users", 2, 3, []int64{1, 2, 3, 4, 5}},
+		{"single shard", 5, 1, []int64{1, 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			const perUser = 50
+			out := make(chan []LogPayload, perUser*len(tt.users))
+			b := newIngestBuffer(tt.size, tt.shards, out)
+
+			for i := 0; i < perUser; i++ {
+				for _, user := range tt.users {
+					b.Add(LogPayload{UserID: user, Total: float64(i)})
+				}
+			}
+			b.Flush()
+			close(out)
+
+			next := make(map[int64]int)
+			for payloads := range out {
+				for _, payload := range payloads {
+					if got, want := int(payload.Total), next[payload.UserID]; got != want {
+						t.Fatalf("user %d: got payload %d, want %d", payload.UserID, got, want)
+					}
+					next[payload.UserID]++
+				}
+			}
+			for _, user := range tt.users {
+				if next[user] != perUser {
+					t.Errorf("user %d: got %d payloads, want %d", user, next[user], perUser)
+				}
+			}
+		})
+	}
+}
+
+func TestShardForSpreadsPartitionUsers(t *testing.T) {
+	const partitions, shards = 4, 4
+	used := make(map[int]bool)
+	for user := int64(0); user < 1000; user++ {
+		if partitionFor(user, partitions) == 0 {
+			used[shardFor(user, shards)] = true
+		}
+	}
+	if len(used) != shards {
+		t.Errorf("users of one partition landed on %d of %d shards", len(used), shards)
+	}
+}
+
+// BenchmarkIngestBuffer compares handing each payload to the processor in
+// its own channel send with buffering through one or per-CPU shards
+func BenchmarkIngestBuffer(b *testing.B) {
+	tests := []struct {
+		name   string
+		shards int // 0 for a channel send per payload
+	}{
+		{"channel", 0},
+		{"one shard", 1},
+		{"shard per CPU", runtime.GOMAXPROCS(0)},
+	}
+	for _, tt := range tests {
+		b.Run(tt.name, func(b *testing.B) {
+			const size = 64
+			payloads := make(chan LogPayload, size)
+			bulk := make(chan []LogPayload, runtime.GOMAXPROCS(0))
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for payloads != nil || bulk != nil {
+					select {
+					case _, ok := <-payloads:
+						if !ok {
+							payloads = nil
+						}
+					case _, ok := <-bulk:
+						if !ok {
+							bulk = nil
+						}
+					}
+				}
+			}()
+
+			var buffer *ingestBuffer
+			if tt.shards > 0 {
+				buffer = newIngestBuffer(size, tt.shards, bulk)
+			}
+			var users int64
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					payload := LogPayload{UserID: atomic.AddInt64(&users, 1)}
+					if buffer != nil {
+						buffer.Add(payload)
+					} else {
+						payloads <- payload
+					}
+				}
+			})
+			if buffer != nil {
+				buffer.Flush()
+			}
+			b.StopTimer()
+
+			close(payloads)
+			close(bulk)
+			<-done
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// Set while /log enqueues payloads; when clear they are discarded with a 200
+	ingestEnabled int32
+
+	// Payloads discarded while ingestion was disabled
+	ingestDiscarded uint64
+)
+
+func init() {
+	setIngestEnabled(envBool("INGEST_ENABLED", true))
+}
+
+// ingestState is the body of the /admin/ingest endpoint
+type ingestState struct {
+	Enabled   bool   `json:"enabled"`
+	Discarded uint64 `json:"discarded,omitempty"`
+}
+
+// ingestToggle is the body of a PUT to /admin/ingest, whose enabled field
+// is required so a typo can't silently stop ingestion
+type ingestToggle struct {
+	Enabled *bool `json:"enabled"`
+}
+
+func setIngestEnabled(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&ingestEnabled, v)
+}
+
+func isIngestEnabled() bool {
+	return atomic.LoadInt32(&ingestEnabled) == 1
+}
+
+// Report whether ingestion is enabled
+
+func getIngestHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, ingestState{
+		Enabled:   isIngestEnabled(),
+		Discarded: atomic.LoadUint64(&ingestDiscarded),
+	})
+}
+
+// Enable or disable ingestion
+
+func putIngestHandler(w http.ResponseWriter, r *http.Request) {
+	var req ingestToggle
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid_body", err.Error(), nil)
+		return
+	}
+	if req.Enabled == nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid_body", `body must set "enabled"`, nil)
+		return
+	}
+
+	setIngestEnabled(*req.Enabled)
+	logger.Info("Ingestion toggled", zap.Bool("enabled", *req.Enabled))
+
+	getIngestHandler(w, r)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIngestToggle(t *testing.T) {
+	defer setIngestEnabled(true)
+	p := captureQueue(t)
+
+	tests := []struct {
+		name       string
+		enabled    bool
+		wantStatus int
+		wantQueued int
+	}{
+		{"enabled", true, http.StatusAccepted, 1},
+		{"disabled", false, http.StatusOK, 0},
+		{"re-enabled", true, http.StatusAccepted, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			body := `{"enabled":false}`
+			if tt.enabled {
+				body = `{"enabled":true}`
+			}
+			putIngestHandler(rec, httptest.NewRequest(http.MethodPut, "/admin/ingest", strings.NewReader(body)))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("PUT /admin/ingest answered %d", rec.Code)
+			}
+
+			before := ingestDiscarded
+			got, _ := postLog(t, `{"user_id":1}`)
+			if got.Code != tt.wantStatus {
+				t.Errorf("status %d, want %d", got.Code, tt.wantStatus)
+			}
+			if n := len(queued(p)); n != tt.wantQueued {
+				t.Errorf("enqueued %d payloads, want %d", n, tt.wantQueued)
+			}
+
+			rec = httptest.NewRecorder()
+			getIngestHandler(rec, httptest.NewRequest(http.MethodGet, "/admin/ingest", nil))
+			var state ingestState
+			if err := json.Unmarshal(rec.Body.Bytes(), &state); err != nil {
+				t.Fatal(err)
+			}
+			if state.Enabled != tt.enabled {
+				t.Errorf("reported enabled %v, want %v", state.Enabled, tt.enabled)
+			}
+			if !tt.enabled && state.Discarded != before+1 {
+				t.Errorf("discarded count %d, want %d", state.Discarded, before+1)
+			}
+		})
+	}
+}
+
+func TestPutIngestRequiresEnabled(t *testing.T) {
+	defer setIngestEnabled(true)
+	for _, body := range []string{`{}`, `{"enable":false}`, `{"enabled":null}`, `not json`} {
+		setIngestEnabled(true)
+		rec := httptest.NewRecorder()
+		putIngestHandler(rec, httptest.NewRequest(http.MethodPut, "/admin/ingest", strings.NewReader(body)))
+
+		var e errorResponse
+		_ = json.Unmarshal(rec.Body.Bytes(), &e)
+		if rec.Code != http.StatusBadRequest || e.Error != "invalid_body" {
+			t.Errorf("PUT %s answered %d %q, want 400 invalid_body", body, rec.Code, e.Error)
+		}
+		if !isIngestEnabled() {
+			t.Errorf("PUT %s disabled ingestion", body)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// kafkaRecord is a single keyed message for a broker topic
+type kafkaRecord struct {
+	Key   string          `json:"key,omitempty"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Producer publishes records to a broker topic, returning the broker's
+// status code (0 when no response was received)
+type Producer interface {
+	Produce(ctx context.Context, topic string, records []kafkaRecord) (int, error)
+}
+
+// kafkaSink publishes each payload of a batch as a record keyed by user_id,
+// so a user's events land on the same partition
+type kafkaSink struct {
+	producer Producer
+	topic    string
+}
+
+func (s *kafkaSink) Destination() string {
+	return "kafka-" + s.topic
+}
+
+func (s *kafkaSink) Send(ctx context.Context, batch *Batch) (int, error) {
+	records := make([]kafkaRecord, 0, len(batch.Payloads))
+	for _, payload := range batch.Payloads {
+		value, err := json.Marshal(payload)
+		if err != nil {
+			return 0, err
+		}
+		records = append(records, kafkaRecord{
+			Key:   strconv.FormatInt(payload.UserID, 10),
+			Value: value,
+		})
+	}
+	return s.producer.Produce(ctx, s.topic, records)
+}
+
+// restProducer produces via a Kafka REST Proxy style HTTP API
+// (POST {broker}/topics/{topic}), avoiding a native Kafka client
+type restProducer struct {
+	brokerURL string
+	client    *http.Client
+}
+
+func (p *restProducer) Produce(ctx context.Context, topic string, records []kafkaRecord) (int, error) {
+	data, err := json.Marshal(struct {
+		Records []kafkaRecord `json:"records"`
+	}{records})
+	if err != nil {
+		return 0, err
+	}
+
+	endpoint := strings.TrimRight(p.brokerURL, "/") + "/topics/" + url.PathEscape(topic)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, fmt.Errorf("produce to %s failed with status code %d", topic, resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
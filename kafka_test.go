@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestKafkaSinkProducesRecordsKeyedByUser(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		wantStatus int
+		wantErr    bool
+	}{
+		{"produced", http.StatusOK, http.StatusOK, false},
+		{"broker error", http.StatusInternalServerError, http.StatusInternalServerError, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var path, contentType string
+			var body struct {
+				Records []kafkaRecord `json:"records"`
+			}
+			broker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				path, contentType = r.URL.Path, r.Header.Get("Content-Type")
+				_ = json.NewDecoder(r.Body).Decode(&body)
+				w.WriteHeader(tt.status)
+			}))
+			defer broker.Close()
+
+			s := &kafkaSink{producer: &restProducer{brokerURL: broker.URL + "/", client: broker.Client()}, topic: "logs"}
+			batch := &Batch{Payloads: []LogPayload{{UserID: 7, Title: "a"}, {UserID: 9, Title: "b"}}}
+			status, err := s.Send(context.Background(), batch)
+			if status != tt.wantStatus || (err != nil) != tt.wantErr {
+				t.Fatalf("Send = %d, %v, want %d, error %v", status, err, tt.wantStatus, tt.wantErr)
+			}
+
+			if path != "/topics/logs" || contentType != "application/vnd.kafka.json.v2+json" {
+				t.Errorf("produced to %s as %s", path, contentType)
+			}
+			if len(body.Records) != 2 || body.Records[0].Key != "7" || body.Records[1].Key != "9" {
+				t.Fatalf("records %+v, want keys 7 and 9", body.Records)
+			}
+			var payload LogPayload
+			if err := json.Unmarshal(body.Records[1].Value, &payload); err != nil || payload.Title != "b" {
+				t.Errorf("record value %s, want the payload", body.Records[1].Value)
+			}
+		})
+	}
+}
+
+func TestNewKafkaSinkRequiresBrokerAndTopic(t *testing.T) {
+	if _, err := newSink(sinkConfig{Type: sinkTypeKafka, Topic: "logs"}); err == nil {
+		t.Error("created a kafka sink without a broker")
+	}
+	s, err := newSink(sinkConfig{Type: sinkTypeKafka, Broker: "http://broker", Topic: "logs"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Destination() != "kafka-logs" {
+		t.Errorf("destination %q, want kafka-logs", s.Destination())
+	}
+}
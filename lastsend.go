@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// File persisting the last successful send across restarts, optional
+var lastSendFile = os.Getenv("LAST_SEND_FILE")
+
+// Last successful send, restored from LAST_SEND_FILE at startup
+var lastSend = &lastSendMarker{}
+
+// lastSendRecord describes one successfully delivered batch
+type lastSendRecord struct {
+	Time        time.Time `json:"time"`
+	BatchID     string    `json:"batch_id"`
+	Sequence    uint64    `json:"sequence,omitempty"`
+	Destination string    `json:"destination"`
+	BatchSize   int       `json:"batch_size"`
+}
+
+// lastSendMarker tracks the most recent successful send, optionally
+// persisting it to a marker file after every update
+type lastSendMarker struct {
+	path string
+
+	mu   sync.Mutex
+	last *lastSendRecord
+}
+
+// loadLastSend restores the marker file at path, if any
+func loadLastSend(path string) (*lastSendMarker, error) {
+	m := &lastSendMarker{path: path}
+	if path == "" {
+		return m, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var rec lastSendRecord
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, err
+	}
+	m.last = &rec
+	return m, nil
+}
+
+// Record replaces the marker with rec. The in-memory marker is updated
+// even when persisting fails.
+func (m *lastSendMarker) Record(rec lastSendRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Sends to several sinks complete out of order, keep the newest
+	if m.last != nil && rec.Time.Before(m.last.Time) {
+		return nil
+	}
+	m.last = &rec
+	if m.path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(m.path, append(data, '\n'))
+}
+
+// Get returns the last successful send, or nil when none is known
+func (m *lastSendMarker) Get() *lastSendRecord {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.last == nil {
+		return nil
+	}
+	rec := *m.last
+	return &rec
+}
+
+// recordLastSend marks batch as delivered to destination
+func recordLastSend(destination string, batch *Batch) {
+	err := lastSend.Record(lastSendRecord{
+		Time:        time.Now().UTC(),
+		BatchID:     batch.ID,
+		Sequence:    batch.Sequence,
+		Destination: destination,
+		BatchSize:   len(batch.Payloads),
+	})
+	if err != nil {
+		logger.Warn("Failed to persist last send marker",
+			zap.String("last_send_file", lastSendFile),
+			zap.Error(err))
+	}
+}
+
+// Report the last successful send
+
+func getLastSendHandler(w http.ResponseWriter, r *http.Request) {
+	rec := lastSend.Get()
+	if rec == nil {
+		writeJSONError(w, http.StatusNotFound, "not_found", "no successful send recorded", nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, rec)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLastSendMarkerPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "last-send.json")
+	m, err := loadLastSend(path)
+	if err != nil || m.Get() != nil {
+		t.Fatalf("fresh marker %+v, %v, want none", m.Get(), err)
+	}
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		rec    lastSendRecord
+		wantID string
+	}{
+		{"first send", lastSendRecord{Time: now, BatchID: "a"}, "a"},
+		{"newer send", lastSendRecord{Time: now.Add(time.Second), BatchID: "b"}, "b"},
+		{"older send completing late", lastSendRecord{Time: now, BatchID: "c"}, "b"},
+	}
+	for _, tt := range tests {
+		if err := m.Record(tt.rec); err != nil {
+			t.Fatal(err)
+		}
+		reloaded, err := loadLastSend(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := reloaded.Get(); got == nil || got.BatchID != tt.wantID {
+			t.Errorf("%s: reloaded %+v, want batch %s", tt.name, got, tt.wantID)
+		}
+	}
+}
+
+func TestLastSendRecordedOnDelivery(t *testing.T) {
+	prev := lastSend
+	lastSend = &lastSendMarker{}
+	defer func() { lastSend = prev }()
+
+	if rec := adminRequest(t, http.MethodGet, "/admin/last-send", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("status %d before any send, want 404", rec.Code)
+	}
+
+	d := startDownstream(t, http.StatusOK, "")
+	startPipeline(t, 2, d.sink(formatJSON))
+	postLog(t, `{"user_id":1}`)
+	postLog(t, `{"user_id":2}`)
+	eventually(t, "last send", func() bool { return lastSend.Get() != nil })
+
+	rec := adminRequest(t, http.MethodGet, "/admin/last-send", "")
+	var got lastSendRecord
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK || got.BatchSize != 2 || got.Destination != d.sink(formatJSON).Destination() {
+		t.Errorf("got %d %+v, want the delivered batch of 2", rec.Code, got)
+	}
+}
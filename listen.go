@@ -0,0 +1,23 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+// Share the listening port with another process via SO_REUSEPORT, so a new
+// process can start accepting while the old one drains
+var reusePort = envBool("REUSE_PORT", false)
+
+// listen opens the server's TCP listener on addr
+func listen(addr string) (net.Listener, error) {
+	var lc net.ListenConfig
+	if reusePort {
+		if reusePortControl == nil {
+			return nil, errors.New("SO_REUSEPORT is not supported on this platform")
+		}
+		lc.Control = reusePortControl
+	}
+	return lc.Listen(context.Background(), "tcp", addr)
+}
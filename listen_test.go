@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+func TestListenReusePort(t *testing.T) {
+	if reusePortControl == nil {
+		t.Skip("SO_REUSEPORT is not supported on this platform")
+	}
+
+	tests := []struct {
+		name       string
+		reuse      bool
+		wantShared bool
+	}{
+		{"exclusive", false, false},
+		{"reuse port", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prev := reusePort
+			reusePort = tt.reuse
+			defer func() { reusePort = prev }()
+
+			first, err := listen("127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer first.Close()
+
+			second, err := listen(first.Addr().String())
+			if err == nil {
+				second.Close()
+			}
+			if shared := err == nil; shared != tt.wantShared {
+				t.Errorf("second bind shared the port %v, want %v (%v)", shared, tt.wantShared, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// CPU utilization (0-1) above which /log requests are shed, 0 disables shedding
+	loadShedCPUThreshold = envFloat("LOAD_SHED_CPU_THRESHOLD", 0)
+
+	// How often CPU utilization is sampled
+	loadShedSampleInterval = envDuration("LOAD_SHED_SAMPLE_INTERVAL", time.Second)
+
+	// Fraction of /log requests currently shed, as float64 bits
+	shedFractionBits uint64
+)
+
+// shedFraction maps CPU utilization to the fraction of requests to shed,
+// rising linearly from 0 at threshold to 1 at full utilization
+func shedFraction(cpu, threshold float64) float64 {
+	if cpu <= threshold || threshold >= 1 {
+		return 0
+	}
+	return math.Min((cpu-threshold)/(1-threshold), 1)
+}
+
+// shouldShed reports whether to shed the current request
+func shouldShed() bool {
+	fraction := math.Float64frombits(atomic.LoadUint64(&shedFractionBits))
+	return fraction > 0 && rand.Float64() < fraction
+}
+
+// runCPUSampler updates the shed fraction from CPU utilization every
+// interval, so requests only pay for an atomic load
+func runCPUSampler(interval time.Duration, threshold float64) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	prevBusy, prevTotal, err := readCPUTimes()
+	for range tick.C {
+		busy, total, readErr := readCPUTimes()
+		if readErr != nil {
+			if err == nil {
+				logger.Error("Failed to sample CPU", zap.Error(readErr))
+			}
+			err = readErr
+			continue
+		}
+		err = nil
+
+		if total > prevTotal {
+			cpu := float64(busy-prevBusy) / float64(total-prevTotal)
+			atomic.StoreUint64(&shedFractionBits, math.Float64bits(shedFraction(cpu, threshold)))
+		}
+		prevBusy, prevTotal = busy, total
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"sync/atomic"
+	"testing"
+)
+
+func TestShedFraction(t *testing.T) {
+	tests := []struct {
+		cpu, threshold float64
+		want           float64
+	}{
+		{0.5, 0.8, 0},
+		{0.8, 0.8, 0},
+		{0.9, 0.8, 0.5},
+		{1, 0.8, 1},
+		{0.95, 1, 0},
+	}
+	for _, tt := range tests {
+		if got := shedFraction(tt.cpu, tt.threshold); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("shedFraction(%v, %v) = %v, want %v", tt.cpu, tt.threshold, got, tt.want)
+		}
+	}
+}
+
+func TestLoadShedRejectsWithRetryAfter(t *testing.T) {
+	tests := []struct {
+		name       string
+		threshold  float64
+		fraction   float64
+		wantStatus int
+	}{
+		{"disabled", 0, 1, http.StatusAccepted},
+		{"below threshold", 0.8, 0, http.StatusAccepted},
+		{"saturated", 0.8, 1, http.StatusTooManyRequests},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prevThreshold, prevBits := loadShedCPUThreshold, atomic.LoadUint64(&shedFractionBits)
+			loadShedCPUThreshold = tt.threshold
+			atomic.StoreUint64(&shedFractionBits, math.Float64bits(tt.fraction))
+			defer func() {
+				loadShedCPUThreshold = prevThreshold
+				atomic.StoreUint64(&shedFractionBits, prevBits)
+			}()
+			p := captureQueue(t)
+
+			rec, e := postLog(t, `{"user_id":1}`)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusTooManyRequests {
+				if e.Error != "load_shed" || rec.Header().Get("Retry-After") != "1" {
+					t.Errorf("error %q, Retry-After %q", e.Error, rec.Header().Get("Retry-After"))
+				}
+				if n := len(queued(p)); n != 0 {
+					t.Errorf("enqueued %d shed payloads", n)
+				}
+			}
+		})
+	}
+}
+
+func TestReadCPUTimes(t *testing.T) {
+	busy, total, err := readCPUTimes()
+	if err != nil {
+		t.Skipf("cpu times unavailable: %v", err)
+	}
+	if total == 0 || busy > total {
+		t.Errorf("busy %d of %d jiffies", busy, total)
+	}
+}
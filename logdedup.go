@@ -0,0 +1,102 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// dedupLogger collapses repeated identical log lines, logging the first
+// occurrence and then a summary count once per interval
+type dedupLogger struct {
+	interval time.Duration
+
+	mu    sync.Mutex
+	lines map[string]*dedupLine
+}
+
+// dedupLine tracks suppressed occurrences of a single log line
+type dedupLine struct {
+	msg         string
+	windowStart time.Time
+	suppressed  int
+}
+
+func newDedupLogger(interval time.Duration) *dedupLogger {
+	return &dedupLogger{
+		interval: interval,
+		lines:    make(map[string]*dedupLine),
+	}
+}
+
+// Error logs msg unless a line with the same key was already logged in the current window
+func (d *dedupLogger) Error(key, msg string, fields ...zap.Field) {
+	if d.interval <= 0 {
+		logger.Error(msg, fields...)
+		return
+	}
+
+	now := time.Now()
+
+	d.mu.Lock()
+	line, ok := d.lines[key]
+	if ok && now.Sub(line.windowStart) < d.interval {
+		line.suppressed++
+		d.mu.Unlock()
+		return
+	}
+	var suppressed int
+	if ok {
+		suppressed = line.suppressed
+	}
+	d.lines[key] = &dedupLine{msg: msg, windowStart: now}
+	d.mu.Unlock()
+
+	if suppressed > 0 {
+		d.logSummary(msg, suppressed)
+	}
+	logger.Error(msg, fields...)
+}
+
+// Run periodically emits summaries for lines whose window has elapsed
+func (d *dedupLogger) Run() {
+	tick := time.NewTicker(d.interval)
+	defer tick.Stop()
+
+	for now := range tick.C {
+		d.flush(now)
+	}
+}
+
+func (d *dedupLogger) flush(now time.Time) {
+	type summary struct {
+		msg   string
+		count int
+	}
+	var summaries []summary
+
+	d.mu.Lock()
+	for key, line := range d.lines {
+		if now.Sub(line.windowStart) < d.interval {
+			continue
+		}
+		if line.suppressed > 0 {
+			summaries = append(summaries, summary{line.msg, line.suppressed})
+		}
+		delete(d.lines, key)
+	}
+	d.mu.Unlock()
+
+	for _, s := range summaries {
+		d.logSummary(s.msg, s.count)
+	}
+}
+
+func (d *dedupLogger) logSummary(msg string, count int) {
+	logger.Error("Repeated log line suppressed",
+		zap.String("message", msg),
+		zap.Int("count", count),
+		zap.Duration("interval", d.interval),
+	)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDedupLogger(t *testing.T) {
+	tests := []struct {
+		name         string
+		interval     time.Duration
+		keys         []string
+		wantMessages []string
+	}{
+		{"disabled logs every line", 0, []string{"a", "a", "a"}, []string{"msg a", "msg a", "msg a"}},
+		{"repeats suppressed", time.Hour, []string{"a", "a", "a"}, []string{"msg a"}},
+		{"distinct keys logged", time.Hour, []string{"a", "b", "a"}, []string{"msg a", "msg b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := observeLogs(t)
+			d := newDedupLogger(tt.interval)
+			for _, key := range tt.keys {
+				d.Error(key, "msg "+key)
+			}
+
+			var got []string
+			for _, entry := range logs.All() {
+				got = append(got, entry.Message)
+			}
+			if len(got) != len(tt.wantMessages) {
+				t.Fatalf("logged %v, want %v", got, tt.wantMessages)
+			}
+			for i := range got {
+				if got[i] != tt.wantMessages[i] {
+					t.Errorf("logged %v, want %v", got, tt.wantMessages)
+				}
+			}
+		})
+	}
+}
+
+func TestDedupLoggerSummarizesSuppressedLines(t *testing.T) {
+	logs := observeLogs(t)
+	d := newDedupLogger(time.Minute)
+	for i := 0; i < 4; i++ {
+		d.Error("key", "Batch send failed, retrying")
+	}
+
+	// Nothing is summarized while the window is open
+	d.flush(time.Now())
+	if n := logs.FilterMessage("Repeated log line suppressed").Len(); n != 0 {
+		t.Fatalf("summarized %d times before the window closed", n)
+	}
+
+	d.flush(time.Now().Add(2 * time.Minute))
+	summaries := logs.FilterMessage("Repeated log line suppressed").All()
+	if len(summaries) != 1 {
+		t.Fatalf("got %d summaries, want 1", len(summaries))
+	}
+	if count := summaries[0].ContextMap()["count"]; count != int64(3) {
+		t.Errorf("summary count %v, want 3", count)
+	}
+
+	// The line is logged again once its window has been flushed
+	d.Error("key", "Batch send failed, retrying")
+	if n := logs.FilterMessage("Batch send failed, retrying").Len(); n != 2 {
+		t.Errorf("line logged %d times, want 2", n)
+	}
+}
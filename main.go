@@ -3,14 +3,19 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"os"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
-	"bytes"
+	"fmt"
+	"io"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 )
 
@@ -21,6 +26,29 @@ type LogPayload struct {
 	Title     string  `json:"title"`
 	Meta      Metadata `json:"meta"`
 	Completed bool `json:"completed"`
+
+	// Lookup result attached when ENRICHMENT_URL is set
+	Enrichment json.RawMessage `json:"enrichment,omitempty"`
+
+	// Original request body, kept for dead-letter replay when DEADLETTER_INCLUDE_RAW is set
+	raw json.RawMessage
+
+	// Size of the request body the payload was decoded from
+	size int
+
+	// Receives the delivery outcome of the payload's batch in SYNC_ACK mode
+	ack chan error
+
+	// When the payload was queued, for queue latency and age tracking
+	enqueuedAt time.Time
+
+	// Indexes of the sinks ROUTES sends the payload to, decided once at admit time
+	routes []int
+
+	// Request the payload arrived in and its index among the request's
+	// payloads, for DELIVERY_STATUS_RETENTION
+	requestID string
+	record    int
 }
 
 // Metadata contains logins and phone numbers
@@ -45,8 +73,16 @@ var (
 	batchSize, _ = strconv.Atoi(os.Getenv("BATCH_SIZE"))
 	batchInterval, _ = strconv.Atoi(os.Getenv("BATCH_INTERVAL"))
 	postURL = os.Getenv("POST_ENDPOINT")
-	logPayloadChannel = make(chan LogPayload, batchSize)
 	logger *zap.Logger
+
+	// Collapses repeated retry/failure logs during sustained outages
+	retryLog = newDedupLogger(envDuration("LOG_DEDUP_INTERVAL", 0))
+
+	// Run the full pipeline but log batches instead of sending them
+	dryRun = envBool("DRY_RUN", false)
+
+	// Echo the effective request id back to /log clients
+	echoRequestID = envBool("ECHO_REQUEST_ID", false)
 )
 
 func main() {
@@ -60,13 +96,306 @@ func main() {
 		}  
 	 }()
 
-	// Create router and define routes
-	 
-	r := chi.NewRouter()
+	// Validate configuration
 
-	r.Get("/healthz", healthCheckHandler)
+	if !validClockSkewMode(clockSkewMode) {
+		logger.Fatal("Invalid CLOCK_SKEW_MODE", zap.String("clock_skew_mode", clockSkewMode))
+	}
 
-	r.Post("/log", handleLog)
+	if normalizePhones {
+		if _, ok := regionCallingCodes[phoneDefaultRegion]; !ok {
+			logger.Fatal("Unsupported PHONE_DEFAULT_REGION", zap.String("phone_default_region", phoneDefaultRegion))
+		}
+		if !validPhoneInvalidPolicy(phoneInvalidPolicy) {
+			logger.Fatal("Invalid PHONE_INVALID_POLICY", zap.String("phone_invalid_policy", phoneInvalidPolicy))
+		}
+	}
+
+	// Parsed regardless of OUTGOING_GZIP, as SINKS may select gzip per sink
+	level, err := parseGzipLevel(gzipLevelSetting)
+	if err != nil {
+		logger.Fatal("Invalid GZIP_LEVEL", zap.Error(err))
+	}
+	gzipLevel = level
+
+	if maxRetriesInProgress > 0 && deadLetterDir == "" {
+		logger.Fatal("MAX_RETRIES_IN_PROGRESS requires DEADLETTER_DIR")
+	}
+
+	if loadShedCPUThreshold < 0 || loadShedCPUThreshold >= 1 {
+		logger.Fatal("LOAD_SHED_CPU_THRESHOLD must be between 0 and 1", zap.Float64("load_shed_cpu_threshold", loadShedCPUThreshold))
+	}
+
+	if loadShedCPUThreshold > 0 {
+		if _, _, err := readCPUTimes(); err != nil {
+			logger.Fatal("LOAD_SHED_CPU_THRESHOLD requires CPU sampling", zap.Error(err))
+		}
+	}
+
+	if !validExpectContinueMode(expectContinueMode) {
+		logger.Fatal("Invalid EXPECT_CONTINUE", zap.String("expect_continue", expectContinueMode))
+	}
+
+	if !validTrailingDataMode(trailingDataMode) {
+		logger.Fatal("Invalid TRAILING_DATA_MODE", zap.String("trailing_data_mode", trailingDataMode))
+	}
+
+	if !validOrderScope(orderedEnqueue) {
+		logger.Fatal("Invalid ORDERED_ENQUEUE", zap.String("ordered_enqueue", orderedEnqueue))
+	}
+
+	if !validBatchChecksum(batchChecksum) {
+		logger.Fatal("Invalid BATCH_CHECKSUM", zap.String("batch_checksum", batchChecksum))
+	}
+
+	if !validOversizedAction(oversizedPayloadAction) {
+		logger.Fatal("Invalid OVERSIZED_PAYLOAD_ACTION", zap.String("oversized_payload_action", oversizedPayloadAction))
+	}
+
+	if maxPayloadBytes > 0 && oversizedPayloadAction == oversizedDeadLetter && deadLetterDir == "" {
+		logger.Fatal("OVERSIZED_PAYLOAD_ACTION=deadletter requires DEADLETTER_DIR")
+	}
+
+	if auditFile != "" && auditHashKey == "" {
+		logger.Fatal("AUDIT_FILE requires AUDIT_HASH_KEY")
+	}
+
+	if perRecordResults && deadLetterDir == "" {
+		logger.Fatal("PER_RECORD_RESULTS requires DEADLETTER_DIR")
+	}
+
+	if circuitFailureThreshold > 0 && deadLetterDir == "" {
+		logger.Fatal("CIRCUIT_FAILURE_THRESHOLD requires DEADLETTER_DIR")
+	}
+
+	// Parse expected downstream response
+
+	if expectedResponse != "" {
+		expected, err := parseExpectedResponse(expectedResponse)
+		if err != nil {
+			logger.Fatal("Invalid EXPECTED_RESPONSE", zap.Error(err))
+		}
+		expectedResponseBody = expected
+	}
+
+	// Load field aliases
+
+	if fieldAliasesFile != "" {
+		aliases, err := loadFieldAliases(fieldAliasesFile)
+		if err != nil {
+			logger.Fatal("Failed to load field aliases",
+				zap.String("field_aliases_file", fieldAliasesFile),
+				zap.Error(err))
+		}
+		fieldAliases = aliases
+	}
+
+	if !validRateCheckAction(rateCheckAction) {
+		logger.Fatal("Invalid RATE_CHECK_ACTION", zap.String("rate_check_action", rateCheckAction))
+	}
+
+	if !validEnrichmentFailurePolicy(enrichmentFailurePolicy) {
+		logger.Fatal("Invalid ENRICHMENT_FAILURE_POLICY", zap.String("enrichment_failure_policy", enrichmentFailurePolicy))
+	}
+
+	// Compile denied login CIDRs
+
+	if deniedCIDRsSetting != "" {
+		nets, err := parseDeniedCIDRs(deniedCIDRsSetting)
+		if err != nil {
+			logger.Fatal("Invalid DENIED_CIDRS", zap.Error(err))
+		}
+		deniedNets = nets
+	}
+
+	if !validDeniedCIDRAction(deniedCIDRAction) {
+		logger.Fatal("Invalid DENIED_CIDR_ACTION", zap.String("denied_cidr_action", deniedCIDRAction))
+	}
+
+	// Compile payload JSON schema
+
+	if schemaFile != "" {
+		schema, err := compileSchema(schemaFile)
+		if err != nil {
+			logger.Fatal("Failed to compile JSON schema",
+				zap.String("schema_file", schemaFile),
+				zap.Error(err))
+		}
+		payloadSchema = schema
+	}
+
+	// Set up batch encryption
+
+	if encryptionKey != "" {
+		aead, err := newBatchCipher(encryptionKey)
+		if err != nil {
+			logger.Fatal("Invalid ENCRYPTION_KEY", zap.Error(err))
+		}
+		batchCipher = aead
+	}
+
+	// Load batch sequence counter
+
+	if enableBatchSequence {
+		seq, err := newBatchSequencer(batchSequenceFile)
+		if err != nil {
+			logger.Fatal("Failed to load batch sequence",
+				zap.String("batch_sequence_file", batchSequenceFile),
+				zap.Error(err))
+		}
+		batchSequence = seq
+	}
+
+	// Restore last successful send marker
+
+	if lastSendFile != "" {
+		marker, err := loadLastSend(lastSendFile)
+		if err != nil {
+			logger.Fatal("Failed to load last send marker",
+				zap.String("last_send_file", lastSendFile),
+				zap.Error(err))
+		}
+		lastSend = marker
+	}
+
+	// Set up downstream response retention
+
+	if responseRetention > 0 {
+		responses = newResponseStore(responseRetention, responseRetentionMax)
+	}
+
+	// Set up per-request delivery status tracking
+
+	if deliveryStatusRetention > 0 {
+		deliveryStatuses = newDeliveryStatusStore(deliveryStatusRetention, deliveryStatusMax)
+	}
+
+	// Set up arrival-ordered enqueueing
+
+	if orderedEnqueue != "" {
+		arrivals = newArrivalOrders(orderedEnqueue)
+	}
+
+	// Set up per-user send ordering
+
+	if orderedPerUser {
+		userOrdering = newUserOrder()
+	}
+
+	// Set up per-user rate checks
+
+	if rateCheckWindow > 0 {
+		rateChecks = newUserRateCheck(rateCheckWindow, rateCheckMaxEvents, rateCheckMaxTotalDelta, rateCheckMaxUsers)
+	}
+
+	// Set up per-user meta backfill
+
+	if backfillMeta {
+		metaCache = newUserMetaCache(backfillMetaMaxUsers)
+	}
+
+	// Set up content-hash deduplication
+
+	if dedupeWindow > 0 {
+		contentDedupe = newContentDeduper(dedupeWindow, dedupeMaxEntries)
+	}
+
+	// Set up per-user ingestion counts
+
+	if userCountsCapacity > 0 {
+		userCounts = newTopUsers(userCountsCapacity)
+	}
+
+	// Open dead-letter files
+
+	if deadLetterDir != "" {
+		pool, err := newDeadLetterPool(deadLetterDir, maxDeadLetterFiles)
+		if err != nil {
+			logger.Fatal("Failed to create dead-letter directory",
+				zap.String("deadletter_dir", deadLetterDir),
+				zap.Error(err))
+		}
+		deadLetters = pool
+	}
+
+	// Open audit trail
+
+	if auditFile != "" {
+		a, err := openAuditLog(auditFile)
+		if err != nil {
+			logger.Fatal("Failed to open audit file",
+				zap.String("audit_file", auditFile),
+				zap.Error(err))
+		}
+		audit = a
+	}
+
+	// Build outgoing client and downstream sink
+
+	if sourceAddrSetting != "" {
+		addr, err := parseSourceAddr(sourceAddrSetting)
+		if err != nil {
+			logger.Fatal("Invalid SOURCE_ADDR", zap.Error(err))
+		}
+		sourceAddr = addr
+	}
+
+	httpClient = newHTTPClient()
+
+	if enrichmentURL != "" {
+		enricher = newEnrichmentLookup(enrichmentURL, enrichmentTimeout, enrichmentCacheTTL, enrichmentCacheMaxUsers, httpClient)
+	}
+
+	if sinks, err = newSinks(); err != nil {
+		logger.Fatal("Failed to create sinks",
+			zap.String("sink_type", sinkType),
+			zap.Error(err))
+	}
+
+	// Archive uploads fail whole windows, which must not be lost
+	if len(objectSinks) > 0 && deadLetterDir == "" {
+		logger.Fatal("Object sinks require DEADLETTER_DIR")
+	}
+
+	// Parse payload routes
+
+	if routesConfig != "" {
+		rt, err := newRouter(routesConfig, sinks)
+		if err != nil {
+			logger.Fatal("Invalid ROUTES", zap.Error(err))
+		}
+		payloadRouter = rt
+	}
+
+	// Start object storage archive uploads
+
+	for _, s := range objectSinks {
+		go s.Run()
+	}
+
+	// Set up per-destination circuit breakers
+
+	if circuitFailureThreshold > 0 {
+		breakers = newCircuitBreakers(sinks, circuitFailureThreshold, circuitOpenDuration)
+	}
+
+	// Register metrics
+
+	labels, err := newLabeler(metricLabelFields, metricTotalBuckets)
+	if err != nil {
+		logger.Fatal("Invalid metric label config", zap.Error(err))
+	}
+	payloadLabeler = labels
+
+	prefix, err := metricsPrefix(metricsNamespace, metricsSubsystem)
+	if err != nil {
+		logger.Fatal("Invalid METRICS_NAMESPACE or METRICS_SUBSYSTEM", zap.Error(err))
+	}
+	registerMetrics(prefix)
+
+	// Create router and define routes
+	 
+	r := newServerRouter()
 
 	// Log startup message
 
@@ -74,18 +403,89 @@ func main() {
 		zap.String("batch_size", os.Getenv("BATCH_SIZE")),
 		zap.String("batch_interval", os.Getenv("BATCH_INTERVAL")),
 		zap.String("post_endpoint", os.Getenv("POST_ENDPOINT")),
+		zap.String("sink_type", sinkType),
+		zap.Bool("dry_run", dryRun),
+		zap.Int("partitions", numPartitions),
 	)
 
-	// Start log batch processor goroutine
+	// Start CPU sampling for load shedding
+
+	if loadShedCPUThreshold > 0 {
+		go runCPUSampler(loadShedSampleInterval, loadShedCPUThreshold)
+	}
 
-	go processLogBatch()
+	// Start log dedup summary goroutine
+
+	if retryLog.interval > 0 {
+		go retryLog.Run()
+	}
+
+	// Start receipt log throttle summaries
+
+	if logRateLimit > 0 {
+		receiptLog = newLogThrottle(logRateLimit)
+		go receiptLog.Run(logRateSummaryInterval)
+	}
+
+	// Start per-partition ingest buffers and batch processor goroutines
+
+	partitions = newPartitions(numPartitions)
+	for _, p := range partitions {
+		if ingestBufferSize > 1 {
+			p.ingest = newIngestBuffer(ingestBufferSize, ingestBufferShards, p.bulk)
+			go p.ingest.Run(ingestBufferLinger)
+		}
+		go processLogBatch(p)
+	}
 
 	// Start server
 
-	if err := http.ListenAndServe(":8080", r); err != nil {
-        logger.Fatal("Failed to start server",
-          zap.Error(err))
-  	}
+	ln, err := listen(":8080")
+	if err != nil {
+		logger.Fatal("Failed to listen",
+			zap.Bool("reuse_port", reusePort),
+			zap.Error(err))
+	}
+
+	server := &http.Server{Handler: r, ConnContext: withConn}
+	go func() {
+		if err := server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			logger.Fatal("Failed to start server",
+				zap.Error(err))
+		}
+	}()
+
+	// Drain and exit on signal or after the maximum lifetime
+
+	shutdown(server, waitForShutdown(maxProcessLifetime))
+}
+
+
+
+// Router serving every route, with /debug only when ENABLE_PPROF is set
+
+func newServerRouter() *chi.Mux {
+	r := chi.NewRouter()
+
+	r.Use(middleware.RequestID)
+
+	r.Get("/healthz", healthCheckHandler)
+
+	r.Get("/readyz", readyzHandler)
+
+	r.Handle("/metrics", promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{}))
+
+	r.HandleFunc("/log", methodNotAllowed(http.MethodPost))
+	r.Post("/log", handleLog)
+
+	r.Get("/log/status/{requestID}", getDeliveryStatusHandler)
+
+	r.Route("/admin", adminRoutes)
+
+	if enablePprof {
+		r.Route("/debug", debugRoutes)
+	}
+	return r
 }
 
 
@@ -103,36 +503,374 @@ func healthCheckHandler(w http.ResponseWriter, r *http.Request) {
 // Handle new log requests
 
 func handleLog(w http.ResponseWriter, r *http.Request) {
-	// Decode JSON payload
-	var payload LogPayload
-	err := json.NewDecoder(r.Body).Decode(&payload)
+	// Discard while ingestion is paused, with a 200 so clients don't retry
+	if !isIngestEnabled() {
+		atomic.AddUint64(&ingestDiscarded, 1)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// Shed a share of requests while CPU is saturated
+	if loadShedCPUThreshold > 0 && shouldShed() {
+		w.Header().Set("Retry-After", "1")
+		writeJSONError(w, http.StatusTooManyRequests, "load_shed", "server is overloaded, retry later", nil)
+		return
+	}
+
+	// Take a place in arrival order before the body is read
+	if arrivals != nil {
+		ticket := arrivals.Take(r)
+		defer ticket.Finish()
+		r = withArrivalTicket(r, ticket)
+	}
+
+	// Refuse 100-continue requests before the client sends a body we'd reject
+	if reason := expectContinueRejection(r, expectContinueMode, maxBodyBytes); reason != "" {
+		writeJSONError(w, http.StatusExpectationFailed, "expectation_failed", reason, nil)
+		return
+	}
+
+	// Read request body, within the overall and stall deadlines
+	decodeStart := time.Now()
+	var decodeDeadline time.Time
+	if decodeTimeout > 0 {
+		decodeDeadline = decodeStart.Add(decodeTimeout)
+	}
+	clearDeadline := func() {}
+	var progress *progressReader
+	if conn, ok := requestConn(r); ok && stallTimeout > 0 {
+		progress = &progressReader{ReadCloser: r.Body, conn: conn, stall: stallTimeout, limit: decodeDeadline}
+		r.Body = progress
+		clearDeadline = clearReadDeadline(conn)
+	} else if decodeTimeout > 0 {
+		clearDeadline = setReadDeadline(r, decodeDeadline)
+	}
+	if maxBodyBytes > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, int64(maxBodyBytes))
+	}
+	body, err := io.ReadAll(r.Body)
+
+	// Keep the deadline on a timed out read, so the unread rest of the body
+	// can't hold the connection; it is closed after the response
+	if isTimeout(err) && (decodeTimeout > 0 || progress != nil) {
+		w.Header().Set("Connection", "close")
+		if progress != nil && progress.Stalled(time.Now()) {
+			writeJSONError(w, http.StatusRequestTimeout, "body_stalled",
+				fmt.Sprintf("no body bytes received for %s", stallTimeout), nil)
+			return
+		}
+		writeJSONError(w, http.StatusRequestTimeout, "decode_timeout",
+			fmt.Sprintf("body not read within %s", decodeTimeout), nil)
+		return
+	}
+	clearDeadline()
+
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, "body_too_large",
+			fmt.Sprintf("body exceeds %d bytes", maxBodyBytes), nil)
+		return
+	}
+
+	// Catch shippers declaring the wrong Content-Length
+	if strictContentLength {
+		if reason := contentLengthMismatch(r.ContentLength, len(body), err); reason != "" {
+			writeJSONError(w, http.StatusBadRequest, "length_mismatch", reason, nil)
+			return
+		}
+	}
+
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	// Undo Content-Encoding, bounded against decompression bombs
+	if body, err = decompressBody(body, r.Header.Get("Content-Encoding"), maxDecompressedBytes); err != nil {
+		switch {
+		case errors.Is(err, errDecompressedTooLarge):
+			writeJSONError(w, http.StatusRequestEntityTooLarge, "decompressed_too_large",
+				fmt.Sprintf("body exceeds %d bytes once decompressed", maxDecompressedBytes), nil)
+		case errors.Is(err, errUnsupportedEncoding):
+			writeJSONError(w, http.StatusUnsupportedMediaType, "unsupported_encoding", err.Error(), nil)
+		default:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
+
+	// Catch concatenated JSON objects the decoder would otherwise ignore
+	values, err := splitJSONValues(body)
+	if err == nil && len(values) > 1 && trailingDataMode == trailingDataNDJSON {
+		requestTicket(r).Expect(len(values))
+		ingestValues(w, r, values, decodeStart)
+		return
+	}
+	if err != nil || len(values) > 1 {
+		writeJSONError(w, http.StatusBadRequest, "trailing_data", trailingDataMessage(err), nil)
+		return
+	}
+
+	ingestPayload(w, r, body, decodeStart)
+}
+
+
+
+// Validate, decode and enqueue one JSON object from a /log body
+
+func ingestPayload(w http.ResponseWriter, r *http.Request, body []byte, decodeStart time.Time) {
+	payload, body, ok := decodePayload(w, r, body, decodeStart)
+	if !ok {
+		return
+	}
+	admitPayload(w, r, payload, body)
+}
+
+
+
+// Validate and decode one JSON object from a /log body, answering and
+// reporting false when it's refused. Returns the body with aliases applied.
+
+func decodePayload(w http.ResponseWriter, r *http.Request, body []byte, decodeStart time.Time) (LogPayload, []byte, bool) {
+	var payload LogPayload
+	var err error
+
+	// Reject bodies that clearly aren't JSON
+	if validateContentSniff {
+		if reason := sniffNonJSON(body); reason != "" {
+			writeJSONError(w, http.StatusUnsupportedMediaType, "unsupported_media_type", reason, nil)
+			return payload, nil, false
+		}
+	}
+
+	// Map aliased field names to current ones, keeping the original bytes
+	rawBody := body
+	if fieldAliases != nil {
+		if body, err = applyFieldAliases(body, fieldAliases); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return payload, nil, false
+		}
+	}
+
+	// Validate against JSON schema
+	if payloadSchema != nil {
+		violations, err := validateSchema(payloadSchema, body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return payload, nil, false
+		}
+		if len(violations) > 0 {
+			writeJSONError(w, http.StatusUnprocessableEntity, "schema_violation",
+				"payload does not match schema", violations)
+			return payload, nil, false
+		}
+	}
+
+	// Decode JSON payload
+	err = json.Unmarshal(body, &payload)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return payload, nil, false
+	}
+
+	// Enrichment is attached server-side only, never taken from the client
+	payload.Enrichment = nil
+
+	// Abort decodes that overran the deadline before doing further work
+	decodeElapsed := time.Since(decodeStart)
+	if decodeTimeout > 0 && decodeElapsed > decodeTimeout {
+		writeJSONError(w, http.StatusRequestTimeout, "decode_timeout",
+			fmt.Sprintf("body not decoded within %s", decodeTimeout), nil)
+		return payload, nil, false
+	}
+
+	if latencyHistograms {
+		decodeLatency.Observe(decodeElapsed.Seconds())
+	}
+
+	payload.size = len(body)
+
+	// Keep original bytes for dead-letter records
+	if deadLetterIncludeRaw {
+		payload.raw = rawBody
+	}
+
+	// Reject suspicious totals in strict finance mode
+	if financeStrict {
+		if code, msg := checkFinanceTotal(payload.Total); code != "" {
+			writeJSONError(w, http.StatusUnprocessableEntity, code, msg, nil)
+			return payload, nil, false
+		}
+	}
+
+	// Check login timestamps for clock skew
+	if err := checkClockSkew(&payload, time.Now(), maxClockSkew, clockSkewMode); err != nil {
+		writeJSONError(w, http.StatusUnprocessableEntity, "clock_skew", err.Error(), nil)
+		return payload, nil, false
+	}
+
+	// Normalize phone numbers to E.164
+	if normalizePhones {
+		if err := normalizePhoneNumbers(&payload.Meta.PhoneNumbers, phoneDefaultRegion, phoneInvalidPolicy); err != nil {
+			writeJSONError(w, http.StatusUnprocessableEntity, "invalid_phone_number", err.Error(), nil)
+			return payload, nil, false
+		}
+	}
+
+	// Refuse or flag payloads whose latest login is from a denied range
+	if deniedNets != nil {
+		if cidr := deniedLogin(&payload, deniedNets); cidr != "" {
+			logger.Warn("Payload login IP is in a denied CIDR",
+				zap.Int64("user_id", payload.UserID),
+				zap.String("cidr", cidr),
+				zap.String("action", deniedCIDRAction))
+			if deniedCIDRAction == deniedActionReject {
+				writeJSONError(w, http.StatusForbidden, "denied_ip",
+					"latest login IP is in a denied range", nil)
+				return payload, nil, false
+			}
+		}
+	}
+
+	return payload, body, true
+}
+
+
+
+// Apply the stateful per-payload policies to a decoded payload and
+// enqueue it, answering the request
+
+func admitPayload(w http.ResponseWriter, r *http.Request, payload LogPayload, body []byte) {
+	if ack := queuePayload(w, r, payload, body); ack != nil {
+		awaitDelivery(w, r, ack)
+	}
+}
+
+
+
+// Queue an admitted payload, answering the request unless it's to wait
+// for delivery in sync-ack mode; returns the payload's ack channel then
+
+func queuePayload(w http.ResponseWriter, r *http.Request, payload LogPayload, body []byte) chan error {
+
+	// Drop payloads whose latest login is from a denied range
+	if deniedNets != nil && deniedCIDRAction == deniedActionDrop && deniedLogin(&payload, deniedNets) != "" {
+		writeAccepted(w, r)
+		return nil
+	}
+
+	// Carry forward the user's last-known meta when none was sent
+	if metaCache != nil && metaCache.Backfill(&payload, body) {
+		logger.Debug("Backfilled payload meta", zap.Int64("user_id", payload.UserID))
+	}
+
+	// Drop payloads whose content was already accepted within the window
+	if contentDedupe != nil && contentDedupe.Duplicate(&payload, time.Now()) {
+		logger.Debug("Dropped duplicate payload", zap.Int64("user_id", payload.UserID))
+		writeAccepted(w, r)
+		return nil
+	}
+
+	// Flag or drop users exceeding their rate thresholds
+	if rateChecks != nil {
+		if reason := rateChecks.Check(payload.UserID, payload.Total, time.Now()); reason != "" {
+			logger.Warn("Payload tripped rate check",
+				zap.Int64("user_id", payload.UserID),
+				zap.String("reason", reason),
+				zap.String("action", rateCheckAction))
+			if rateCheckAction == rateActionDrop {
+				writeAccepted(w, r)
+				return nil
+			}
+		}
+	}
+
+	// Attach the user's enrichment, dropping the payload on failure if so configured
+	if enricher != nil {
+		if err := enricher.Enrich(r.Context(), &payload); err != nil {
+			logger.Warn("Payload enrichment failed",
+				zap.Int64("user_id", payload.UserID),
+				zap.String("policy", enrichmentFailurePolicy),
+				zap.Error(err))
+			if enrichmentFailurePolicy == enrichFailureDrop {
+				writeAccepted(w, r)
+				return nil
+			}
+		}
+	}
+
+	// Count payload by its metric labels
+	payloadsIngested.WithLabelValues(payloadLabeler.Values(&payload)...).Inc()
+
+	// Count payload for top-talker reporting
+	if userCounts != nil {
+		userCounts.Add(payload.UserID)
+	}
+
+	// Decide the payload's sinks once, rather than on every send
+	if payloadRouter != nil {
+		payload.routes = payloadRouter.Route(&payload)
+	}
+
 	// Send payload to channel
-	logPayloadChannel <- payload
+	if syncAck {
+		payload.ack = make(chan error, 1)
+	}
 
-	// Write accepted response
-	w.WriteHeader(http.StatusAccepted)
+	// Track delivery state for polling on /log/status
+	if deliveryStatuses != nil {
+		payload.requestID = middleware.GetReqID(r.Context())
+		payload.record = deliveryStatuses.Track(payload.requestID, time.Now())
+	}
+	enqueueInOrder(r, payload)
 
-	// Log receipt
-	logger.Info("Log payload received",
-		zap.Int64("user_id", payload.UserID),
-		zap.Float64("total", payload.Total), 	
-		zap.String("title", payload.Title),
-	)
+	// Log receipt, within LOG_RATE_LIMIT
+	if receiptLog.Allow(time.Now()) {
+		logger.Info("Log payload received",
+			zap.Int64("user_id", payload.UserID),
+			zap.Float64("total", payload.Total),
+			zap.String("title", payload.Title),
+		)
+	}
+
+	// Leave the response to the caller in sync-ack mode
+	if syncAck {
+		return payload.ack
+	}
+	writeAccepted(w, r)
+	return nil
 }
 
 
 
-// Batch processor loop
+// Hand payload to the batch processor
+
+func enqueue(payload LogPayload) {
+	payload.enqueuedAt = time.Now()
 
-func processLogBatch() {
+	if isOversized(&payload) {
+		sendOversized(payload)
+		return
+	}
+
+	p := partitions[partitionFor(payload.UserID, len(partitions))]
+	if p.ingest != nil {
+		p.ingest.Add(payload)
+		return
+	}
+	p.payloads <- payload
+}
+
+
+
+// Batch processor loop for one partition
+
+func processLogBatch(p *partition) {
 	
 	// Batching ticker
-	tick := time.NewTicker(time.Second * time.Duration(batchInterval))
+	interval := time.Second * time.Duration(batchInterval)
+	tick := time.NewTicker(interval)
+	atomic.StoreInt64(&p.stats.nextFlush, time.Now().Add(interval).UnixNano())
 
 	// Current log batch
 	var logBatch []LogPayload
@@ -144,93 +882,346 @@ func processLogBatch() {
 		select {
 
 		// New payload	
-		case payload := <-logPayloadChannel:
+		case payload := <-p.payloads:
 
 			// Add payload to current batch
+			observeQueueWait(&payload, time.Now())
 			logBatch = append(logBatch, payload)
 
 			// If batch is full, send it
-			if len(logBatch) == batchSize {
-				wg.Add(1)
-				go sendBatch(&wg, logBatch)
-				logBatch = make([]LogPayload, 0) 
+			logBatch = p.flushFull(&wg, logBatch)
+
+		// Coalesced payloads from the ingest buffer
+		case payloads := <-p.bulk:
+
+			// Add payloads to current batch
+			now := time.Now()
+			for i := range payloads {
+				observeQueueWait(&payloads[i], now)
 			}
+			logBatch = append(logBatch, payloads...)
+
+			// Send every full batch
+			logBatch = p.flushFull(&wg, logBatch)
+
+		// Batch size changed at runtime
+		case <-p.resized:
+			logBatch = p.flushFull(&wg, logBatch)
 
 		// Batch interval elapsed	
-		case <-tick.C:
+		case now := <-tick.C:
+			atomic.StoreInt64(&p.stats.nextFlush, now.Add(interval).UnixNano())
 
 			// Send remaining batch 
 			if len(logBatch) > 0 {
-				wg.Add(1)
-				go sendBatch(&wg, logBatch)
+				p.flush(&wg, logBatch)
 				logBatch = make([]LogPayload, 0)
 			}
+
+		// Coalescing window closed
+		case <-p.coalesce.C():
+			p.sendCoalesced(&wg)
+
+		// Shutting down
+		case <-p.stop:
+			tick.Stop()
+			p.drain(&wg, logBatch)
+			close(p.drained)
+			p.waitSends(&wg)
+			close(p.done)
+			return
 		}	
+
+		// Publish current batch length
+		atomic.StoreInt64(&p.stats.batchLen, int64(len(logBatch)))
+		p.storeOldest(logBatch)
 	}
 }
 
-// Attempt batch send with retries
+// Send the current batch and everything still queued on shutdown
+
+func (p *partition) drain(wg *sync.WaitGroup, logBatch []LogPayload) {
+	for {
+		select {
+		case payload := <-p.payloads:
+			logBatch = append(logBatch, payload)
+			continue
+		case payloads := <-p.bulk:
+			logBatch = append(logBatch, payloads...)
+			continue
+		default:
+		}
+		break
+	}
 
-func sendBatch(wg *sync.WaitGroup, batch []LogPayload) {
+	size := currentBatchSize()
+	for size > 0 && len(logBatch) > size {
+		p.flush(wg, logBatch[:size:size])
+		logBatch = logBatch[size:]
+	}
+	if len(logBatch) > 0 {
+		p.flush(wg, logBatch)
+	}
+	if p.coalesce != nil {
+		p.sendCoalesced(wg)
+	}
+	atomic.StoreInt64(&p.stats.batchLen, 0)
+	atomic.StoreInt64(&p.stats.oldest, 0)
+}
+
+// Hand flushed payloads to the send path, splitting and pacing large batches
+
+func dispatch(wg *sync.WaitGroup, payloads []LogPayload) {
+	chunks := [][]LogPayload{payloads}
+	var delay time.Duration
+	if smoothSendThreshold > 0 && len(payloads) > smoothSendThreshold {
+		chunks = splitPayloads(payloads, smoothSendThreshold)
+		observeSplit(splitSmoothSend, chunks)
+		delay = smoothSendDelay
+	}
+
+	// Fit chunks to the downstream's declared limits before the round trip
+	if downstreamLimited() {
+		chunks = fitDownstreamLimits(chunks)
+	}
+
+	switch len(chunks) {
+	case 0:
+		return
+	case 1:
+		wg.Add(1)
+		go sendBatch(wg, newBatch(chunks[0]))
+		return
+	}
+
+	batches := make([]*Batch, len(chunks))
+	for i, chunk := range chunks {
+		batches[i] = newBatch(chunk)
+	}
+	wg.Add(1)
+	go sendPaced(wg, batches, delay)
+}
+
+// Send batch to every sink
+
+func sendBatch(wg *sync.WaitGroup, batch *Batch) {
 	
 	// Marlowe batch send
 	defer wg.Done()
-	
-	// Serialize batch to JSON
-	data, _ := json.Marshal(batch)
+	defer unsent.Remove(batch)
+
+	// Wait for earlier batches of the same users
+	if batch.release != nil {
+		defer batch.release()
+		for _, prev := range batch.waitFor {
+			<-prev
+		}
+	}
+	atomic.StoreInt32(&batch.sending, 1)
+
+	// Log what would be sent in dry-run mode
+	if dryRun {
+		data, _ := json.Marshal(batch.Payloads)
+		for _, s := range sinks {
+			logger.Info("Dry run, batch not sent",
+				zap.Int("batch_size", len(batch.Payloads)),
+				zap.Int("bytes", len(data)),
+				zap.String("destination", s.Destination()))
+		}
+		batch.acknowledge(len(sinks), len(sinks), nil)
+		return
+	}
+
+	// Track in-flight bytes for queue pressure
+	size := int64(batch.Bytes())
+	atomic.AddInt64(&inflightBytes, size)
+	defer atomic.AddInt64(&inflightBytes, -size)
+
+	// Split the batch between sinks by route
+	routed := routeBatch(batch, sinks)
+
+	// Records any sink rejected, by index into batch
+	rejected := make(map[int]bool)
+
+	// Single sink, deliver inline
+	if len(routed) == 1 {
+		var delivered int
+		ok, dropped := deliver(routed[0].sink, routed[0].batch)
+		if ok {
+			delivered = 1
+		}
+		routed[0].markRejected(rejected, dropped)
+		batch.acknowledge(delivered, 1, rejected)
+		return
+	}
+
+	// Fan out so a failing sink doesn't hold up the others
+	var sinkWG sync.WaitGroup
+	var delivered int32
+	var rejectedMu sync.Mutex
+	for _, rb := range routed {
+		sinkWG.Add(1)
+		go func(rb routedBatch) {
+			defer sinkWG.Done()
+			ok, dropped := deliver(rb.sink, rb.batch)
+			if ok {
+				atomic.AddInt32(&delivered, 1)
+			}
+			rejectedMu.Lock()
+			rb.markRejected(rejected, dropped)
+			rejectedMu.Unlock()
+		}(rb)
+	}
+	sinkWG.Wait()
+
+	logger.Info("Batch fan-out complete",
+		zap.Int("batch_size", len(batch.Payloads)),
+		zap.Int("sinks", len(routed)),
+		zap.Int32("delivered", delivered),
+		zap.Int("rejected_records", len(rejected)))
 
-	// Create request
-	req, _ := http.NewRequestWithContext(context.Background(), http.MethodPost, postURL, bytes.NewBuffer(data))
+	batch.acknowledge(int(delivered), len(routed), rejected)
+}
+
+// Attempt batch send to one sink with retries, reporting whether it was
+// delivered and the indexes of records the sink rejected
+
+func deliver(s Sink, batch *Batch) (bool, []int) {
 	
 	// Track send time
 	start := time.Now()	
 	var status int	
 	
+	// Whether this batch holds a retry slot
+	var retrying bool
+
+	// Destination's circuit breaker, nil when disabled
+	breaker := breakers[s.Destination()]
+
+	// Records still to deliver, narrowed by per-record results, with their
+	// indexes into batch, and the indexes of records rejected so far
+	pending := batch
+	pendingIdx := make([]int, len(batch.Payloads))
+	for i := range pendingIdx {
+		pendingIdx[i] = i
+	}
+	var rejected []int
+
 	// Send loop
 	for try := 1; try <= 3; try++ {
 		logger.Info("Sending batch", 
-			zap.Int("batch_size", len(batch)),
+			zap.String("destination", s.Destination()),
+			zap.Int("batch_size", len(pending.Payloads)),
+			zap.String("batch_id", batch.ID),
+			zap.Uint64("sequence", batch.Sequence),
 			zap.Int("try", try))
 		
 
-		// Send batch	
-		resp, err := http.DefaultClient.Do(req)
-		
-		// Check result
-		if resp != nil {
-			status = resp.StatusCode
-			resp.Body.Close()
+		// Send batch to sink, unless its breaker is open
+		var err error
+		if breaker.Allow(time.Now()) {
+			attemptStart := time.Now()
+			status, err = s.Send(context.Background(), pending)
+			sendLatency.Observe(time.Since(attemptStart))
+			observeSendStatus(status)
+			breaker.Record(err == nil || isRecordFailure(err), time.Now())
+		} else {
+			status, err = 0, errCircuitOpen
 		}
 		
+		// Drop records the downstream rejected and retry only transient failures
+		var partial *recordFailure
+		if errors.As(err, &partial) {
+			if len(partial.rejected) > 0 {
+				dropRejectedRecords(s.Destination(), pending, partial, start)
+				for _, i := range partial.rejected {
+					rejected = append(rejected, pendingIdx[i])
+				}
+			}
+			if len(partial.retry) == 0 {
+				err = nil
+			} else {
+				retryIdx := make([]int, len(partial.retry))
+				for j, i := range partial.retry {
+					retryIdx[j] = pendingIdx[i]
+				}
+				pending, pendingIdx = pending.subset(partial.retry), retryIdx
+			}
+		}
+
 		// Success criteria
-		if err == nil && (status == 200 || status == 202) {
+		if err == nil {
 			break 
 		}
 
+		// Mark pipeline degraded until a send succeeds
+		setDegraded(s.Destination(), true)
+
 		// Retry loguc
+		canRetry := try < 3 && err != errCircuitOpen && !permanentGRPCError(err) && (partial != nil || shouldRetry(err, retryOnlyOnConnect))
+
+		// Claim a retry slot on the first failure, dead-lettering when none is free
+		if canRetry && !retrying {
+			if retrying = acquireRetrySlot(); retrying {
+				defer releaseRetrySlot()
+			} else {
+				canRetry = false
+				logger.Warn("Retries in progress at limit, not retrying",
+					zap.Int("batch_size", len(pending.Payloads)),
+					zap.Int("max_retries_in_progress", maxRetriesInProgress))
+			}
+		}
 		
-		if try < 3 {
-			logger.Error("Batch send failed, retrying", 
-				zap.Int("batch_size", len(batch)),
+		if canRetry {
+			retryLog.Error(fmt.Sprintf("retry|%s|%d|%v", s.Destination(), status, err), "Batch send failed, retrying",
+				zap.String("destination", s.Destination()),
+				zap.Int("batch_size", len(pending.Payloads)),
 				zap.Int("status_code", status),
 				zap.Error(err))
 			time.Sleep(2 * time.Second)
 			continue
 		}
 		
+		// Dead-letter failed batch
+		if deadLetters != nil {
+			logger.Error("Failed to send batch, dead-lettering",
+				zap.String("destination", s.Destination()),
+				zap.Int("batch_size", len(pending.Payloads)),
+				zap.Int("tries", try),
+				zap.Int("status_code", status),
+				zap.Error(err))
+			deadLetterBatch(s.Destination(), pending.Payloads, status, err)
+			audit.Record(pending, s.Destination(), auditDeadLettered, start)
+			return false, rejected
+		}
+
 		// Send failure
-		logger.Fatal("Failed to send batch after 3 retries, exiting",
-			zap.Int("batch_size", len(batch)),
+		logger.Fatal("Failed to send batch, exiting",
+			zap.String("destination", s.Destination()),
+			zap.Int("batch_size", len(pending.Payloads)),
+			zap.Int("tries", try),
 			zap.Int("status_code", status),
 			zap.Error(err))
 	}
 	
 	duration := time.Since(start)
+	setDegraded(s.Destination(), false)
+
+	// Only the records the sink accepted count as sent
+	accepted := batch.without(rejected)
+	if len(accepted.Payloads) > 0 {
+		recordLastSend(s.Destination(), accepted)
+		audit.Record(accepted, s.Destination(), auditDelivered, start)
+	}
 	
 	// Log batch send duration
 	logger.Info("Batch sent",
-		zap.Int("batch_size", len(batch)),
+		zap.String("destination", s.Destination()),
+		zap.Int("batch_size", len(accepted.Payloads)),
+		zap.Int("rejected_records", len(rejected)),
 		zap.Int("status_code", status),
 		zap.Duration("duration", duration),
 	)
-}
\ No newline at end of file
+
+	return true, rejected
+}
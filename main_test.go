@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestMain(m *testing.M) {
+	logger = zap.NewNop()
+	registerMetrics("")
+	os.Exit(m.Run())
+}
+
+// startPipeline runs one partition's processLogBatch with the given batch
+// size and sinks, draining and restoring the globals when the test ends
+func startPipeline(t *testing.T, size int, to ...Sink) *partition {
+	t.Helper()
+
+	prevSize, prevInterval, prevSinks := batchSize, batchInterval, sinks
+	batchSize, batchInterval, sinks = size, 60, to
+	atomic.StoreInt64(&activeBatchSize, int64(size))
+
+	partitions = newPartitions(1)
+	p := partitions[0]
+	go processLogBatch(p)
+
+	t.Cleanup(func() {
+		select {
+		case <-p.done:
+		default:
+			close(p.stop)
+		}
+		select {
+		case <-p.done:
+		case <-time.After(10 * time.Second):
+			t.Error("partition did not drain")
+		}
+		batchSize, batchInterval, sinks = prevSize, prevInterval, prevSinks
+		atomic.StoreInt64(&activeBatchSize, int64(prevSize))
+		partitions = nil
+	})
+	return p
+}
+
+// eventually polls cond until it holds or a second passes
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// observeLogs captures what logger writes until the test ends
+func observeLogs(t *testing.T) *observer.ObservedLogs {
+	t.Helper()
+	core, logs := observer.New(zapcore.DebugLevel)
+	prev := logger
+	logger = zap.New(core)
+	t.Cleanup(func() { logger = prev })
+	return logs
+}
+
+// captureQueue replaces the partitions with one that nothing processes,
+// so a test can read what the handler enqueued
+func captureQueue(t *testing.T) *partition {
+	t.Helper()
+	p := newPartitions(1)[0]
+	p.payloads = make(chan LogPayload, 100)
+	partitions = []*partition{p}
+	t.Cleanup(func() { partitions = nil })
+	return p
+}
+
+// queued removes and returns the payloads waiting in p's queue
+func queued(p *partition) []LogPayload {
+	var payloads []LogPayload
+	for {
+		select {
+		case payload := <-p.payloads:
+			payloads = append(payloads, payload)
+		default:
+			return payloads
+		}
+	}
+}
+
+// postLog serves a POST /log of body, returning the response and its
+// decoded error body, if any
+func postLog(t *testing.T, body string) (*httptest.ResponseRecorder, errorResponse) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handleLog(rec, httptest.NewRequest(http.MethodPost, "/log", strings.NewReader(body)))
+	var e errorResponse
+	_ = json.Unmarshal(rec.Body.Bytes(), &e)
+	return rec, e
+}
+
+// capturedRequest is a request a test downstream received
+type capturedRequest struct {
+	header http.Header
+	body   []byte
+}
+
+// downstream is a test HTTP endpoint answering every request with a fixed
+// status and body, recording the requests it receives
+type downstream struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []capturedRequest
+}
+
+func startDownstream(t *testing.T, status int, body string) *downstream {
+	t.Helper()
+	d := &downstream{}
+	d.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		d.mu.Lock()
+		d.requests = append(d.requests, capturedRequest{header: r.Header.Clone(), body: data})
+		d.mu.Unlock()
+		w.WriteHeader(status)
+		_, _ = io.WriteString(w, body)
+	}))
+	t.Cleanup(d.Close)
+	return d
+}
+
+// Requests returns the requests received so far
+func (d *downstream) Requests() []capturedRequest {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]capturedRequest(nil), d.requests...)
+}
+
+// deliveredCount returns how many payloads the downstream received in
+// JSON-format batches
+func deliveredCount(t *testing.T, d *downstream) int {
+	t.Helper()
+	var n int
+	for _, req := range d.Requests() {
+		var payloads []LogPayload
+		if err := json.Unmarshal(req.body, &payloads); err != nil {
+			t.Fatal(err)
+		}
+		n += len(payloads)
+	}
+	return n
+}
+
+// sink returns an HTTP sink posting to the downstream in format
+func (d *downstream) sink(format string) *httpSink {
+	return &httpSink{url: d.URL, format: format, encoding: encodingIdentity, client: d.Client()}
+}
+
+// useDeadLetters dead-letters failed sends into a temporary directory
+// until the test ends, returning the directory
+func useDeadLetters(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	pool, err := newDeadLetterPool(dir, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := deadLetters
+	deadLetters = pool
+	t.Cleanup(func() {
+		pool.Close()
+		deadLetters = prev
+	})
+	return dir
+}
+
+// adminRequest serves an authorized request to the /admin routes
+func adminRequest(t *testing.T, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	prev := adminToken
+	adminToken = "test-token"
+	defer func() { adminToken = prev }()
+
+	r := chi.NewRouter()
+	r.Route("/admin", adminRoutes)
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer test-token")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
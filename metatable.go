@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+)
+
+// Content-Type of the meta-table envelope
+const metaTableContentType = "application/vnd.meta-table+json"
+
+// metaTableEnvelope carries a batch with each distinct meta block stored
+// once in Meta and referenced from payloads by index, e.g.
+// {"meta":[{...}],"payloads":[{"user_id":1,...,"meta_ref":0}]}
+type metaTableEnvelope struct {
+	Meta     []Metadata       `json:"meta"`
+	Payloads []metaRefPayload `json:"payloads"`
+}
+
+// metaRefPayload is a LogPayload whose meta is an index into the meta table
+type metaRefPayload struct {
+	UserID    int64   `json:"user_id"`
+	Total     float64 `json:"total"`
+	Title     string  `json:"title"`
+	MetaRef   int     `json:"meta_ref"`
+	Completed bool    `json:"completed"`
+
+	Enrichment json.RawMessage `json:"enrichment,omitempty"`
+}
+
+// encodeMetaTable serializes payloads as a meta-table envelope, storing
+// identical meta blocks once
+func encodeMetaTable(payloads []LogPayload) ([]byte, error) {
+	env := metaTableEnvelope{
+		Meta:     make([]Metadata, 0, len(payloads)),
+		Payloads: make([]metaRefPayload, len(payloads)),
+	}
+
+	refs := make(map[string]int)
+	for i, payload := range payloads {
+		key, err := json.Marshal(payload.Meta)
+		if err != nil {
+			return nil, err
+		}
+		ref, ok := refs[string(key)]
+		if !ok {
+			ref = len(env.Meta)
+			refs[string(key)] = ref
+			env.Meta = append(env.Meta, payload.Meta)
+		}
+
+		env.Payloads[i] = metaRefPayload{
+			UserID:     payload.UserID,
+			Total:      payload.Total,
+			Title:      payload.Title,
+			MetaRef:    ref,
+			Completed:  payload.Completed,
+			Enrichment: payload.Enrichment,
+		}
+	}
+	return json.Marshal(env)
+}
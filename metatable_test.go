@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestEncodeMetaTable(t *testing.T) {
+	shared := Metadata{Logins: []Login{{IP: "10.0.0.1"}}}
+	payloads := []LogPayload{
+		{UserID: 1, Title: "a", Meta: shared, Enrichment: json.RawMessage(`{"tier":"gold","score":7}`)},
+		{UserID: 2, Title: "b", Meta: shared},
+		{UserID: 3, Title: "c", Meta: Metadata{Logins: []Login{{IP: "10.0.0.2"}}}},
+	}
+
+	data, err := encodeMetaTable(payloads)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var env metaTableEnvelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(env.Meta) != 2 {
+		t.Errorf("meta table holds %d blocks, want 2", len(env.Meta))
+	}
+	var refs []int
+	for _, payload := range env.Payloads {
+		refs = append(refs, payload.MetaRef)
+	}
+	if !reflect.DeepEqual(refs, []int{0, 0, 1}) {
+		t.Errorf("meta refs %v, want [0 0 1]", refs)
+	}
+
+	if want := `{"tier":"gold","score":7}`; string(env.Payloads[0].Enrichment) != want {
+		t.Errorf("enrichment %v, want %v", env.Payloads[0].Enrichment, want)
+	}
+	if env.Payloads[1].Enrichment != nil {
+		t.Errorf("unenriched payload carries enrichment %v", env.Payloads[1].Enrichment)
+	}
+}
+
+func TestEncodeMetaTableKeepsEnrichmentShape(t *testing.T) {
+	for _, enrichment := range []string{`["gold"]`, `"gold"`, `{"tier":{"name":"gold","since":2019}}`} {
+		data, err := encodeMetaTable([]LogPayload{{UserID: 1, Enrichment: json.RawMessage(enrichment)}})
+		if err != nil {
+			t.Fatalf("encode %s: %v", enrichment, err)
+		}
+		var env metaTableEnvelope
+		if err := json.Unmarshal(data, &env); err != nil {
+			t.Fatal(err)
+		}
+		if got := string(env.Payloads[0].Enrichment); got != enrichment {
+			t.Errorf("enrichment %s, want %s", got, enrichment)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Label value for totals outside every configured bucket
+const labelOther = "other"
+
+// Payload fields that can become ingest metric labels
+const (
+	labelFieldCompleted = "completed"
+	labelFieldTotal     = "total"
+)
+
+// Cap on total buckets, keeping label cardinality bounded
+const maxTotalBuckets = 10
+
+var (
+	// Comma-separated payload fields to label ingest counts with
+	metricLabelFields = envString("METRIC_LABEL_FIELDS", "")
+
+	// Ascending bucket bounds for the total label
+	metricTotalBuckets = envString("METRIC_TOTAL_BUCKETS", "0,10,100,1000")
+
+	// Built at startup from METRIC_LABEL_FIELDS
+	payloadLabeler = &labeler{}
+)
+
+// labeler maps payload fields onto a small fixed set of label values
+type labeler struct {
+	fields []string
+	bounds []float64
+}
+
+// newLabeler parses the label fields and total bucket bounds
+func newLabeler(fields, buckets string) (*labeler, error) {
+	l := &labeler{}
+	for _, field := range strings.Split(fields, ",") {
+		field = strings.TrimSpace(field)
+		switch field {
+		case "":
+			continue
+		case labelFieldCompleted, labelFieldTotal:
+			l.fields = append(l.fields, field)
+		default:
+			return nil, fmt.Errorf("unsupported metric label field %q", field)
+		}
+	}
+
+	for _, b := range strings.Split(buckets, ",") {
+		bound, err := strconv.ParseFloat(strings.TrimSpace(b), 64)
+		if err != nil || math.IsNaN(bound) || math.IsInf(bound, 0) {
+			return nil, fmt.Errorf("invalid total bucket bound %q", b)
+		}
+		if n := len(l.bounds); n > 0 && bound <= l.bounds[n-1] {
+			return nil, fmt.Errorf("total bucket bounds must be ascending")
+		}
+		l.bounds = append(l.bounds, bound)
+	}
+	if len(l.bounds) < 2 || len(l.bounds)-1 > maxTotalBuckets {
+		return nil, fmt.Errorf("total buckets need 2 to %d bounds", maxTotalBuckets+1)
+	}
+	return l, nil
+}
+
+// Names returns the label names, in field order
+func (l *labeler) Names() []string {
+	return l.fields
+}
+
+// Values returns the payload's label values, in field order
+func (l *labeler) Values(payload *LogPayload) []string {
+	values := make([]string, len(l.fields))
+	for i, field := range l.fields {
+		switch field {
+		case labelFieldCompleted:
+			values[i] = strconv.FormatBool(payload.Completed)
+		case labelFieldTotal:
+			values[i] = l.totalBucket(payload.Total)
+		}
+	}
+	return values
+}
+
+// totalBucket names the [lower, upper) range total falls in, or "other"
+func (l *labeler) totalBucket(total float64) string {
+	for i := 1; i < len(l.bounds); i++ {
+		if total >= l.bounds[i-1] && total < l.bounds[i] {
+			return formatBound(l.bounds[i-1]) + "-" + formatBound(l.bounds[i])
+		}
+	}
+	return labelOther
+}
+
+func formatBound(b float64) string {
+	return strconv.FormatFloat(b, 'g', -1, 64)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewLabeler(t *testing.T) {
+	tests := []struct {
+		name     string
+		fields   string
+		buckets  string
+		wantErr  bool
+		wantName []string
+	}{
+		{"no fields", "", "0,10", false, nil},
+		{"both fields", "completed, total", "0,10,100", false, []string{"completed", "total"}},
+		{"unsupported field", "title", "0,10", true, nil},
+		{"single bound", "total", "10", true, nil},
+		{"descending bounds", "total", "10,0", true, nil},
+		{"not a number", "total", "0,ten", true, nil},
+		{"infinite bound", "total", "0,Inf", true, nil},
+		{"too many buckets", "total", "0,1,2,3,4,5,6,7,8,9,10,11", true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := newLabeler(tt.fields, tt.buckets)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(l.Names(), tt.wantName) {
+				t.Errorf("names %v, want %v", l.Names(), tt.wantName)
+			}
+		})
+	}
+}
+
+func TestLabelerValues(t *testing.T) {
+	l, err := newLabeler("total,completed", "0,10,100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		payload LogPayload
+		want    []string
+	}{
+		{LogPayload{Total: 0, Completed: true}, []string{"0-10", "true"}},
+		{LogPayload{Total: 9.99}, []string{"0-10", "false"}},
+		{LogPayload{Total: 10}, []string{"10-100", "false"}},
+		{LogPayload{Total: 100}, []string{labelOther, "false"}},
+		{LogPayload{Total: -1}, []string{labelOther, "false"}},
+	}
+	for _, tt := range tests {
+		if got := l.Values(&tt.payload); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("values for total %v = %v, want %v", tt.payload.Total, got, tt.want)
+		}
+	}
+}
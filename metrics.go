@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+var (
+	// Registry served on /metrics
+	metricsRegistry = prometheus.NewRegistry()
+
+	// Prefix joined onto every exported metric name, e.g. mycompany_webhook_
+	metricsNamespace = os.Getenv("METRICS_NAMESPACE")
+	metricsSubsystem = os.Getenv("METRICS_SUBSYSTEM")
+
+	queuePressureGauge = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "queue_pressure",
+		Help: "Normalized 0-1 pipeline pressure combining queue fill, in-flight bytes and send latency, for use as an autoscaling signal.",
+	}, currentPressure)
+
+	// Labeled by payloadLabeler, so built in registerMetrics
+	payloadsIngested *prometheus.CounterVec
+
+	batchSplits = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "batch_splits_total",
+		Help: "Batches split into smaller sub-batches before sending, by reason.",
+	}, []string{"reason"})
+
+	subBatchSize = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "sub_batch_size",
+		Help:    "Payload count of each sub-batch produced by a split.",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 12),
+	})
+
+	// Record decode and queue latency histograms
+	latencyHistograms = envBool("LATENCY_HISTOGRAMS", false)
+
+	decodeLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "decode_duration_seconds",
+		Help:    "Time spent reading and decoding a /log request body.",
+		Buckets: prometheus.ExponentialBuckets(0.00005, 4, 10),
+	})
+
+	queueLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "queue_wait_seconds",
+		Help:    "Time a payload waits between enqueue and being added to a batch.",
+		Buckets: prometheus.ExponentialBuckets(0.00005, 4, 10),
+	})
+)
+
+// Valid Prometheus metric name component
+var metricNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// metricsPrefix validates METRICS_NAMESPACE and METRICS_SUBSYSTEM and
+// joins the set ones into a metric name prefix
+func metricsPrefix(namespace, subsystem string) (string, error) {
+	var prefix string
+	for _, part := range []string{namespace, subsystem} {
+		if part == "" {
+			continue
+		}
+		if !metricNamePattern.MatchString(part) {
+			return "", fmt.Errorf("%q is not a valid metric name component", part)
+		}
+		prefix += part + "_"
+	}
+	return prefix, nil
+}
+
+// registerMetrics registers all collectors with metricsRegistry, each
+// name carrying prefix
+func registerMetrics(prefix string) {
+	registry := prometheus.WrapRegistererWithPrefix(prefix, metricsRegistry)
+
+	payloadsIngested = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "payloads_ingested_total",
+		Help: "Payloads accepted on /log, labeled by the fields in METRIC_LABEL_FIELDS.",
+	}, payloadLabeler.Names())
+
+	registry.MustRegister(
+		payloadsIngested,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		queuePressureGauge,
+		circuitStateGauge,
+		batchSplits,
+		subBatchSize,
+		oldestPayloadAgeGauge,
+	)
+
+	if latencyHistograms {
+		registry.MustRegister(decodeLatency, queueLatency)
+	}
+
+	if connectionMetrics {
+		registry.MustRegister(openConnsGauge, idleConnsGauge)
+	}
+
+	if statusCodeMetrics {
+		registry.MustRegister(sendStatusCodes)
+	}
+}
+
+// observeQueueWait records how long payload waited since enqueue
+func observeQueueWait(payload *LogPayload, now time.Time) {
+	if latencyHistograms {
+		queueLatency.Observe(now.Sub(payload.enqueuedAt).Seconds())
+	}
+}
+
+// observeSplit records a batch split into chunks
+func observeSplit(reason string, chunks [][]LogPayload) {
+	batchSplits.WithLabelValues(reason).Inc()
+	for _, chunk := range chunks {
+		subBatchSize.Observe(float64(len(chunk)))
+	}
+}
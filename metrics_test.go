@@ -0,0 +1,220 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// gather collects c through a registry of its own
+func gather(t *testing.T, c prometheus.Collector) *prometheus.Registry {
+	t.Helper()
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(c)
+	return reg
+}
+
+// sampleCount returns how many observations the histogram c has recorded
+func sampleCount(t *testing.T, c prometheus.Collector) uint64 {
+	t.Helper()
+	families, err := gather(t, c).Gather()
+	if err != nil || len(families) != 1 {
+		t.Fatalf("gathered %d families, %v", len(families), err)
+	}
+	var n uint64
+	for _, m := range families[0].GetMetric() {
+		n += m.GetHistogram().GetSampleCount()
+	}
+	return n
+}
+
+// counterValue returns the summed value of the counters in c
+func counterValue(t *testing.T, c prometheus.Collector) float64 {
+	t.Helper()
+	families, err := gather(t, c).Gather()
+	if err != nil || len(families) != 1 {
+		t.Fatalf("gathered %d families, %v", len(families), err)
+	}
+	var v float64
+	for _, m := range families[0].GetMetric() {
+		v += m.GetCounter().GetValue()
+	}
+	return v
+}
+
+func TestLatencyHistograms(t *testing.T) {
+	tests := []struct {
+		name    string
+		enabled bool
+		want    uint64
+	}{
+		{"disabled", false, 0},
+		{"enabled", true, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prev := latencyHistograms
+			latencyHistograms = tt.enabled
+			defer func() { latencyHistograms = prev }()
+
+			decodeBefore, queueBefore := sampleCount(t, decodeLatency), sampleCount(t, queueLatency)
+			d := startDownstream(t, http.StatusOK, "")
+			startPipeline(t, 2, d.sink(formatJSON))
+			postLog(t, `{"user_id":1}`)
+			postLog(t, `{"user_id":2}`)
+			eventually(t, "batch send", func() bool { return len(d.Requests()) == 1 })
+
+			if got := sampleCount(t, decodeLatency) - decodeBefore; got != tt.want {
+				t.Errorf("observed %d decode latencies, want %d", got, tt.want)
+			}
+			if got := sampleCount(t, queueLatency) - queueBefore; got != tt.want {
+				t.Errorf("observed %d queue waits, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestObserveQueueWait(t *testing.T) {
+	prev := latencyHistograms
+	latencyHistograms = true
+	defer func() { latencyHistograms = prev }()
+
+	before := sampleCount(t, queueLatency)
+	now := time.Now()
+	observeQueueWait(&LogPayload{enqueuedAt: now.Add(-time.Second)}, now)
+	if got := sampleCount(t, queueLatency) - before; got != 1 {
+		t.Errorf("observed %d queue waits, want 1", got)
+	}
+}
+
+func TestBatchSplitMetrics(t *testing.T) {
+	tests := []struct {
+		name          string
+		threshold     int
+		wantSplits    float64
+		wantSubBatchs uint64
+	}{
+		{"not split", 0, 0, 0},
+		{"smoothed into three", 2, 1, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prevThreshold, prevDelay := smoothSendThreshold, smoothSendDelay
+			smoothSendThreshold, smoothSendDelay = tt.threshold, 0
+			defer func() { smoothSendThreshold, smoothSendDelay = prevThreshold, prevDelay }()
+
+			splitsBefore := counterValue(t, batchSplits.WithLabelValues(splitSmoothSend))
+			sizesBefore := sampleCount(t, subBatchSize)
+			d := startDownstream(t, http.StatusOK, "")
+			startPipeline(t, 5, d.sink(formatJSON))
+			for i := 0; i < 5; i++ {
+				postLog(t, `{"user_id":1}`)
+			}
+			eventually(t, "batch sent", func() bool { return deliveredCount(t, d) == 5 })
+
+			if got := counterValue(t, batchSplits.WithLabelValues(splitSmoothSend)) - splitsBefore; got != tt.wantSplits {
+				t.Errorf("counted %v splits, want %v", got, tt.wantSplits)
+			}
+			if got := sampleCount(t, subBatchSize) - sizesBefore; got != tt.wantSubBatchs {
+				t.Errorf("observed %d sub-batch sizes, want %d", got, tt.wantSubBatchs)
+			}
+		})
+	}
+}
+
+func TestMetricsPrefix(t *testing.T) {
+	tests := []struct {
+		namespace, subsystem string
+		want                 string
+		wantErr              bool
+	}{
+		{"", "", "", false},
+		{"acme", "", "acme_", false},
+		{"", "webhook", "webhook_", false},
+		{"acme", "webhook", "acme_webhook_", false},
+		{"acme-corp", "", "", true},
+		{"1acme", "", "", true},
+	}
+	for _, tt := range tests {
+		got, err := metricsPrefix(tt.namespace, tt.subsystem)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("metricsPrefix(%q, %q) = %q, %v, want %q", tt.namespace, tt.subsystem, got, err, tt.want)
+		}
+	}
+}
+
+func TestRegisterMetricsWithPrefix(t *testing.T) {
+	prevRegistry, prevIngested := metricsRegistry, payloadsIngested
+	metricsRegistry = prometheus.NewRegistry()
+	defer func() { metricsRegistry, payloadsIngested = prevRegistry, prevIngested }()
+
+	registerMetrics("acme_webhook_")
+	families, err := metricsRegistry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make(map[string]bool)
+	for _, family := range families {
+		if !strings.HasPrefix(family.GetName(), "acme_webhook_") {
+			t.Errorf("metric %s served without the prefix", family.GetName())
+		}
+		names[family.GetName()] = true
+	}
+	for _, name := range []string{"acme_webhook_queue_pressure", "acme_webhook_go_goroutines"} {
+		if !names[name] {
+			t.Errorf("%s not served", name)
+		}
+	}
+}
+
+func TestSendStatusCodeMetrics(t *testing.T) {
+	tests := []struct {
+		name       string
+		enabled    bool
+		downstream int
+		wantLabel  string
+		want       float64
+	}{
+		{"disabled", false, http.StatusOK, "200", 0},
+		{"known code", true, http.StatusOK, "200", 1},
+		{"unlisted code", true, http.StatusTeapot, "other", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prevEnabled, prevRetry := statusCodeMetrics, retryOnlyOnConnect
+			statusCodeMetrics, retryOnlyOnConnect = tt.enabled, true
+			defer func() { statusCodeMetrics, retryOnlyOnConnect = prevEnabled, prevRetry }()
+			useDeadLetters(t)
+
+			before := counterValue(t, sendStatusCodes.WithLabelValues(tt.wantLabel))
+			d := startDownstream(t, tt.downstream, "")
+			deliver(d.sink(formatJSON), &Batch{Payloads: []LogPayload{{UserID: 1}}})
+
+			if got := counterValue(t, sendStatusCodes.WithLabelValues(tt.wantLabel)) - before; got != tt.want {
+				t.Errorf("counted %v sends as %q, want %v", got, tt.wantLabel, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatusCodeLabel(t *testing.T) {
+	tests := []struct {
+		status int
+		want   string
+	}{
+		{0, "none"},
+		{http.StatusOK, "200"},
+		{http.StatusMultiStatus, "207"},
+		{http.StatusServiceUnavailable, "503"},
+		{http.StatusTeapot, "other"},
+		{599, "other"},
+	}
+	for _, tt := range tests {
+		if got := statusCodeLabel(tt.status); got != tt.want {
+			t.Errorf("statusCodeLabel(%d) = %q, want %q", tt.status, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Default time window batches are accumulated over before each upload
+const defaultArchiveWindow = 5 * time.Minute
+
+// Sinks archiving to object storage, flushed on shutdown
+var objectSinks []*objectSink
+
+// ObjectStore stores whole objects under a key, returning the store's
+// status code (0 when no response was received)
+type ObjectStore interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) (int, error)
+}
+
+// objectSink accumulates batches and uploads each time window as one
+// gzip-compressed object, for cold archival. Send returns only once the
+// batch's window has been uploaded, with the upload's outcome, so a batch
+// is reported delivered, retried or dead-lettered like any other sink's;
+// a batch can therefore stay in flight for up to a window.
+type objectSink struct {
+	store       ObjectStore
+	destination string
+	format      string
+	window      time.Duration
+
+	mu      sync.Mutex
+	current *archiveWindow
+
+	// Set by Flush at shutdown, after which each batch uploads on its own
+	draining bool
+}
+
+// archiveWindow is a window's buffered payloads and, once done is
+// closed, the outcome of their upload
+type archiveWindow struct {
+	start    time.Time
+	payloads []LogPayload
+
+	done   chan struct{}
+	status int
+	err    error
+}
+
+func (s *objectSink) Destination() string {
+	return s.destination
+}
+
+func (s *objectSink) Send(ctx context.Context, batch *Batch) (int, error) {
+	start := time.Now().Truncate(s.window)
+
+	s.mu.Lock()
+	if s.draining {
+		s.mu.Unlock()
+		w := &archiveWindow{start: start, payloads: batch.Payloads, done: make(chan struct{})}
+		s.upload(ctx, w)
+		return w.status, w.err
+	}
+	var closed *archiveWindow
+	if s.current != nil && !s.current.start.Equal(start) {
+		closed, s.current = s.current, nil
+	}
+	if s.current == nil {
+		s.current = &archiveWindow{start: start, done: make(chan struct{})}
+	}
+	w := s.current
+	w.payloads = append(w.payloads, batch.Payloads...)
+	s.mu.Unlock()
+
+	if closed != nil {
+		s.upload(ctx, closed)
+	}
+	<-w.done
+	return w.status, w.err
+}
+
+// Run uploads windows that ended without further batches arriving
+func (s *objectSink) Run() {
+	tick := time.NewTicker(s.window)
+	defer tick.Stop()
+
+	for now := range tick.C {
+		s.flush(now.Truncate(s.window))
+	}
+}
+
+// Flush uploads everything still buffered and has later batches upload
+// immediately, for shutdown
+func (s *objectSink) Flush() {
+	s.mu.Lock()
+	s.draining = true
+	s.mu.Unlock()
+
+	s.flush(time.Time{})
+}
+
+// flush uploads the buffered window if it started before current, or
+// unconditionally when current is zero
+func (s *objectSink) flush(current time.Time) {
+	s.mu.Lock()
+	w := s.current
+	if w == nil || (!current.IsZero() && !w.start.Before(current)) {
+		s.mu.Unlock()
+		return
+	}
+	s.current = nil
+	s.mu.Unlock()
+
+	s.upload(context.Background(), w)
+}
+
+// upload stores the window's payloads as one object and releases the
+// batches waiting on it with the outcome
+func (s *objectSink) upload(ctx context.Context, w *archiveWindow) {
+	defer close(w.done)
+	key := w.start.UTC().Format("20060102T150405Z") + "-" + newBatchID()[:8] + "." + s.format + ".gz"
+
+	w.status, w.err = s.put(ctx, key, w.payloads)
+	if w.err != nil {
+		logger.Error("Failed to upload archive",
+			zap.String("destination", s.destination),
+			zap.String("key", key),
+			zap.Int("batch_size", len(w.payloads)),
+			zap.Int("status_code", w.status),
+			zap.Error(w.err))
+		return
+	}
+	logger.Info("Archive uploaded",
+		zap.String("destination", s.destination),
+		zap.String("key", key),
+		zap.Int("batch_size", len(w.payloads)))
+}
+
+func (s *objectSink) put(ctx context.Context, key string, payloads []LogPayload) (int, error) {
+	data, err := encodeBatch(payloads, s.format)
+	if err != nil {
+		return 0, err
+	}
+	if data, err = gzipBytes(data, gzipLevel); err != nil {
+		return 0, err
+	}
+	return s.store.Put(ctx, key, data, "application/gzip")
+}
+
+// httpObjectStore stores objects with S3-style PUT {baseURL}/{key} requests
+type httpObjectStore struct {
+	baseURL string
+
+	// Authorization header value, optional
+	auth string
+
+	client *http.Client
+}
+
+func (o *httpObjectStore) Put(ctx context.Context, key string, data []byte, contentType string) (int, error) {
+	endpoint := strings.TrimRight(o.baseURL, "/") + "/" + url.PathEscape(key)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if o.auth != "" {
+		req.Header.Set("Authorization", o.auth)
+	}
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryStore is an ObjectStore keeping objects in memory, failing every
+// Put with err when set
+type memoryStore struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	err     error
+}
+
+func (m *memoryStore) Put(ctx context.Context, key string, data []byte, contentType string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return http.StatusServiceUnavailable, m.err
+	}
+	if m.objects == nil {
+		m.objects = make(map[string][]byte)
+	}
+	m.objects[key] = data
+	return http.StatusOK, nil
+}
+
+func TestObjectSinkReportsUploadOutcome(t *testing.T) {
+	tests := []struct {
+		name       string
+		storeErr   error
+		wantStatus int
+	}{
+		{"uploaded", nil, http.StatusOK},
+		{"upload failed", errors.New("store down"), http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &memoryStore{err: tt.storeErr}
+			s := &objectSink{store: store, destination: "object-test", format: formatNDJSON, window: time.Hour}
+
+			type result struct {
+				status int
+				err    error
+			}
+			results := make(chan result, 2)
+			for i := 1; i <= 2; i++ {
+				batch := &Batch{Payloads: []LogPayload{{UserID: int64(i), Title: "t"}}}
+				go func() {
+					status, err := s.Send(context.Background(), batch)
+					results <- result{status, err}
+				}()
+			}
+
+			// Nothing is reported until the window is uploaded
+			eventually(t, "both batches buffered", func() bool {
+				s.mu.Lock()
+				defer s.mu.Unlock()
+				return s.current != nil && len(s.current.payloads) == 2
+			})
+			select {
+			case r := <-results:
+				t.Fatalf("Send returned %d, %v before the upload", r.status, r.err)
+			case <-time.After(20 * time.Millisecond):
+			}
+
+			s.flush(time.Now().Add(2 * time.Hour).Truncate(time.Hour))
+			for i := 0; i < 2; i++ {
+				r := <-results
+				if r.status != tt.wantStatus || (r.err != nil) != (tt.storeErr != nil) {
+					t.Errorf("Send = %d, %v, want %d, error %v", r.status, r.err, tt.wantStatus, tt.storeErr != nil)
+				}
+			}
+
+			if tt.storeErr != nil {
+				return
+			}
+			if len(store.objects) != 1 {
+				t.Fatalf("uploaded %d objects, want 1", len(store.objects))
+			}
+			for key, data := range store.objects {
+				if !strings.HasSuffix(key, ".ndjson.gz") {
+					t.Errorf("key %q lacks the format suffix", key)
+				}
+				zr, err := gzip.NewReader(bytes.NewReader(data))
+				if err != nil {
+					t.Fatal(err)
+				}
+				body, _ := io.ReadAll(zr)
+				if lines := bytes.Count(body, []byte("\n")); lines != 2 {
+					t.Errorf("object holds %d records, want 2", lines)
+				}
+			}
+		})
+	}
+}
+
+func TestObjectSinkUploadsImmediatelyWhenDraining(t *testing.T) {
+	store := &memoryStore{}
+	s := &objectSink{store: store, destination: "object-test", format: formatNDJSON, window: time.Hour}
+	s.Flush()
+
+	status, err := s.Send(context.Background(), &Batch{Payloads: []LogPayload{{UserID: 1}}})
+	if status != http.StatusOK || err != nil {
+		t.Fatalf("Send = %d, %v, want 200", status, err)
+	}
+	if len(store.objects) != 1 {
+		t.Errorf("uploaded %d objects, want 1", len(store.objects))
+	}
+}
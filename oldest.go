@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// /readyz fails once an accepted payload has waited this long without
+// being sent, 0 disables the check
+var oldestPayloadMaxAge = envDuration("OLDEST_PAYLOAD_MAX_AGE", 0)
+
+var oldestPayloadAgeGauge = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+	Name: "oldest_unsent_payload_age_seconds",
+	Help: "Age of the oldest accepted payload not yet through its send, 0 when none is pending.",
+}, func() float64 {
+	return oldestUnsentAge(time.Now()).Seconds()
+})
+
+// readiness is the body of /readyz
+type readiness struct {
+	Status           string `json:"status"`
+	Reason           string `json:"reason,omitempty"`
+	OldestPayloadAge string `json:"oldest_payload_age"`
+}
+
+// oldestUnsentAge is the age of the oldest payload waiting in a
+// processor, coalescer or send. Queued payloads a processor hasn't picked
+// up are aged from its last loop, which catches processors that stopped
+// consuming even while their own batch is empty.
+func oldestUnsentAge(now time.Time) time.Duration {
+	oldest := unsent.Oldest()
+	for _, p := range partitions {
+		if t := atomic.LoadInt64(&p.stats.oldest); t != 0 && (oldest.IsZero() || t < oldest.UnixNano()) {
+			oldest = time.Unix(0, t)
+		}
+		if len(p.payloads) > 0 || len(p.bulk) > 0 {
+			if t := atomic.LoadInt64(&p.stats.lastLoop); t != 0 && (oldest.IsZero() || t < oldest.UnixNano()) {
+				oldest = time.Unix(0, t)
+			}
+		}
+	}
+	if oldest.IsZero() || now.Before(oldest) {
+		return 0
+	}
+	return now.Sub(oldest)
+}
+
+// oldestPending returns the earliest enqueue time among payloads, or zero
+func oldestPending(payloads []LogPayload) time.Time {
+	var oldest time.Time
+	for _, payload := range payloads {
+		if oldest.IsZero() || payload.enqueuedAt.Before(oldest) {
+			oldest = payload.enqueuedAt
+		}
+	}
+	return oldest
+}
+
+// Report readiness, failing while an accepted payload is stuck
+
+func readyzHandler(w http.ResponseWriter, r *http.Request) {
+	age := oldestUnsentAge(time.Now())
+	state := readiness{Status: "ready", OldestPayloadAge: age.String()}
+	if oldestPayloadMaxAge > 0 && age > oldestPayloadMaxAge {
+		state.Status = "unready"
+		state.Reason = "oldest unsent payload exceeds OLDEST_PAYLOAD_MAX_AGE"
+		writeJSON(w, http.StatusServiceUnavailable, state)
+		return
+	}
+	writeJSON(w, http.StatusOK, state)
+}
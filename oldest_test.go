@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// readyz serves /readyz, returning the status and body
+func readyz(t *testing.T) (int, readiness) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	readyzHandler(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var state readiness
+	if err := json.Unmarshal(rec.Body.Bytes(), &state); err != nil {
+		t.Fatal(err)
+	}
+	return rec.Code, state
+}
+
+func TestReadyzFailsOnStuckPayload(t *testing.T) {
+	tests := []struct {
+		name      string
+		batchSize int
+	}{
+		{"held in the batch", 10},
+		{"stuck in a send", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prev := oldestPayloadMaxAge
+			oldestPayloadMaxAge = 50 * time.Millisecond
+			defer func() { oldestPayloadMaxAge = prev }()
+
+			sink := newBlockingSink()
+			p := startPipeline(t, tt.batchSize, sink)
+			if status, _ := readyz(t); status != http.StatusOK {
+				t.Fatalf("status %d with nothing pending, want 200", status)
+			}
+
+			enqueue(LogPayload{UserID: 1})
+			eventually(t, "unready", func() bool {
+				status, state := readyz(t)
+				return status == http.StatusServiceUnavailable && state.Status == "unready"
+			})
+
+			// Drain whatever is pending and let it through
+			close(sink.release)
+			close(p.stop)
+			<-p.done
+			if status, _ := readyz(t); status != http.StatusOK {
+				t.Errorf("status %d once sent, want 200", status)
+			}
+		})
+	}
+}
+
+func TestOldestPending(t *testing.T) {
+	now := time.Now()
+	payloads := []LogPayload{{enqueuedAt: now}, {enqueuedAt: now.Add(-time.Minute)}, {enqueuedAt: now.Add(-time.Second)}}
+	if got := oldestPending(payloads); !got.Equal(now.Add(-time.Minute)) {
+		t.Errorf("oldest %s, want a minute ago", got)
+	}
+	if got := oldestPending(nil); !got.IsZero() {
+		t.Errorf("oldest of none %s, want zero", got)
+	}
+}
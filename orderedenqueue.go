@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// Scopes within which ORDERED_ENQUEUE preserves arrival order
+const (
+	orderScopeConnection = "connection"
+	orderScopeGlobal     = "global"
+)
+
+var (
+	// Enqueue payloads in request arrival order, per connection or globally,
+	// however long each request takes to read and decode
+	orderedEnqueue = envString("ORDERED_ENQUEUE", "")
+
+	// Reordering buffers, nil when ORDERED_ENQUEUE is unset
+	arrivals *arrivalOrders
+)
+
+// validOrderScope reports whether scope is a supported ORDERED_ENQUEUE
+func validOrderScope(scope string) bool {
+	switch scope {
+	case "", orderScopeConnection, orderScopeGlobal:
+		return true
+	}
+	return false
+}
+
+// Context key holding the request's arrivalTicket
+type arrivalTicketKey struct{}
+
+// arrivalOrders hands out arrival sequence numbers and holds back payloads
+// of later requests until every earlier request in the same scope has
+// enqueued its payloads or finished
+type arrivalOrders struct {
+	perConn bool
+
+	mu     sync.Mutex
+	scopes map[net.Conn]*arrivalScope // keyed by nil in global scope
+}
+
+// arrivalScope is the reordering buffer of one connection, or of all of them
+type arrivalScope struct {
+	next    uint64 // sequence of the next request to arrive
+	head    uint64 // lowest sequence not yet finished
+	tickets map[uint64]*arrivalTicket
+}
+
+// arrivalTicket is one request's place in its scope's arrival order
+type arrivalTicket struct {
+	orders *arrivalOrders
+	key    net.Conn
+	seq    uint64
+
+	remaining int // payloads still expected from the request
+	done      bool
+	pending   []LogPayload
+}
+
+func newArrivalOrders(scope string) *arrivalOrders {
+	return &arrivalOrders{
+		perConn: scope == orderScopeConnection,
+		scopes:  make(map[net.Conn]*arrivalScope),
+	}
+}
+
+// Take assigns r the next sequence number in its scope, expecting one payload
+func (o *arrivalOrders) Take(r *http.Request) *arrivalTicket {
+	var key net.Conn
+	if o.perConn {
+		key, _ = requestConn(r)
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	scope, ok := o.scopes[key]
+	if !ok {
+		scope = &arrivalScope{tickets: make(map[uint64]*arrivalTicket)}
+		o.scopes[key] = scope
+	}
+	t := &arrivalTicket{orders: o, key: key, seq: scope.next, remaining: 1}
+	scope.tickets[t.seq] = t
+	scope.next++
+	return t
+}
+
+// withArrivalTicket stores t in r's context for enqueueInOrder
+func withArrivalTicket(r *http.Request, t *arrivalTicket) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), arrivalTicketKey{}, t))
+}
+
+// requestTicket returns r's arrival ticket, or nil when it holds none
+func requestTicket(r *http.Request) *arrivalTicket {
+	t, _ := r.Context().Value(arrivalTicketKey{}).(*arrivalTicket)
+	return t
+}
+
+// enqueueInOrder enqueues payload behind the payloads of earlier requests
+// when r holds an arrival ticket, and straight away otherwise
+func enqueueInOrder(r *http.Request, payload LogPayload) {
+	if t := requestTicket(r); t != nil {
+		t.Add(payload)
+		return
+	}
+	enqueue(payload)
+}
+
+// Expect sets how many payloads the request will enqueue, for bodies
+// carrying several JSON objects
+func (t *arrivalTicket) Expect(n int) {
+	if t == nil {
+		return
+	}
+	t.orders.mu.Lock()
+	defer t.orders.mu.Unlock()
+	t.remaining = n
+}
+
+// Add buffers payload, finishing the ticket with the last expected one.
+// Released payloads are enqueued under the lock so they can't interleave.
+func (t *arrivalTicket) Add(payload LogPayload) {
+	t.orders.mu.Lock()
+	defer t.orders.mu.Unlock()
+
+	t.pending = append(t.pending, payload)
+	if t.remaining--; t.remaining <= 0 {
+		t.done = true
+	}
+	t.orders.release(t.key)
+}
+
+// Finish marks the request as done enqueueing, so later requests aren't
+// held back by one that was rejected or dropped. Safe to call repeatedly.
+func (t *arrivalTicket) Finish() {
+	if t == nil {
+		return
+	}
+	t.orders.mu.Lock()
+	defer t.orders.mu.Unlock()
+
+	t.done = true
+	t.orders.release(t.key)
+}
+
+// release enqueues the buffered payloads of the scope's leading requests,
+// up to the first one that hasn't finished, and drops the scope once no
+// request in it is outstanding. Callers hold o.mu.
+func (o *arrivalOrders) release(key net.Conn) {
+	scope := o.scopes[key]
+	if scope == nil {
+		return
+	}
+	for {
+		t, ok := scope.tickets[scope.head]
+		if !ok {
+			break
+		}
+		for _, payload := range t.pending {
+			enqueue(payload)
+		}
+		t.pending = nil
+		if !t.done {
+			break
+		}
+		delete(scope.tickets, scope.head)
+		scope.head++
+	}
+	if scope.head == scope.next {
+		delete(o.scopes, key)
+	}
+}
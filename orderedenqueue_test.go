@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestArrivalOrder(t *testing.T) {
+	type step struct {
+		ticket int
+		op     string // "add" enqueues user ticket+1, "finish" or "expect2"
+	}
+	tests := []struct {
+		name  string
+		steps []step
+		want  []int64
+	}{
+		{"in order", []step{{0, "add"}, {1, "add"}}, []int64{1, 2}},
+		{"later request held back", []step{{1, "add"}}, nil},
+		{"released behind the earlier request", []step{{1, "add"}, {0, "add"}}, []int64{1, 2}},
+		{"finished request stops holding back", []step{{1, "add"}, {0, "finish"}}, []int64{2}},
+		{"multi-payload request", []step{{0, "expect2"}, {1, "add"}, {0, "add"}, {0, "add"}}, []int64{1, 1, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := captureQueue(t)
+			o := newArrivalOrders(orderScopeGlobal)
+			req := httptest.NewRequest(http.MethodPost, "/log", nil)
+			tickets := []*arrivalTicket{o.Take(req), o.Take(req)}
+
+			for _, s := range tt.steps {
+				switch s.op {
+				case "add":
+					tickets[s.ticket].Add(LogPayload{UserID: int64(s.ticket + 1)})
+				case "finish":
+					tickets[s.ticket].Finish()
+				case "expect2":
+					tickets[s.ticket].Expect(2)
+				}
+			}
+
+			var got []int64
+			for _, payload := range queued(p) {
+				got = append(got, payload.UserID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("enqueued users %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRejectedRequestReleasesOrder(t *testing.T) {
+	prev := arrivals
+	arrivals = newArrivalOrders(orderScopeGlobal)
+	defer func() { arrivals = prev }()
+
+	p := captureQueue(t)
+	if rec, _ := postLog(t, `not json`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, want 400", rec.Code)
+	}
+	postLog(t, `{"user_id":1}`)
+	if n := len(queued(p)); n != 1 {
+		t.Errorf("enqueued %d payloads behind a rejected request, want 1", n)
+	}
+	if len(arrivals.scopes) != 0 {
+		t.Errorf("%d scopes outstanding once every request finished", len(arrivals.scopes))
+	}
+}
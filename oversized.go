@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// Actions for payloads larger than MAX_PAYLOAD_BYTES
+const (
+	oversizedIsolate    = "isolate"
+	oversizedDeadLetter = "deadletter"
+)
+
+var (
+	// Payloads whose request body exceeds this are kept out of batches, 0 disables the check
+	maxPayloadBytes = envInt("MAX_PAYLOAD_BYTES", 0)
+
+	// Send oversized payloads on their own, or dead-letter them
+	oversizedPayloadAction = envString("OVERSIZED_PAYLOAD_ACTION", oversizedIsolate)
+
+	// Isolated single-payload sends, waited for on shutdown
+	oversizedSends sync.WaitGroup
+)
+
+// Destination recorded for dead-lettered oversized payloads
+const oversizedDestination = "oversized"
+
+// validOversizedAction reports whether action is a supported OVERSIZED_PAYLOAD_ACTION
+func validOversizedAction(action string) bool {
+	return action == oversizedIsolate || action == oversizedDeadLetter
+}
+
+// isOversized reports whether payload exceeds MAX_PAYLOAD_BYTES
+func isOversized(payload *LogPayload) bool {
+	return maxPayloadBytes > 0 && payload.size > maxPayloadBytes
+}
+
+// sendOversized keeps an oversized payload from poisoning a batch, either
+// sending it as a batch of its own or dead-lettering it
+func sendOversized(payload LogPayload) {
+	logger.Warn("Payload exceeds MAX_PAYLOAD_BYTES",
+		zap.Int64("user_id", payload.UserID),
+		zap.Int("payload_bytes", payload.size),
+		zap.Int("max_payload_bytes", maxPayloadBytes),
+		zap.String("action", oversizedPayloadAction))
+
+	if oversizedPayloadAction == oversizedIsolate {
+		oversizedSends.Add(1)
+		go sendBatch(&oversizedSends, newBatch([]LogPayload{payload}))
+		return
+	}
+
+	err := fmt.Errorf("payload of %d bytes exceeds MAX_PAYLOAD_BYTES %d", payload.size, maxPayloadBytes)
+	deadLetterBatch(oversizedDestination, []LogPayload{payload}, 0, err)
+	audit.Record(&Batch{ID: newBatchID(), Payloads: []LogPayload{payload}}, oversizedDestination, auditDeadLettered, payload.enqueuedAt)
+	setDeliveryState([]LogPayload{payload}, deliveryDeadLettered)
+	if payload.ack != nil {
+		payload.ack <- err
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOversizedPayloadActions(t *testing.T) {
+	large := fmt.Sprintf(`{"user_id":2,"title":%q}`, strings.Repeat("x", 200))
+	tests := []struct {
+		action           string
+		wantSent         int
+		wantDeadLettered int
+	}{
+		{oversizedIsolate, 1, 0},
+		{oversizedDeadLetter, 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.action, func(t *testing.T) {
+			prevMax, prevAction := maxPayloadBytes, oversizedPayloadAction
+			maxPayloadBytes, oversizedPayloadAction = 100, tt.action
+			defer func() { maxPayloadBytes, oversizedPayloadAction = prevMax, prevAction }()
+			dir := useDeadLetters(t)
+
+			d := startDownstream(t, http.StatusOK, "")
+			startPipeline(t, 100, d.sink(formatJSON))
+			for _, body := range []string{`{"user_id":1}`, large} {
+				if rec, _ := postLog(t, body); rec.Code != http.StatusAccepted {
+					t.Fatalf("status %d, want 202", rec.Code)
+				}
+			}
+			oversizedSends.Wait()
+
+			requests := d.Requests()
+			if len(requests) != tt.wantSent {
+				t.Fatalf("sent %d batches, want %d", len(requests), tt.wantSent)
+			}
+			if tt.wantSent > 0 {
+				var payloads []LogPayload
+				if err := json.Unmarshal(requests[0].body, &payloads); err != nil || len(payloads) != 1 || payloads[0].UserID != 2 {
+					t.Errorf("isolated batch %s, want only the oversized payload", requests[0].body)
+				}
+			}
+			if tt.wantDeadLettered > 0 {
+				if n := countLines(t, filepath.Join(dir, oversizedDestination+".ndjson")); n != tt.wantDeadLettered {
+					t.Errorf("dead-lettered %d records, want %d", n, tt.wantDeadLettered)
+				}
+			}
+		})
+	}
+}
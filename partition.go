@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+)
+
+var (
+	numPartitions = envInt("NUM_PARTITIONS", 1)
+
+	// Queues each drained by their own processLogBatch goroutine
+	partitions []*partition
+)
+
+// partition is an independent queue and batch. Payloads are routed by
+// user_id, so a user's payloads stay in order within their partition.
+type partition struct {
+	payloads chan LogPayload
+
+	// Coalesced payloads from the partition's ingest buffer
+	bulk   chan []LogPayload
+	ingest *ingestBuffer
+
+	// Holds flushed batches for COALESCE_WINDOW, nil when disabled
+	coalesce *coalescer
+
+	// Processor internals for /admin/processor
+	stats processorStats
+
+	// Signalled when the batch size changes at runtime
+	resized chan struct{}
+
+	// Closed to make the processor drain and exit, which closes done.
+	// drained is closed once the current batch and coalesced payloads
+	// are handed to sends, before waiting for them.
+	stop    chan struct{}
+	drained chan struct{}
+	done    chan struct{}
+}
+
+func newPartitions(n int) []*partition {
+	if n < 1 {
+		n = 1
+	}
+	parts := make([]*partition, n)
+	for i := range parts {
+		parts[i] = &partition{
+			payloads: make(chan LogPayload, queueCapacity()),
+			bulk:     make(chan []LogPayload, ingestBufferShards),
+			resized:  make(chan struct{}, 1),
+			stop:     make(chan struct{}),
+			drained:  make(chan struct{}),
+			done:     make(chan struct{}),
+		}
+		if coalesceWindow > 0 {
+			parts[i].coalesce = newCoalescer(coalesceWindow)
+		}
+	}
+	return parts
+}
+
+// leftovers removes and returns payloads queued or buffered for the
+// partition that its processor never took, for shutdown drops
+func (p *partition) leftovers() []LogPayload {
+	var payloads []LogPayload
+	if p.ingest != nil {
+		payloads = p.ingest.Take()
+	}
+	for {
+		select {
+		case payload := <-p.payloads:
+			payloads = append(payloads, payload)
+		case bulk := <-p.bulk:
+			payloads = append(payloads, bulk...)
+		default:
+			return payloads
+		}
+	}
+}
+
+// partitionFor maps a user id onto one of n partitions
+func partitionFor(userID int64, n int) int {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(userID))
+
+	h := fnv.New32a()
+	_, _ = h.Write(buf[:])
+	return int(h.Sum32() % uint32(n))
+}
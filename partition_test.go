@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPartitionFor(t *testing.T) {
+	for _, n := range []int{1, 3, 8} {
+		used := make(map[int]bool)
+		for user := int64(0); user < 1000; user++ {
+			p := partitionFor(user, n)
+			if p < 0 || p >= n {
+				t.Fatalf("partitionFor(%d, %d) = %d, out of range", user, n, p)
+			}
+			if p != partitionFor(user, n) {
+				t.Fatalf("partitionFor(%d, %d) not stable", user, n)
+			}
+			used[p] = true
+		}
+		if len(used) != n {
+			t.Errorf("%d partitions used of %d", len(used), n)
+		}
+	}
+}
+
+func TestEnqueueKeepsUserOnOnePartition(t *testing.T) {
+	partitions = newPartitions(4)
+	defer func() { partitions = nil }()
+	for _, p := range partitions {
+		p.payloads = make(chan LogPayload, 100)
+	}
+
+	for i := 0; i < 20; i++ {
+		enqueue(LogPayload{UserID: int64(i % 5), Total: float64(i)})
+	}
+
+	seen := make(map[int64]int)
+	for i, p := range partitions {
+		last := make(map[int64]float64)
+		for _, payload := range queued(p) {
+			if prev, ok := seen[payload.UserID]; ok && prev != i {
+				t.Errorf("user %d on partitions %d and %d", payload.UserID, prev, i)
+			}
+			seen[payload.UserID] = i
+			if payload.Total < last[payload.UserID] {
+				t.Errorf("user %d out of order on partition %d", payload.UserID, i)
+			}
+			last[payload.UserID] = payload.Total
+		}
+	}
+	if len(seen) != 5 {
+		t.Errorf("%d users enqueued, want 5", len(seen))
+	}
+}
+
+// discardSink accepts every batch without sending it anywhere
+type discardSink struct{}
+
+func (discardSink) Destination() string { return "discard" }
+
+func (discardSink) Send(ctx context.Context, batch *Batch) (int, error) { return 200, nil }
+
+// BenchmarkPartitions measures enqueue-to-send throughput of the whole
+// batching pipeline across partition counts
+func BenchmarkPartitions(b *testing.B) {
+	for _, n := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("partitions=%d", n), func(b *testing.B) {
+			prevSize, prevInterval, prevSinks := batchSize, batchInterval, sinks
+			batchSize, batchInterval, sinks = 100, 60, []Sink{discardSink{}}
+			atomic.StoreInt64(&activeBatchSize, 100)
+			defer func() {
+				batchSize, batchInterval, sinks = prevSize, prevInterval, prevSinks
+				atomic.StoreInt64(&activeBatchSize, int64(prevSize))
+				partitions = nil
+			}()
+
+			partitions = newPartitions(n)
+			for _, p := range partitions {
+				go processLogBatch(p)
+			}
+
+			var users int64
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					enqueue(LogPayload{UserID: atomic.AddInt64(&users, 1), Title: "bench"})
+				}
+			})
+
+			// Count the drain of queued payloads and the final batches
+			for _, p := range partitions {
+				close(p.stop)
+			}
+			for _, p := range partitions {
+				select {
+				case <-p.done:
+				case <-time.After(10 * time.Second):
+					b.Fatal("partition did not drain")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Policies for phone numbers that can't be normalized
+const (
+	phonePolicyReject = "reject"
+	phonePolicyBlank  = "blank"
+)
+
+var (
+	normalizePhones    = envBool("PHONE_NORMALIZE", false)
+	phoneDefaultRegion = strings.ToUpper(envString("PHONE_DEFAULT_REGION", "US"))
+	phoneInvalidPolicy = envString("PHONE_INVALID_POLICY", phonePolicyReject)
+
+	// Country calling codes for the supported default regions
+	regionCallingCodes = map[string]string{
+		"US": "1", "CA": "1", "MX": "52", "BR": "55",
+		"GB": "44", "IE": "353", "FR": "33", "DE": "49", "ES": "34", "IT": "39", "NL": "31",
+		"IN": "91", "SG": "65", "JP": "81", "CN": "86", "AU": "61", "NZ": "64", "ZA": "27",
+	}
+)
+
+// validPhoneInvalidPolicy reports whether policy is a supported PHONE_INVALID_POLICY
+func validPhoneInvalidPolicy(policy string) bool {
+	return policy == phonePolicyReject || policy == phonePolicyBlank
+}
+
+// normalizePhoneNumbers rewrites home and mobile numbers to E.164. Invalid
+// numbers are blanked or reported, depending on policy.
+func normalizePhoneNumbers(numbers *PhoneNumbers, region, policy string) error {
+	callingCode := regionCallingCodes[region]
+
+	for _, field := range []struct {
+		name  string
+		value *string
+	}{
+		{"home", &numbers.Home},
+		{"mobile", &numbers.Mobile},
+	} {
+		normalized, err := toE164(*field.value, callingCode)
+		if err != nil {
+			if policy == phonePolicyBlank {
+				*field.value = ""
+				continue
+			}
+			return fmt.Errorf("meta.phone_numbers.%s: %w", field.name, err)
+		}
+		*field.value = normalized
+	}
+	return nil
+}
+
+// toE164 normalizes a phone number written with spaces, dashes, dots or
+// parentheses to E.164. Numbers without a "+" or "00" international prefix
+// are taken as national numbers in the default region: a leading trunk
+// prefix (0, or 1 for North America) is dropped and callingCode prepended.
+// Empty numbers are left empty.
+func toE164(raw, callingCode string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", nil
+	}
+
+	international := strings.HasPrefix(raw, "+")
+
+	var digits strings.Builder
+	for i, c := range raw {
+		switch {
+		case c >= '0' && c <= '9':
+			digits.WriteRune(c)
+		case c == '+' && i == 0:
+		case c == ' ' || c == '-' || c == '.' || c == '(' || c == ')':
+		default:
+			return "", fmt.Errorf("invalid character %q in phone number", c)
+		}
+	}
+
+	number := digits.String()
+	if !international && strings.HasPrefix(number, "00") {
+		international = true
+		number = number[2:]
+	}
+
+	if !international {
+		if callingCode == "" {
+			return "", fmt.Errorf("phone number %q has no country code", raw)
+		}
+		number = strings.TrimLeft(number, "0")
+		if callingCode == "1" && len(number) == 11 && number[0] == '1' {
+			number = number[1:]
+		}
+		number = callingCode + number
+	}
+
+	// E.164 allows at most 15 digits; shorter than 8 can't be a full number
+	if len(number) < 8 || len(number) > 15 || number[0] == '0' {
+		return "", fmt.Errorf("phone number %q is not a valid E.164 number", raw)
+	}
+	return "+" + number, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestToE164(t *testing.T) {
+	tests := []struct {
+		raw         string
+		callingCode string
+		want        string
+		wantErr     bool
+	}{
+		{"", "1", "", false},
+		{"(415) 555-0100", "1", "+14155550100", false},
+		{"1-415-555-0100", "1", "+14155550100", false},
+		{"+44 20 7946 0958", "1", "+442079460958", false},
+		{"0044 20 7946 0958", "1", "+442079460958", false},
+		{"020 7946 0958", "44", "+442079460958", false},
+		{"415.555.0100", "", "", true},
+		{"415-555-01x0", "1", "", true},
+		{"12345", "1", "", true},
+		{"+1234567890123456", "1", "", true},
+	}
+	for _, tt := range tests {
+		got, err := toE164(tt.raw, tt.callingCode)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("toE164(%q, %q) = %q, %v, want %q, error %v", tt.raw, tt.callingCode, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestNormalizePhoneNumbersPolicy(t *testing.T) {
+	for _, policy := range []string{phonePolicyReject, phonePolicyBlank} {
+		numbers := PhoneNumbers{Home: "(415) 555-0100", Mobile: "not a number"}
+		err := normalizePhoneNumbers(&numbers, "US", policy)
+		if (err != nil) != (policy == phonePolicyReject) {
+			t.Errorf("%s: error %v", policy, err)
+		}
+		if policy == phonePolicyBlank && (numbers.Home != "+14155550100" || numbers.Mobile != "") {
+			t.Errorf("%s: numbers %+v", policy, numbers)
+		}
+	}
+}
+
+func TestPhoneNormalizationInHandler(t *testing.T) {
+	prevNormalize, prevRegion, prevPolicy := normalizePhones, phoneDefaultRegion, phoneInvalidPolicy
+	normalizePhones, phoneDefaultRegion, phoneInvalidPolicy = true, "US", phonePolicyReject
+	defer func() {
+		normalizePhones, phoneDefaultRegion, phoneInvalidPolicy = prevNormalize, prevRegion, prevPolicy
+	}()
+
+	p := captureQueue(t)
+	rec, _ := postLog(t, `{"user_id":1,"meta":{"phone_numbers":{"home":"415 555 0100"}}}`)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status %d, want 202", rec.Code)
+	}
+	if got := queued(p)[0].Meta.PhoneNumbers.Home; got != "+14155550100" {
+		t.Errorf("enqueued home number %q, want +14155550100", got)
+	}
+
+	rec, e := postLog(t, `{"user_id":1,"meta":{"phone_numbers":{"mobile":"call me"}}}`)
+	if rec.Code != http.StatusUnprocessableEntity || e.Error != "invalid_phone_number" {
+		t.Errorf("got %d %q, want 422 invalid_phone_number", rec.Code, e.Error)
+	}
+}
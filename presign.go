@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Refresh pre-signed URLs this long before they expire
+var urlRefreshMargin = envDuration("URL_REFRESH_MARGIN", 30*time.Second)
+
+// presignedURL is the URL issuer's response
+type presignedURL struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// presignedURLs caches an upload URL from an issuer endpoint, fetching a
+// new one when it nears expiry or the downstream rejects it
+type presignedURLs struct {
+	issuer string
+	margin time.Duration
+	client *http.Client
+
+	mu      sync.Mutex
+	url     string
+	expires time.Time
+}
+
+func newPresignedURLs(issuer string, margin time.Duration, client *http.Client) *presignedURLs {
+	return &presignedURLs{issuer: issuer, margin: margin, client: client}
+}
+
+// Get returns the cached URL, refreshing it from the issuer when it is
+// missing or within margin of expiry
+func (p *presignedURLs) Get(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.url != "" && time.Now().Before(p.expires.Add(-p.margin)) {
+		return p.url, nil
+	}
+
+	issued, err := p.fetch(ctx)
+	if err != nil {
+		return "", fmt.Errorf("refresh pre-signed url: %w", err)
+	}
+	p.url, p.expires = issued.URL, issued.ExpiresAt
+	return p.url, nil
+}
+
+// Invalidate drops the cached URL if it is still stale, so the next Get refreshes it
+func (p *presignedURLs) Invalidate(stale string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.url == stale {
+		p.url = ""
+	}
+}
+
+func (p *presignedURLs) fetch(ctx context.Context) (presignedURL, error) {
+	var issued presignedURL
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.issuer, nil)
+	if err != nil {
+		return issued, err
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return issued, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return issued, fmt.Errorf("issuer returned status code %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&issued); err != nil {
+		return issued, err
+	}
+	if issued.URL == "" {
+		return issued, fmt.Errorf("issuer returned no url")
+	}
+	return issued, nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// startIssuer serves pre-signed URLs pointing at base, numbering each
+// issued URL and expiring it after ttl
+func startIssuer(t *testing.T, base string, ttl time.Duration) (*httptest.Server, *int32) {
+	t.Helper()
+	var issued int32
+	issuer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&issued, 1)
+		_ = json.NewEncoder(w).Encode(presignedURL{URL: fmt.Sprintf("%s/upload/%d", base, n), ExpiresAt: time.Now().Add(ttl)})
+	}))
+	t.Cleanup(issuer.Close)
+	return issuer, &issued
+}
+
+func TestPresignedURLsRefresh(t *testing.T) {
+	tests := []struct {
+		name        string
+		ttl         time.Duration
+		invalidate  bool
+		wantFetches int32
+	}{
+		{"cached while fresh", time.Hour, false, 1},
+		{"refreshed within margin", 10 * time.Second, false, 2},
+		{"refreshed after invalidate", time.Hour, true, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issuer, fetches := startIssuer(t, "http://upload", tt.ttl)
+			p := newPresignedURLs(issuer.URL, 30*time.Second, issuer.Client())
+
+			first, err := p.Get(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.invalidate {
+				p.Invalidate(first)
+			}
+			if _, err := p.Get(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if got := atomic.LoadInt32(fetches); got != tt.wantFetches {
+				t.Errorf("fetched %d urls, want %d", got, tt.wantFetches)
+			}
+		})
+	}
+}
+
+func TestPresignedURLsIssuerErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+	}{
+		{"issuer failure", http.StatusInternalServerError, ""},
+		{"no url", http.StatusOK, `{"expires_at":"2030-01-01T00:00:00Z"}`},
+		{"not json", http.StatusOK, "nope"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issuer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer issuer.Close()
+
+			p := newPresignedURLs(issuer.URL, time.Second, issuer.Client())
+			if _, err := p.Get(context.Background()); err == nil {
+				t.Error("got a url from a failing issuer")
+			}
+		})
+	}
+}
+
+func TestHTTPSinkRetriesRejectedPresignedURL(t *testing.T) {
+	var paths []string
+	upload := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		if r.URL.Path == "/upload/1" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upload.Close()
+	issuer, fetches := startIssuer(t, upload.URL, time.Hour)
+
+	s := &httpSink{format: formatJSON, encoding: encodingIdentity, client: upload.Client(),
+		presigned: newPresignedURLs(issuer.URL, time.Second, issuer.Client())}
+	status, err := s.Send(context.Background(), &Batch{Payloads: []LogPayload{{UserID: 1}}})
+	if status != http.StatusOK || err != nil {
+		t.Fatalf("Send = %d, %v, want 200", status, err)
+	}
+	if len(paths) != 2 || paths[1] != "/upload/2" || atomic.LoadInt32(fetches) != 2 {
+		t.Errorf("uploaded to %v after %d fetches, want a refreshed second url", paths, *fetches)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// In-flight bytes and send latency that count as full pressure
+	pressureMaxInflightBytes = envInt("PRESSURE_MAX_INFLIGHT_BYTES", 10<<20)
+	pressureLatencyTarget    = envDuration("PRESSURE_LATENCY_TARGET", 5*time.Second)
+
+	// Request bytes of batches currently being delivered
+	inflightBytes int64
+
+	// Smoothed duration of send attempts
+	sendLatency = &latencyEWMA{alpha: 0.2}
+)
+
+// latencyEWMA is an exponentially weighted moving average of durations
+type latencyEWMA struct {
+	alpha float64
+
+	mu    sync.Mutex
+	value float64
+	set   bool
+}
+
+// Observe folds d into the average
+func (e *latencyEWMA) Observe(d time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.set {
+		e.value, e.set = float64(d), true
+		return
+	}
+	e.value = e.alpha*float64(d) + (1-e.alpha)*e.value
+}
+
+// Value returns the current average
+func (e *latencyEWMA) Value() time.Duration {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return time.Duration(e.value)
+}
+
+// computePressure normalizes each load input against its limit and returns
+// the largest, clamped to [0, 1]:
+//
+//	pressure = min(1, max(queued/capacity, inflight/maxInflight, latency/latencyTarget))
+//
+// Taking the maximum means any single saturated resource reads as full
+// pressure, and the result only grows as any input grows.
+func computePressure(queued, capacity int, inflight, maxInflight int64, latency, latencyTarget time.Duration) float64 {
+	var pressure float64
+	if capacity > 0 {
+		pressure = ratio(float64(queued), float64(capacity), pressure)
+	}
+	if maxInflight > 0 {
+		pressure = ratio(float64(inflight), float64(maxInflight), pressure)
+	}
+	if latencyTarget > 0 {
+		pressure = ratio(float64(latency), float64(latencyTarget), pressure)
+	}
+	if pressure > 1 {
+		pressure = 1
+	}
+	return pressure
+}
+
+// ratio returns n/d when it exceeds current, otherwise current
+func ratio(n, d, current float64) float64 {
+	if r := n / d; r > current {
+		return r
+	}
+	return current
+}
+
+// currentPressure samples the live pipeline for the queue_pressure gauge
+func currentPressure() float64 {
+	var queued, capacity int
+	for _, p := range partitions {
+		queued += len(p.payloads)
+		capacity += cap(p.payloads)
+	}
+
+	return computePressure(queued, capacity,
+		atomic.LoadInt64(&inflightBytes), int64(pressureMaxInflightBytes),
+		sendLatency.Value(), pressureLatencyTarget)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestComputePressure(t *testing.T) {
+	tests := []struct {
+		name     string
+		queued   int
+		inflight int64
+		latency  time.Duration
+		want     float64
+	}{
+		{"idle", 0, 0, 0, 0},
+		{"queue half full", 50, 0, 0, 0.5},
+		{"in-flight dominates", 10, 750, 0, 0.75},
+		{"latency dominates", 10, 100, 900 * time.Millisecond, 0.9},
+		{"clamped", 500, 0, 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := computePressure(tt.queued, 100, tt.inflight, 1000, tt.latency, time.Second)
+			if got != tt.want {
+				t.Errorf("pressure %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestComputePressureIgnoresDisabledLimits(t *testing.T) {
+	if got := computePressure(10, 0, 10, 0, time.Hour, 0); got != 0 {
+		t.Errorf("pressure %v with every limit disabled, want 0", got)
+	}
+}
+
+func TestLatencyEWMA(t *testing.T) {
+	e := &latencyEWMA{alpha: 0.5}
+	e.Observe(100 * time.Millisecond)
+	if got := e.Value(); got != 100*time.Millisecond {
+		t.Fatalf("first observation gave %s, want 100ms", got)
+	}
+	e.Observe(300 * time.Millisecond)
+	if got := e.Value(); got != 200*time.Millisecond {
+		t.Errorf("average %s, want 200ms", got)
+	}
+}
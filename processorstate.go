@@ -0,0 +1,134 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// processorStats are a partition processor's internals, written with
+// atomics by the processor so reading them never blocks it
+type processorStats struct {
+	batchLen  int64
+	lastFlush int64 // unix nanos, 0 before the first flush
+	nextFlush int64 // unix nanos of the next interval tick
+
+	// Flushes whose sends haven't finished, and whether the processor is
+	// itself blocked waiting on sends
+	sending int64
+	blocked int32
+
+	// Enqueue time of the oldest payload held in the batch or coalescer,
+	// and when the processor last looped, unix nanos
+	oldest   int64
+	lastLoop int64
+}
+
+// processorSnapshot is one partition's entry in /admin/processor
+type processorSnapshot struct {
+	Partition      int        `json:"partition"`
+	State          string     `json:"state"`
+	BatchLength    int64      `json:"batch_length"`
+	SendsInFlight  int64      `json:"sends_in_flight"`
+	QueueLength    int        `json:"queue_length"`
+	LastFlush      *time.Time `json:"last_flush,omitempty"`
+	SinceLastFlush string     `json:"since_last_flush,omitempty"`
+	NextFlush      time.Time  `json:"next_flush"`
+}
+
+// storeOldest publishes the enqueue time of the oldest payload the
+// processor holds, along with the time of this loop
+func (p *partition) storeOldest(logBatch []LogPayload) {
+	oldest := oldestPending(logBatch)
+	if p.coalesce != nil {
+		if t := oldestPending(p.coalesce.pending); !t.IsZero() && (oldest.IsZero() || t.Before(oldest)) {
+			oldest = t
+		}
+	}
+
+	var nanos int64
+	if !oldest.IsZero() {
+		nanos = oldest.UnixNano()
+	}
+	atomic.StoreInt64(&p.stats.oldest, nanos)
+	atomic.StoreInt64(&p.stats.lastLoop, time.Now().UnixNano())
+}
+
+// flush dispatches payloads, or holds them for coalescing when enabled
+func (p *partition) flush(wg *sync.WaitGroup, payloads []LogPayload) {
+	if p.coalesce != nil {
+		p.coalesce.Add(payloads)
+		return
+	}
+	p.send(wg, payloads)
+}
+
+// send dispatches payloads, recording the flush in the partition's stats
+// and counting it as in flight until all of its sends have finished
+func (p *partition) send(wg *sync.WaitGroup, payloads []LogPayload) {
+	if batchSummaryLog {
+		logBatchSummary(payloads)
+	}
+
+	atomic.AddInt64(&p.stats.sending, 1)
+	var flushWG sync.WaitGroup
+	dispatch(&flushWG, payloads)
+	atomic.StoreInt64(&p.stats.lastFlush, time.Now().UnixNano())
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		flushWG.Wait()
+		atomic.AddInt64(&p.stats.sending, -1)
+	}()
+}
+
+// waitSends blocks until the partition's sends finish, reporting the
+// processor as blocked meanwhile
+func (p *partition) waitSends(wg *sync.WaitGroup) {
+	atomic.StoreInt32(&p.stats.blocked, 1)
+	wg.Wait()
+	atomic.StoreInt32(&p.stats.blocked, 0)
+}
+
+// snapshot reads the partition's stats
+func (p *partition) snapshot(index int, now time.Time) processorSnapshot {
+	snap := processorSnapshot{
+		Partition:   index,
+		BatchLength: atomic.LoadInt64(&p.stats.batchLen),
+		QueueLength: len(p.payloads),
+		NextFlush:   time.Unix(0, atomic.LoadInt64(&p.stats.nextFlush)).UTC(),
+
+		SendsInFlight: atomic.LoadInt64(&p.stats.sending),
+	}
+
+	switch {
+	case atomic.LoadInt32(&p.stats.blocked) == 1:
+		snap.State = "blocked_sending"
+	case snap.SendsInFlight > 0:
+		snap.State = "flushing"
+	case snap.BatchLength > 0:
+		snap.State = "accumulating"
+	default:
+		snap.State = "idle"
+	}
+
+	if last := atomic.LoadInt64(&p.stats.lastFlush); last != 0 {
+		t := time.Unix(0, last).UTC()
+		snap.LastFlush = &t
+		snap.SinceLastFlush = now.Sub(t).String()
+	}
+	return snap
+}
+
+// Report batch processor internals per partition
+
+func getProcessorHandler(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	snaps := make([]processorSnapshot, len(partitions))
+	for i, p := range partitions {
+		snaps[i] = p.snapshot(i, now)
+	}
+	writeJSON(w, http.StatusOK, snaps)
+}
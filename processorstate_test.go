@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// blockingSink holds every send until release is closed
+type blockingSink struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func newBlockingSink() *blockingSink {
+	return &blockingSink{started: make(chan struct{}, 100), release: make(chan struct{})}
+}
+
+func (s *blockingSink) Destination() string { return "blocking" }
+
+func (s *blockingSink) Send(ctx context.Context, batch *Batch) (int, error) {
+	s.started <- struct{}{}
+	<-s.release
+	return http.StatusOK, nil
+}
+
+func TestProcessorStateTransitions(t *testing.T) {
+	sink := newBlockingSink()
+	p := startPipeline(t, 2, sink)
+	state := func() string { return p.snapshot(0, time.Now()).State }
+
+	if got := state(); got != "idle" {
+		t.Fatalf("initial state = %q, want idle", got)
+	}
+
+	enqueue(LogPayload{UserID: 1})
+	eventually(t, "accumulating", func() bool { return state() == "accumulating" })
+
+	enqueue(LogPayload{UserID: 1})
+	<-sink.started
+	eventually(t, "flushing", func() bool { return state() == "flushing" })
+	if n := p.snapshot(0, time.Now()).SendsInFlight; n != 1 {
+		t.Errorf("sends in flight = %d, want 1", n)
+	}
+
+	close(sink.release)
+	eventually(t, "idle", func() bool { return state() == "idle" })
+	if p.snapshot(0, time.Now()).LastFlush == nil {
+		t.Error("last flush not recorded")
+	}
+}
+
+func TestProcessorStateBlockedOnShutdown(t *testing.T) {
+	sink := newBlockingSink()
+	p := startPipeline(t, 1, sink)
+
+	enqueue(LogPayload{UserID: 1})
+	<-sink.started
+	close(p.stop)
+	eventually(t, "blocked_sending", func() bool { return p.snapshot(0, time.Now()).State == "blocked_sending" })
+
+	close(sink.release)
+	<-p.done
+}
+
+func TestGetProcessorHandler(t *testing.T) {
+	sink := newBlockingSink()
+	defer close(sink.release)
+	startPipeline(t, 5, sink)
+	enqueue(LogPayload{UserID: 1})
+	eventually(t, "batch length", func() bool { return partitions[0].snapshot(0, time.Now()).BatchLength == 1 })
+
+	rec := httptest.NewRecorder()
+	getProcessorHandler(rec, httptest.NewRequest(http.MethodGet, "/admin/processor", nil))
+
+	var snaps []processorSnapshot
+	if err := json.Unmarshal(rec.Body.Bytes(), &snaps); err != nil {
+		t.Fatal(err)
+	}
+	if len(snaps) != 1 || snaps[0].State != "accumulating" || snaps[0].BatchLength != 1 {
+		t.Errorf("snapshots = %+v, want one accumulating partition holding 1 payload", snaps)
+	}
+}
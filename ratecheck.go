@@ -0,0 +1,122 @@
+package main
+
+import (
+	"container/list"
+	"math"
+	"sync"
+	"time"
+)
+
+// Actions for payloads that trip the per-user rate check
+const (
+	rateActionFlag = "flag"
+	rateActionDrop = "drop"
+)
+
+var (
+	// Sliding window for the per-user rate check, 0 disables it
+	rateCheckWindow = envDuration("RATE_CHECK_WINDOW", 0)
+
+	// Thresholds within the window; 0 disables the respective check
+	rateCheckMaxEvents     = envInt("RATE_CHECK_MAX_EVENTS", 0)
+	rateCheckMaxTotalDelta = envFloat("RATE_CHECK_MAX_TOTAL_DELTA", 0)
+
+	rateCheckAction   = envString("RATE_CHECK_ACTION", rateActionFlag)
+	rateCheckMaxUsers = envInt("RATE_CHECK_MAX_USERS", 10000)
+
+	// Per-user rate tracker, nil when RATE_CHECK_WINDOW is unset
+	rateChecks *userRateCheck
+)
+
+// validRateCheckAction reports whether action is a supported RATE_CHECK_ACTION
+func validRateCheckAction(action string) bool {
+	return action == rateActionFlag || action == rateActionDrop
+}
+
+// userRate is a user's event counts for the current and previous window
+// and their last seen total
+type userRate struct {
+	userID      int64
+	windowStart time.Time
+	current     int
+	previous    int
+	lastTotal   float64
+}
+
+// userRateCheck flags users whose event rate or total change exceeds the
+// configured thresholds. Rates use a sliding window approximated from two
+// fixed windows, so each user costs constant memory, and at most maxUsers
+// are tracked with the least recently seen evicted first.
+type userRateCheck struct {
+	window        time.Duration
+	maxEvents     int
+	maxTotalDelta float64
+	maxUsers      int
+
+	mu     sync.Mutex
+	lru    *list.List // of *userRate, most recently seen first
+	byUser map[int64]*list.Element
+}
+
+func newUserRateCheck(window time.Duration, maxEvents int, maxTotalDelta float64, maxUsers int) *userRateCheck {
+	if maxUsers < 1 {
+		maxUsers = 1
+	}
+	return &userRateCheck{
+		window:        window,
+		maxEvents:     maxEvents,
+		maxTotalDelta: maxTotalDelta,
+		maxUsers:      maxUsers,
+		lru:           list.New(),
+		byUser:        make(map[int64]*list.Element),
+	}
+}
+
+// Check records a payload and returns why it exceeds a threshold, or ""
+func (c *userRateCheck) Check(userID int64, total float64, now time.Time) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.byUser[userID]
+	if !ok {
+		if c.lru.Len() >= c.maxUsers {
+			oldest := c.lru.Back()
+			delete(c.byUser, oldest.Value.(*userRate).userID)
+			c.lru.Remove(oldest)
+		}
+		c.byUser[userID] = c.lru.PushFront(&userRate{
+			userID:      userID,
+			windowStart: now,
+			current:     1,
+			lastTotal:   total,
+		})
+		return ""
+	}
+	c.lru.MoveToFront(el)
+	rate := el.Value.(*userRate)
+
+	// Roll fixed windows forward
+	if elapsed := now.Sub(rate.windowStart); elapsed >= 2*c.window {
+		rate.previous, rate.current = 0, 0
+		rate.windowStart = now
+	} else if elapsed >= c.window {
+		rate.previous, rate.current = rate.current, 0
+		rate.windowStart = rate.windowStart.Add(c.window)
+	}
+	rate.current++
+
+	delta := math.Abs(total - rate.lastTotal)
+	rate.lastTotal = total
+
+	// Weight the previous window by how much of it still overlaps the sliding window
+	overlap := 1 - float64(now.Sub(rate.windowStart))/float64(c.window)
+	estimated := float64(rate.current) + float64(rate.previous)*overlap
+
+	switch {
+	case c.maxEvents > 0 && estimated > float64(c.maxEvents):
+		return "event_rate"
+	case c.maxTotalDelta > 0 && delta > c.maxTotalDelta:
+		return "total_jump"
+	}
+	return ""
+}
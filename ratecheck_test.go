@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestUserRateCheck(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	type event struct {
+		after time.Duration
+		total float64
+	}
+	tests := []struct {
+		name       string
+		maxEvents  int
+		maxDelta   float64
+		events     []event
+		wantReason string
+	}{
+		{"under event limit", 3, 0, []event{{0, 1}, {time.Second, 1}, {2 * time.Second, 1}}, ""},
+		{"over event limit", 2, 0, []event{{0, 1}, {time.Second, 1}, {2 * time.Second, 1}}, "event_rate"},
+		{"previous window still overlapping", 2, 0, []event{{0, 1}, {50 * time.Second, 1}, {65 * time.Second, 1}}, "event_rate"},
+		{"previous window aged out", 2, 0, []event{{0, 1}, {time.Second, 1}, {3 * time.Minute, 1}}, ""},
+		{"small total change", 0, 10, []event{{0, 100}, {time.Second, 105}}, ""},
+		{"total jump", 0, 10, []event{{0, 100}, {time.Second, 50}}, "total_jump"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newUserRateCheck(time.Minute, tt.maxEvents, tt.maxDelta, 10)
+			var reason string
+			for _, e := range tt.events {
+				reason = c.Check(1, e.total, start.Add(e.after))
+			}
+			if reason != tt.wantReason {
+				t.Errorf("reason %q, want %q", reason, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestUserRateCheckEvictsLeastRecentlySeen(t *testing.T) {
+	now := time.Now()
+	c := newUserRateCheck(time.Minute, 1, 0, 2)
+	c.Check(1, 0, now)
+	c.Check(2, 0, now)
+	c.Check(1, 0, now)
+	c.Check(3, 0, now)
+
+	if _, ok := c.byUser[2]; ok || len(c.byUser) != 2 {
+		t.Errorf("tracking %d users including user 2, want user 2 evicted", len(c.byUser))
+	}
+	if reason := c.Check(2, 0, now); reason != "" {
+		t.Errorf("evicted user flagged %q on return", reason)
+	}
+}
+
+func TestRateCheckActions(t *testing.T) {
+	tests := []struct {
+		action     string
+		wantQueued int
+	}{
+		{rateActionFlag, 2},
+		{rateActionDrop, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.action, func(t *testing.T) {
+			prevChecks, prevAction := rateChecks, rateCheckAction
+			rateChecks, rateCheckAction = newUserRateCheck(time.Minute, 1, 0, 10), tt.action
+			defer func() { rateChecks, rateCheckAction = prevChecks, prevAction }()
+
+			p := captureQueue(t)
+			for i := 0; i < 2; i++ {
+				if rec, _ := postLog(t, `{"user_id":1}`); rec.Code != http.StatusAccepted {
+					t.Fatalf("status %d, want 202", rec.Code)
+				}
+			}
+			if n := len(queued(p)); n != tt.wantQueued {
+				t.Errorf("enqueued %d payloads, want %d", n, tt.wantQueued)
+			}
+		})
+	}
+}
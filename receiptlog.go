@@ -0,0 +1,82 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// Receipt log lines allowed per second, with bursts of the same size; 0 disables the cap
+	logRateLimit = envFloat("LOG_RATE_LIMIT", 0)
+
+	// How often the count of suppressed receipt logs is reported
+	logRateSummaryInterval = envDuration("LOG_RATE_SUMMARY_INTERVAL", 10*time.Second)
+
+	// Receipt log throttle, nil when LOG_RATE_LIMIT is unset
+	receiptLog *logThrottle
+)
+
+// logThrottle is a token bucket capping how often a log line is written,
+// counting the lines it suppresses for a periodic summary
+type logThrottle struct {
+	rate  float64
+	burst float64
+
+	mu         sync.Mutex
+	tokens     float64
+	last       time.Time
+	suppressed int
+}
+
+func newLogThrottle(rate float64) *logThrottle {
+	burst := rate
+	if burst < 1 {
+		burst = 1
+	}
+	return &logThrottle{rate: rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// Allow reports whether a line may be logged now, counting it as
+// suppressed otherwise. A nil throttle allows every line.
+func (t *logThrottle) Allow(now time.Time) bool {
+	if t == nil {
+		return true
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.tokens += now.Sub(t.last).Seconds() * t.rate
+	if t.tokens > t.burst {
+		t.tokens = t.burst
+	}
+	t.last = now
+
+	if t.tokens < 1 {
+		t.suppressed++
+		return false
+	}
+	t.tokens--
+	return true
+}
+
+// Run logs how many receipt lines were suppressed, once per interval in which any were
+func (t *logThrottle) Run(interval time.Duration) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	for range tick.C {
+		t.mu.Lock()
+		suppressed := t.suppressed
+		t.suppressed = 0
+		t.mu.Unlock()
+
+		if suppressed > 0 {
+			logger.Info("Suppressed receipt logs",
+				zap.Int("count", suppressed),
+				zap.Duration("interval", interval))
+		}
+	}
+}
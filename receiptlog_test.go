@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestLogThrottle(t *testing.T) {
+	tests := []struct {
+		name           string
+		rate           float64
+		gaps           []time.Duration
+		wantAllowed    int
+		wantSuppressed int
+	}{
+		{"burst allowed", 3, []time.Duration{0, 0, 0}, 3, 0},
+		{"over the burst suppressed", 2, []time.Duration{0, 0, 0, 0}, 2, 2},
+		{"bucket refills", 2, []time.Duration{0, 0, 0, time.Second, 0}, 4, 1},
+		{"fractional rate bursts one line", 0.5, []time.Duration{0, 0, time.Second, time.Second}, 2, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			throttle := newLogThrottle(tt.rate)
+			now := throttle.last
+			var allowed int
+			for _, gap := range tt.gaps {
+				now = now.Add(gap)
+				if throttle.Allow(now) {
+					allowed++
+				}
+			}
+			if allowed != tt.wantAllowed || throttle.suppressed != tt.wantSuppressed {
+				t.Errorf("allowed %d, suppressed %d, want %d and %d", allowed, throttle.suppressed, tt.wantAllowed, tt.wantSuppressed)
+			}
+		})
+	}
+}
+
+func TestReceiptLogsThrottled(t *testing.T) {
+	tests := []struct {
+		name     string
+		throttle *logThrottle
+		want     int
+	}{
+		{"unthrottled", nil, 5},
+		{"throttled", newLogThrottle(2), 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prev := receiptLog
+			receiptLog = tt.throttle
+			defer func() { receiptLog = prev }()
+			logs := observeLogs(t)
+			p := captureQueue(t)
+
+			for i := 0; i < 5; i++ {
+				if rec, _ := postLog(t, `{"user_id":1}`); rec.Code != http.StatusAccepted {
+					t.Fatalf("status %d, want 202", rec.Code)
+				}
+			}
+			if n := logs.FilterMessage("Log payload received").Len(); n != tt.want {
+				t.Errorf("logged %d receipts, want %d", n, tt.want)
+			}
+			if n := len(queued(p)); n != 5 {
+				t.Errorf("enqueued %d payloads, want all 5 despite throttled logs", n)
+			}
+		})
+	}
+}
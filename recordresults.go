@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Parse per-record results from 2xx responses and retry only transiently failed records
+var perRecordResults = envBool("PER_RECORD_RESULTS", false)
+
+// Per-record statuses reported by the downstream
+const (
+	recordOK       = "ok"
+	recordRetry    = "retry"
+	recordRejected = "rejected"
+)
+
+// Delivery outcome of a record the downstream rejected
+var errRecordRejected = errors.New("record rejected by downstream")
+
+// recordResults is the downstream's per-record response, with results in
+// batch order, e.g. {"results":[{"status":"ok"},{"status":"retry"}]}.
+// Records without a result are treated as delivered.
+type recordResults struct {
+	Results []struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+	} `json:"results"`
+}
+
+// recordFailure is returned by a send whose batch was only partly
+// accepted, holding batch indexes of retryable and rejected records
+type recordFailure struct {
+	retry    []int
+	rejected []int
+	reasons  map[int]string
+}
+
+func (f *recordFailure) Error() string {
+	return fmt.Sprintf("%d records to retry, %d rejected", len(f.retry), len(f.rejected))
+}
+
+// isRecordFailure reports whether err is a partial per-record failure,
+// which means the downstream itself is healthy
+func isRecordFailure(err error) bool {
+	var failure *recordFailure
+	return errors.As(err, &failure)
+}
+
+// parseRecordResults returns a recordFailure when body reports any record
+// of an n-record batch as not delivered, and nil otherwise. Bodies that
+// don't carry per-record results count as full success.
+func parseRecordResults(body []byte, n int) *recordFailure {
+	var parsed recordResults
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return nil
+	}
+
+	failure := &recordFailure{reasons: make(map[int]string)}
+	for i, result := range parsed.Results {
+		if i >= n {
+			break
+		}
+		switch result.Status {
+		case recordRetry:
+			failure.retry = append(failure.retry, i)
+		case recordRejected:
+			failure.rejected = append(failure.rejected, i)
+			failure.reasons[i] = result.Error
+		}
+	}
+	if len(failure.retry) == 0 && len(failure.rejected) == 0 {
+		return nil
+	}
+	return failure
+}
+
+// subset returns a batch holding only the payloads at indexes, keeping
+// the batch's id and sequence
+func (b *Batch) subset(indexes []int) *Batch {
+	payloads := make([]LogPayload, len(indexes))
+	for i, idx := range indexes {
+		payloads[i] = b.Payloads[idx]
+	}
+	return &Batch{ID: b.ID, Sequence: b.Sequence, Payloads: payloads}
+}
+
+// without returns the batch minus the payloads at indexes, or the batch
+// itself when there are none
+func (b *Batch) without(indexes []int) *Batch {
+	if len(indexes) == 0 {
+		return b
+	}
+	skip := make(map[int]bool, len(indexes))
+	for _, i := range indexes {
+		skip[i] = true
+	}
+	var keep []int
+	for i := range b.Payloads {
+		if !skip[i] {
+			keep = append(keep, i)
+		}
+	}
+	return b.subset(keep)
+}
+
+// dropRejectedRecords dead-letters the records the downstream permanently
+// rejected. PER_RECORD_RESULTS requires DEADLETTER_DIR, so none are lost.
+func dropRejectedRecords(destination string, batch *Batch, failure *recordFailure, started time.Time) {
+	rejected := batch.subset(failure.rejected)
+	logger.Error("Downstream rejected records, dead-lettering",
+		zap.String("destination", destination),
+		zap.String("batch_id", batch.ID),
+		zap.Int("rejected", len(failure.rejected)),
+		zap.Int("batch_size", len(batch.Payloads)))
+
+	for i, payload := range rejected.Payloads {
+		reason := failure.reasons[failure.rejected[i]]
+		deadLetterBatch(destination, []LogPayload{payload}, 0, fmt.Errorf("record rejected: %s", reason))
+	}
+	audit.Record(rejected, destination, auditDeadLettered, started)
+}
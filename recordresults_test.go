@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestParseRecordResults(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		n        int
+		retry    []int
+		rejected []int
+	}{
+		{"not json", `accepted`, 2, nil, nil},
+		{"no results", `{}`, 2, nil, nil},
+		{"all ok", `{"results":[{"status":"ok"},{"status":"ok"}]}`, 2, nil, nil},
+		{"mixed", `{"results":[{"status":"retry"},{"status":"ok"},{"status":"rejected","error":"bad"}]}`, 3, []int{0}, []int{2}},
+		{"more results than records", `{"results":[{"status":"ok"},{"status":"rejected"}]}`, 1, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failure := parseRecordResults([]byte(tt.body), tt.n)
+			if tt.retry == nil && tt.rejected == nil {
+				if failure != nil {
+					t.Fatalf("got %v, want full success", failure)
+				}
+				return
+			}
+			if failure == nil {
+				t.Fatal("got full success, want a record failure")
+			}
+			if !reflect.DeepEqual(failure.retry, tt.retry) || !reflect.DeepEqual(failure.rejected, tt.rejected) {
+				t.Errorf("retry %v rejected %v, want %v %v", failure.retry, failure.rejected, tt.retry, tt.rejected)
+			}
+		})
+	}
+}
+
+func TestRejectedRecordsAreDeadLetteredAndFailed(t *testing.T) {
+	downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"results":[{"status":"ok"},{"status":"rejected","error":"bad title"},{"status":"ok"}]}`))
+	}))
+	defer downstream.Close()
+
+	dir := t.TempDir()
+	pool, err := newDeadLetterPool(dir, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prevResults, prevDeadLetters, prevSinks := perRecordResults, deadLetters, sinks
+	perRecordResults, deadLetters = true, pool
+	sink := &httpSink{url: downstream.URL, format: formatJSON, client: downstream.Client()}
+	sinks = []Sink{sink}
+	defer func() {
+		pool.Close()
+		perRecordResults, deadLetters, sinks = prevResults, prevDeadLetters, prevSinks
+	}()
+
+	batch := &Batch{ID: "b1"}
+	for i := 0; i < 3; i++ {
+		batch.Payloads = append(batch.Payloads, LogPayload{UserID: int64(i + 1), ack: make(chan error, 1)})
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	sendBatch(&wg, batch)
+
+	for i, payload := range batch.Payloads {
+		err := <-payload.ack
+		if want := i == 1; (err != nil) != want {
+			t.Errorf("payload %d acked with %v, want failure %v", i, err, want)
+		}
+	}
+
+	f, err := os.Open(filepath.Join(dir, unsafeFileChars.ReplaceAllString(sink.Destination(), "_")+".ndjson"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var users []int64
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec deadLetterRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatal(err)
+		}
+		for _, payload := range rec.Batch {
+			users = append(users, payload.UserID)
+		}
+	}
+	if !reflect.DeepEqual(users, []int64{2}) {
+		t.Errorf("dead-lettered users %v, want [2]", users)
+	}
+}
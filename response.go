@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"go.uber.org/zap"
+)
+
+// errorResponse is the JSON body returned for rejected requests
+type errorResponse struct {
+	Error   string      `json:"error"`
+	Message string      `json:"message,omitempty"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// writeJSON writes v as a JSON response with the given status
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Error("Failed to write", zap.Error(err))
+	}
+}
+
+// writeJSONError writes an error response with a machine-readable code
+func writeJSONError(w http.ResponseWriter, status int, code, msg string, details interface{}) {
+	writeJSON(w, status, errorResponse{Error: code, Message: msg, Details: details})
+}
+
+// logResponse is the JSON body returned for accepted /log requests
+type logResponse struct {
+	RequestID     string `json:"request_id,omitempty"`
+	DeliveryState string `json:"delivery_state,omitempty"`
+}
+
+// writeAccepted writes the 202 response for an accepted payload, echoing
+// the request id when ECHO_REQUEST_ID is enabled and flagging a degraded
+// pipeline when REPORT_DEGRADED is enabled
+func writeAccepted(w http.ResponseWriter, r *http.Request) {
+	var resp logResponse
+
+	if reportDegraded && isDegraded() {
+		resp.DeliveryState = "degraded"
+		w.Header().Set("X-Delivery-State", resp.DeliveryState)
+	}
+
+	if !echoRequestID {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	resp.RequestID = middleware.GetReqID(r.Context())
+	w.Header().Set(middleware.RequestIDHeader, resp.RequestID)
+	writeJSON(w, http.StatusAccepted, resp)
+}
+
+// methodNotAllowed returns a handler answering 405 with an Allow header
+// listing the methods a route does accept
+func methodNotAllowed(allowed ...string) http.HandlerFunc {
+	allow := strings.Join(allowed, ", ")
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Allow", allow)
+		writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed",
+			r.Method+" is not supported, use "+allow, nil)
+	}
+}
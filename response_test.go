@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+func TestEchoRequestID(t *testing.T) {
+	tests := []struct {
+		name     string
+		echo     bool
+		sentID   string
+		wantEcho bool
+	}{
+		{"disabled", false, "", false},
+		{"generated id", true, "", true},
+		{"client id", true, "client-123", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prev := echoRequestID
+			echoRequestID = tt.echo
+			defer func() { echoRequestID = prev }()
+			captureQueue(t)
+
+			req := httptest.NewRequest(http.MethodPost, "/log", strings.NewReader(`{"user_id":1}`))
+			if tt.sentID != "" {
+				req.Header.Set(middleware.RequestIDHeader, tt.sentID)
+			}
+			rec := httptest.NewRecorder()
+			middleware.RequestID(http.HandlerFunc(handleLog)).ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusAccepted {
+				t.Fatalf("status %d, want 202", rec.Code)
+			}
+			header := rec.Header().Get(middleware.RequestIDHeader)
+			if !tt.wantEcho {
+				if header != "" || rec.Body.Len() != 0 {
+					t.Errorf("echoed %q with body %q while disabled", header, rec.Body.String())
+				}
+				return
+			}
+
+			var resp logResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.RequestID == "" || resp.RequestID != header {
+				t.Errorf("body id %q, header id %q, want the same non-empty id", resp.RequestID, header)
+			}
+			if tt.sentID != "" && resp.RequestID != tt.sentID {
+				t.Errorf("echoed %q, want the client's %q", resp.RequestID, tt.sentID)
+			}
+		})
+	}
+}
+
+func TestLogRejectsOtherMethods(t *testing.T) {
+	captureQueue(t)
+
+	// Registered as in main
+	r := chi.NewRouter()
+	r.HandleFunc("/log", methodNotAllowed(http.MethodPost))
+	r.Post("/log", handleLog)
+
+	tests := []struct {
+		method     string
+		wantStatus int
+	}{
+		{http.MethodGet, http.StatusMethodNotAllowed},
+		{http.MethodPut, http.StatusMethodNotAllowed},
+		{http.MethodDelete, http.StatusMethodNotAllowed},
+		{http.MethodPatch, http.StatusMethodNotAllowed},
+		{http.MethodOptions, http.StatusMethodNotAllowed},
+		{http.MethodPost, http.StatusAccepted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(tt.method, "/log", strings.NewReader(`{"user_id":1}`)))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusMethodNotAllowed {
+				return
+			}
+
+			var e errorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &e); err != nil || e.Error != "method_not_allowed" {
+				t.Errorf("body %s, want a method_not_allowed error", rec.Body)
+			}
+			if allow := rec.Header().Get("Allow"); allow != http.MethodPost {
+				t.Errorf("Allow %q, want POST", allow)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"container/list"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+var (
+	// How long downstream responses are kept per batch, 0 disables retention
+	responseRetention = envDuration("RESPONSE_RETENTION", 0)
+
+	// Bound on retained responses and on each stored body
+	responseRetentionMax = envInt("RESPONSE_RETENTION_MAX", 1000)
+	responseBodyLimit    = envInt("RESPONSE_BODY_LIMIT", 1024)
+
+	// Retained responses, nil when RESPONSE_RETENTION is unset
+	responses *responseStore
+)
+
+// responseRecord is the downstream's response to a batch
+type responseRecord struct {
+	BatchID     string    `json:"batch_id"`
+	Destination string    `json:"destination"`
+	StatusCode  int       `json:"status_code"`
+	Body        string    `json:"body"`
+	Truncated   bool      `json:"truncated,omitempty"`
+	Time        time.Time `json:"time"`
+}
+
+// responseStore keeps the latest response per batch and destination for
+// ttl, holding at most max records and evicting the oldest first
+type responseStore struct {
+	ttl time.Duration
+	max int
+
+	mu      sync.Mutex
+	order   *list.List // of *responseRecord, oldest first
+	byBatch map[string][]*list.Element
+}
+
+func newResponseStore(ttl time.Duration, max int) *responseStore {
+	if max < 1 {
+		max = 1
+	}
+	return &responseStore{
+		ttl:     ttl,
+		max:     max,
+		order:   list.New(),
+		byBatch: make(map[string][]*list.Element),
+	}
+}
+
+// Put stores rec, replacing an earlier response for the same batch and destination
+func (s *responseStore) Put(rec responseRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.evictExpired(rec.Time)
+
+	for _, el := range s.byBatch[rec.BatchID] {
+		if el.Value.(*responseRecord).Destination == rec.Destination {
+			s.remove(el)
+			break
+		}
+	}
+
+	el := s.order.PushBack(&rec)
+	s.byBatch[rec.BatchID] = append(s.byBatch[rec.BatchID], el)
+
+	for s.order.Len() > s.max {
+		s.remove(s.order.Front())
+	}
+}
+
+// Get returns the unexpired responses recorded for batchID
+func (s *responseStore) Get(batchID string, now time.Time) []responseRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.evictExpired(now)
+
+	var recs []responseRecord
+	for _, el := range s.byBatch[batchID] {
+		recs = append(recs, *el.Value.(*responseRecord))
+	}
+	return recs
+}
+
+// evictExpired drops records older than ttl. Callers hold s.mu.
+func (s *responseStore) evictExpired(now time.Time) {
+	for el := s.order.Front(); el != nil; el = s.order.Front() {
+		if now.Sub(el.Value.(*responseRecord).Time) < s.ttl {
+			return
+		}
+		s.remove(el)
+	}
+}
+
+// remove deletes el from both indexes. Callers hold s.mu.
+func (s *responseStore) remove(el *list.Element) {
+	rec := s.order.Remove(el).(*responseRecord)
+
+	els := s.byBatch[rec.BatchID]
+	for i, e := range els {
+		if e == el {
+			els = append(els[:i], els[i+1:]...)
+			break
+		}
+	}
+	if len(els) == 0 {
+		delete(s.byBatch, rec.BatchID)
+	} else {
+		s.byBatch[rec.BatchID] = els
+	}
+}
+
+// Report retained downstream responses for a batch
+
+func getResponsesHandler(w http.ResponseWriter, r *http.Request) {
+	if responses == nil {
+		writeJSONError(w, http.StatusNotFound, "not_enabled", "response retention is disabled", nil)
+		return
+	}
+
+	batchID := chi.URLParam(r, "batchID")
+	recs := responses.Get(batchID, time.Now())
+	if len(recs) == 0 {
+		writeJSONError(w, http.StatusNotFound, "not_found", "no responses retained for batch", nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, recs)
+}
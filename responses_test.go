@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResponseStore(t *testing.T) {
+	now := time.Now()
+	s := newResponseStore(time.Minute, 2)
+	s.Put(responseRecord{BatchID: "a", Destination: "one", StatusCode: 500, Time: now})
+	s.Put(responseRecord{BatchID: "a", Destination: "one", StatusCode: 200, Time: now})
+	s.Put(responseRecord{BatchID: "a", Destination: "two", StatusCode: 202, Time: now})
+
+	recs := s.Get("a", now)
+	if len(recs) != 2 || recs[0].StatusCode != 200 || recs[1].StatusCode != 202 {
+		t.Fatalf("got %+v, want the latest response per destination", recs)
+	}
+
+	// At most max records are kept, oldest evicted first
+	s.Put(responseRecord{BatchID: "b", Destination: "one", StatusCode: 200, Time: now})
+	if recs := s.Get("a", now); len(recs) != 1 || recs[0].Destination != "two" {
+		t.Errorf("after eviction got %+v, want only destination two", recs)
+	}
+
+	if recs := s.Get("b", now.Add(2*time.Minute)); len(recs) != 0 {
+		t.Errorf("expired records returned: %+v", recs)
+	}
+}
+
+func TestResponseRetention(t *testing.T) {
+	prevStore, prevLimit := responses, responseBodyLimit
+	responses, responseBodyLimit = newResponseStore(time.Minute, 10), 8
+	defer func() { responses, responseBodyLimit = prevStore, prevLimit }()
+
+	d := startDownstream(t, http.StatusAccepted, `{"receipt":"0123456789"}`)
+	if _, err := d.sink(formatJSON).Send(context.Background(), &Batch{ID: "b1", Payloads: []LogPayload{{UserID: 1}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := adminRequest(t, http.MethodGet, "/admin/responses/b1", "")
+	var recs []responseRecord
+	if err := json.Unmarshal(rec.Body.Bytes(), &recs); err != nil || len(recs) != 1 {
+		t.Fatalf("got %d %s", rec.Code, rec.Body)
+	}
+	if recs[0].StatusCode != http.StatusAccepted || !recs[0].Truncated || recs[0].Body != `{"receip` {
+		t.Errorf("retained %+v, want the 202 body truncated to 8 bytes", recs[0])
+	}
+
+	if rec := adminRequest(t, http.MethodGet, "/admin/responses/unknown", ""); rec.Code != http.StatusNotFound ||
+		!strings.Contains(rec.Body.String(), "not_found") {
+		t.Errorf("unknown batch answered %d %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+// Only retry sends that never reached the downstream, for non-idempotent downstreams
+var retryOnlyOnConnect = envBool("RETRY_ONLY_ON_CONNECT", false)
+
+// shouldRetry reports whether a send failing with err may be retried. In
+// RETRY_ONLY_ON_CONNECT mode a send is only retried when the connection
+// couldn't be made, since once the batch was sent, even if the response
+// then timed out or the connection reset, the downstream may already have
+// processed it.
+func shouldRetry(err error, onlyOnConnect bool) bool {
+	return !onlyOnConnect || isConnectError(err)
+}
+
+// isConnectError reports whether err is a failure to connect: a dial
+// error, including name resolution, or a refused connection
+func isConnectError(err error) bool {
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	return (errors.As(err, &opErr) && opErr.Op == "dial") ||
+		errors.As(err, &dnsErr) ||
+		errors.Is(err, syscall.ECONNREFUSED)
+}
+
+var (
+	// Batches allowed in their retry/backoff cycle at once, 0 for unlimited
+	maxRetriesInProgress = envInt("MAX_RETRIES_IN_PROGRESS", 0)
+
+	// Semaphore of retry slots, nil when unlimited
+	retrySlots = newRetrySlots(maxRetriesInProgress)
+)
+
+func newRetrySlots(n int) chan struct{} {
+	if n <= 0 {
+		return nil
+	}
+	return make(chan struct{}, n)
+}
+
+// acquireRetrySlot claims a retry slot without blocking, reporting
+// whether one was available
+func acquireRetrySlot() bool {
+	if retrySlots == nil {
+		return true
+	}
+	select {
+	case retrySlots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// releaseRetrySlot frees a slot claimed by acquireRetrySlot
+func releaseRetrySlot() {
+	if retrySlots != nil {
+		<-retrySlots
+	}
+}
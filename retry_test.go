@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestShouldRetry(t *testing.T) {
+	dial := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("no route to host")}
+	read := &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}
+	tests := []struct {
+		name          string
+		err           error
+		onlyOnConnect bool
+		want          bool
+	}{
+		{"any failure", errors.New("downstream returned status code 500"), false, true},
+		{"dial failure", &url.Error{Op: "Post", URL: "http://downstream", Err: dial}, true, true},
+		{"name resolution", &net.DNSError{Err: "no such host", Name: "downstream"}, true, true},
+		{"refused", fmt.Errorf("send: %w", syscall.ECONNREFUSED), true, true},
+		{"reset after send", &url.Error{Op: "Post", URL: "http://downstream", Err: read}, true, false},
+		{"response timeout", &url.Error{Op: "Post", URL: "http://downstream", Err: context.DeadlineExceeded}, true, false},
+		{"error status", errors.New("downstream returned status code 500"), true, false},
+	}
+	for _, tt := range tests {
+		if got := shouldRetry(tt.err, tt.onlyOnConnect); got != tt.want {
+			t.Errorf("%s: shouldRetry(%v, %v) = %v, want %v", tt.name, tt.err, tt.onlyOnConnect, got, tt.want)
+		}
+	}
+}
+
+func TestDeliverRetryOnlyOnConnect(t *testing.T) {
+	useDeadLetters(t)
+	prev := retryOnlyOnConnect
+	retryOnlyOnConnect = true
+	defer func() { retryOnlyOnConnect = prev }()
+
+	d := startDownstream(t, http.StatusInternalServerError, "")
+	if ok, _ := deliver(d.sink(formatJSON), &Batch{Payloads: []LogPayload{{UserID: 1}}}); ok {
+		t.Fatal("delivered despite a 500")
+	}
+	if n := len(d.Requests()); n != 1 {
+		t.Errorf("downstream received %d requests, want 1", n)
+	}
+}
+
+func TestDeliverRetryOnlyOnConnectTimeoutAfterSend(t *testing.T) {
+	useDeadLetters(t)
+	prev := retryOnlyOnConnect
+	retryOnlyOnConnect = true
+	defer func() { retryOnlyOnConnect = prev }()
+
+	// The downstream takes the batch but answers after the client gave up
+	var received int32
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.ReadAll(r.Body)
+		atomic.AddInt32(&received, 1)
+		<-release
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	client := slow.Client()
+	client.Timeout = 50 * time.Millisecond
+	s := &httpSink{url: slow.URL, format: formatJSON, encoding: encodingIdentity, client: client}
+	if ok, _ := deliver(s, &Batch{Payloads: []LogPayload{{UserID: 1}}}); ok {
+		t.Fatal("delivered despite the response timing out")
+	}
+	if n := atomic.LoadInt32(&received); n != 1 {
+		t.Errorf("downstream received %d requests, want 1", n)
+	}
+}
+
+func TestHTTPSinkConnectErrorRetried(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	s := &httpSink{url: "http://" + addr, format: formatJSON, encoding: encodingIdentity, client: http.DefaultClient}
+	_, err = s.Send(context.Background(), &Batch{Payloads: []LogPayload{{UserID: 1}}})
+	if err == nil {
+		t.Fatal("sent to a closed port")
+	}
+	if !shouldRetry(err, true) {
+		t.Errorf("refused connection %v not retried", err)
+	}
+}
+
+func TestRetrySlots(t *testing.T) {
+	prev := retrySlots
+	defer func() { retrySlots = prev }()
+
+	retrySlots = newRetrySlots(0)
+	for i := 0; i < 3; i++ {
+		if !acquireRetrySlot() {
+			t.Fatal("unlimited retry slots ran out")
+		}
+	}
+
+	retrySlots = newRetrySlots(2)
+	if !acquireRetrySlot() || !acquireRetrySlot() {
+		t.Fatal("free retry slot refused")
+	}
+	if acquireRetrySlot() {
+		t.Fatal("claimed a retry slot over the limit")
+	}
+	releaseRetrySlot()
+	if !acquireRetrySlot() {
+		t.Error("released retry slot not reusable")
+	}
+}
+
+func TestDeliverDeadLettersWithoutFreeRetrySlot(t *testing.T) {
+	useDeadLetters(t)
+	prev := retrySlots
+	retrySlots = newRetrySlots(1)
+	retrySlots <- struct{}{}
+	defer func() { retrySlots = prev }()
+
+	d := startDownstream(t, http.StatusServiceUnavailable, "")
+	if ok, _ := deliver(d.sink(formatJSON), &Batch{Payloads: []LogPayload{{UserID: 1}}}); ok {
+		t.Fatal("delivered despite a 503")
+	}
+	if n := len(d.Requests()); n != 1 {
+		t.Errorf("downstream received %d requests, want 1 without a retry slot", n)
+	}
+}
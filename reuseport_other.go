@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !freebsd
+
+package main
+
+import "syscall"
+
+// SO_REUSEPORT is unavailable on this platform
+var reusePortControl func(network, address string, c syscall.RawConn) error
@@ -0,0 +1,24 @@
+//go:build linux || darwin || freebsd
+
+package main
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// reusePortControl sets SO_REUSEPORT on the listening socket. On Linux the
+// kernel load-balances new connections across all processes bound to the
+// port, which must run as the same user. On Darwin and FreeBSD the option
+// only permits the shared bind and connections are not balanced.
+var reusePortControl = func(network, address string, c syscall.RawConn) error {
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// JSON rule set routing payloads to sinks, e.g.
+	// {"rules":[{"when":"$.total > 100","sinks":["big"]}],"default":["main"]};
+	// unset sends every payload to every sink
+	routesConfig = os.Getenv("ROUTES")
+
+	// Parsed ROUTES, nil when unset
+	payloadRouter *router
+)
+
+// routesFile is the ROUTES document
+type routesFile struct {
+	Rules []struct {
+		When  string   `json:"when"`
+		Sinks []string `json:"sinks"`
+	} `json:"rules"`
+	Default []string `json:"default"`
+}
+
+// routeRule sends payloads matching cond to the sinks at the given indexes
+type routeRule struct {
+	expr  string
+	cond  *pathPredicate
+	sinks []int
+}
+
+// router evaluates rules in order, the first match deciding a payload's
+// sinks and the default applying when none match
+type router struct {
+	rules []routeRule
+	def   []int
+}
+
+// routedBatch is the part of a batch bound for one sink
+type routedBatch struct {
+	sink  Sink
+	batch *Batch
+
+	// Index in the routed batch of each of batch's payloads, nil when the
+	// sink gets the whole batch
+	indexes []int
+}
+
+// markRejected adds the routed batch's rejected records to rejected, by
+// their index in the batch that was routed
+func (rb routedBatch) markRejected(rejected map[int]bool, indexes []int) {
+	for _, i := range indexes {
+		if rb.indexes != nil {
+			i = rb.indexes[i]
+		}
+		rejected[i] = true
+	}
+}
+
+// newRouter parses a ROUTES document, resolving sink names against sinks
+func newRouter(config string, sinks []Sink) (*router, error) {
+	var file routesFile
+	if err := json.Unmarshal([]byte(config), &file); err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]int, len(sinks))
+	for i, s := range sinks {
+		byName[s.Destination()] = i
+	}
+	resolve := func(names []string) ([]int, error) {
+		indexes := make([]int, 0, len(names))
+		for _, name := range names {
+			i, ok := byName[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown sink %q", name)
+			}
+			indexes = append(indexes, i)
+		}
+		return indexes, nil
+	}
+
+	rt := &router{}
+	for i, rule := range file.Rules {
+		cond, err := parsePathPredicate(rule.When)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+		if len(rule.Sinks) == 0 {
+			return nil, fmt.Errorf("rule %d: no sinks", i)
+		}
+		indexes, err := resolve(rule.Sinks)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+		rt.rules = append(rt.rules, routeRule{expr: rule.When, cond: cond, sinks: indexes})
+	}
+
+	if len(file.Default) == 0 {
+		return nil, fmt.Errorf("routes require a default")
+	}
+	def, err := resolve(file.Default)
+	if err != nil {
+		return nil, fmt.Errorf("default: %w", err)
+	}
+	rt.def = def
+	return rt, nil
+}
+
+// Route returns the indexes of the sinks payload is bound for. It decodes
+// the payload's JSON to match rules, so callers route each payload once.
+func (rt *router) Route(payload *LogPayload) []int {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return rt.def
+	}
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return rt.def
+	}
+
+	for _, rule := range rt.rules {
+		if rule.cond.Match(doc) {
+			return rule.sinks
+		}
+	}
+	return rt.def
+}
+
+// routeBatch splits batch into the parts bound for each sink, skipping
+// sinks nothing was routed to. Without routes every sink gets the batch.
+func routeBatch(batch *Batch, sinks []Sink) []routedBatch {
+	if payloadRouter == nil {
+		routed := make([]routedBatch, len(sinks))
+		for i, s := range sinks {
+			routed[i] = routedBatch{sink: s, batch: batch}
+		}
+		return routed
+	}
+
+	// Payloads queued without routes are routed here
+	indexes := make([][]int, len(sinks))
+	for i := range batch.Payloads {
+		routes := batch.Payloads[i].routes
+		if routes == nil {
+			routes = payloadRouter.Route(&batch.Payloads[i])
+		}
+		for _, s := range routes {
+			indexes[s] = append(indexes[s], i)
+		}
+	}
+
+	var routed []routedBatch
+	for s, idx := range indexes {
+		switch {
+		case len(idx) == 0:
+		case len(idx) == len(batch.Payloads):
+			routed = append(routed, routedBatch{sink: sinks[s], batch: batch})
+		default:
+			routed = append(routed, routedBatch{sink: sinks[s], batch: batch.subset(idx), indexes: idx})
+		}
+	}
+	return routed
+}
+
+// Predicate syntax: a JSONPath-style path, optionally compared to a JSON literal
+var predicatePattern = regexp.MustCompile(`^\s*(\$[^\s=!<>]*)\s*(?:(==|!=|>=|<=|>|<)\s*(.+?))?\s*$`)
+
+// Path segments: .field or [index]
+var segmentPattern = regexp.MustCompile(`^(?:\.([A-Za-z_][A-Za-z0-9_]*)|\[(\d+)\])`)
+
+// pathPredicate tests the value at a path. Without an operator it matches
+// when the value is present and not empty: non-null, non-zero, non-empty
+// string, array or object, or true.
+type pathPredicate struct {
+	path    []interface{} // string field names and int indexes
+	op      string
+	literal interface{}
+}
+
+// parsePathPredicate parses expressions like "$.meta.phone_numbers.mobile",
+// "$.total > 100" or "$.meta.logins[0].ip == \"10.0.0.1\""
+func parsePathPredicate(expr string) (*pathPredicate, error) {
+	m := predicatePattern.FindStringSubmatch(expr)
+	if m == nil {
+		return nil, fmt.Errorf("invalid expression %q", expr)
+	}
+
+	pred := &pathPredicate{op: m[2]}
+	for rest := m[1][1:]; rest != ""; {
+		seg := segmentPattern.FindStringSubmatch(rest)
+		if seg == nil {
+			return nil, fmt.Errorf("invalid path %q in %q", m[1], expr)
+		}
+		if seg[1] != "" {
+			pred.path = append(pred.path, seg[1])
+		} else {
+			i, _ := strconv.Atoi(seg[2])
+			pred.path = append(pred.path, i)
+		}
+		rest = rest[len(seg[0]):]
+	}
+
+	if pred.op != "" {
+		if err := json.Unmarshal([]byte(m[3]), &pred.literal); err != nil {
+			return nil, fmt.Errorf("invalid literal %q in %q", m[3], expr)
+		}
+	}
+	return pred, nil
+}
+
+// Match evaluates the predicate against a decoded JSON document
+func (p *pathPredicate) Match(doc interface{}) bool {
+	v, ok := p.lookup(doc)
+	if p.op == "" {
+		return ok && truthy(v)
+	}
+	if !ok {
+		return p.op == "!="
+	}
+
+	switch p.op {
+	case "==":
+		return reflect.DeepEqual(v, p.literal)
+	case "!=":
+		return !reflect.DeepEqual(v, p.literal)
+	}
+
+	// Ordering applies to two numbers or two strings
+	if a, ok := v.(float64); ok {
+		if b, ok := p.literal.(float64); ok {
+			return compareOrdered(p.op, a < b, a == b)
+		}
+	}
+	if a, ok := v.(string); ok {
+		if b, ok := p.literal.(string); ok {
+			return compareOrdered(p.op, a < b, a == b)
+		}
+	}
+	return false
+}
+
+func (p *pathPredicate) lookup(doc interface{}) (interface{}, bool) {
+	v := doc
+	for _, seg := range p.path {
+		switch seg := seg.(type) {
+		case string:
+			obj, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			if v, ok = obj[seg]; !ok {
+				return nil, false
+			}
+		case int:
+			arr, ok := v.([]interface{})
+			if !ok || seg >= len(arr) {
+				return nil, false
+			}
+			v = arr[seg]
+		}
+	}
+	return v, true
+}
+
+func compareOrdered(op string, less, equal bool) bool {
+	switch op {
+	case ">":
+		return !less && !equal
+	case ">=":
+		return !less
+	case "<":
+		return less
+	case "<=":
+		return less || equal
+	}
+	return false
+}
+
+// truthy reports whether a JSON value is present and not empty
+func truthy(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return strings.TrimSpace(v) != ""
+	case []interface{}:
+		return len(v) > 0
+	case map[string]interface{}:
+		return len(v) > 0
+	}
+	return true
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// routeSink collects the batches sent to it under a fixed destination
+type routeSink struct {
+	name string
+
+	mu      sync.Mutex
+	batches [][]LogPayload
+}
+
+func (s *routeSink) Destination() string { return s.name }
+
+func (s *routeSink) Send(ctx context.Context, batch *Batch) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches = append(s.batches, batch.Payloads)
+	return 200, nil
+}
+
+func (s *routeSink) users() []int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var users []int64
+	for _, batch := range s.batches {
+		for _, payload := range batch {
+			users = append(users, payload.UserID)
+		}
+	}
+	return users
+}
+
+func TestPathPredicate(t *testing.T) {
+	doc := map[string]interface{}{}
+	_ = json.Unmarshal([]byte(`{"total":150,"title":"b","completed":false,"meta":{"logins":[{"ip":"10.0.0.1"}],"phone_numbers":{}}}`), &doc)
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"$.total > 100", true},
+		{"$.total <= 100", false},
+		{`$.title >= "a"`, true},
+		{`$.meta.logins[0].ip == "10.0.0.1"`, true},
+		{`$.meta.logins[1].ip == "10.0.0.1"`, false},
+		{`$.meta.logins[1].ip != "10.0.0.1"`, true},
+		{"$.meta.logins", true},
+		{"$.meta.phone_numbers", false},
+		{"$.completed", false},
+		{`$.total > "100"`, false},
+	}
+	for _, tt := range tests {
+		pred, err := parsePathPredicate(tt.expr)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.expr, err)
+		}
+		if got := pred.Match(doc); got != tt.want {
+			t.Errorf("%s matched %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+
+	for _, expr := range []string{"total > 100", "$.total >", "$.meta..ip", "$.total == nope"} {
+		if _, err := parsePathPredicate(expr); err == nil {
+			t.Errorf("parsed invalid expression %q", expr)
+		}
+	}
+}
+
+func TestNewRouter(t *testing.T) {
+	sinks := []Sink{&routeSink{name: "main"}, &routeSink{name: "big"}}
+	tests := []struct {
+		name    string
+		config  string
+		wantErr bool
+	}{
+		{"valid", `{"rules":[{"when":"$.total > 100","sinks":["big"]}],"default":["main"]}`, false},
+		{"no default", `{"rules":[{"when":"$.total > 100","sinks":["big"]}]}`, true},
+		{"rule without sinks", `{"rules":[{"when":"$.total > 100","sinks":[]}],"default":["main"]}`, true},
+		{"rule with sinks unset", `{"rules":[{"when":"$.total > 100"}],"default":["main"]}`, true},
+		{"unknown sink", `{"rules":[{"when":"$.total > 100","sinks":["huge"]}],"default":["main"]}`, true},
+		{"bad expression", `{"rules":[{"when":"total","sinks":["big"]}],"default":["main"]}`, true},
+		{"not json", `rules`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newRouter(tt.config, sinks); (err != nil) != tt.wantErr {
+				t.Errorf("error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRoutedDelivery(t *testing.T) {
+	primary, big, archive := &routeSink{name: "main"}, &routeSink{name: "big"}, &routeSink{name: "archive"}
+	rt, err := newRouter(`{"rules":[
+		{"when":"$.total > 100","sinks":["big","archive"]},
+		{"when":"$.completed","sinks":["archive"]}
+	],"default":["main"]}`, []Sink{primary, big, archive})
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := payloadRouter
+	payloadRouter = rt
+	defer func() { payloadRouter = prev }()
+
+	startPipeline(t, 4, primary, big, archive)
+	for _, body := range []string{`{"user_id":1,"total":500}`, `{"user_id":2,"completed":true}`, `{"user_id":3}`, `{"user_id":4,"total":101,"completed":true}`} {
+		postLog(t, body)
+	}
+	eventually(t, "routed sends", func() bool { return len(archive.users()) == 3 })
+
+	want := map[*routeSink][]int64{primary: {3}, big: {1, 4}, archive: {1, 2, 4}}
+	for s, users := range want {
+		if got := s.users(); !reflect.DeepEqual(got, users) {
+			t.Errorf("%s received users %v, want %v", s.name, got, users)
+		}
+	}
+}
+
+func TestRoutesDecidedAtAdmission(t *testing.T) {
+	rt, err := newRouter(`{"rules":[{"when":"$.total > 100","sinks":["big"]}],"default":["main"]}`,
+		[]Sink{&routeSink{name: "main"}, &routeSink{name: "big"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := payloadRouter
+	payloadRouter = rt
+	defer func() { payloadRouter = prev }()
+
+	p := captureQueue(t)
+	postLog(t, `{"user_id":1,"total":500}`)
+	postLog(t, `{"user_id":2,"total":5}`)
+
+	got := queued(p)
+	if len(got) != 2 {
+		t.Fatalf("enqueued %d payloads, want 2", len(got))
+	}
+	if !reflect.DeepEqual(got[0].routes, []int{1}) || !reflect.DeepEqual(got[1].routes, []int{0}) {
+		t.Errorf("routes %v and %v, want [1] and [0]", got[0].routes, got[1].routes)
+	}
+}
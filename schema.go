@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+var (
+	schemaFile = os.Getenv("JSON_SCHEMA_FILE")
+
+	// Compiled once at startup when JSON_SCHEMA_FILE is set
+	payloadSchema *jsonschema.Schema
+)
+
+// schemaViolation describes a single JSON Schema validation failure
+type schemaViolation struct {
+	InstanceLocation string `json:"instance_location"`
+	KeywordLocation  string `json:"keyword_location"`
+	Message          string `json:"message"`
+}
+
+// compileSchema loads and compiles the JSON Schema at path
+func compileSchema(path string) (*jsonschema.Schema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource(path, bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	return compiler.Compile(path)
+}
+
+// validateSchema checks body against schema, returning the violations found.
+// A non-nil error means the body is not valid JSON.
+func validateSchema(schema *jsonschema.Schema, body []byte) ([]schemaViolation, error) {
+	var doc interface{}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	err := schema.Validate(doc)
+	if err == nil {
+		return nil, nil
+	}
+
+	var verr *jsonschema.ValidationError
+	if !errors.As(err, &verr) {
+		return nil, err
+	}
+
+	var violations []schemaViolation
+	for _, unit := range verr.BasicOutput().Errors {
+		// Skip the wrapping units that only say "doesn't validate with ..."
+		if unit.KeywordLocation == "" || unit.Error == "" {
+			continue
+		}
+		violations = append(violations, schemaViolation{
+			InstanceLocation: unit.InstanceLocation,
+			KeywordLocation:  unit.KeywordLocation,
+			Message:          unit.Error,
+		})
+	}
+	if len(violations) == 0 {
+		violations = append(violations, schemaViolation{Message: verr.Error()})
+	}
+	return violations, nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testSchema = `{
+	"type": "object",
+	"required": ["user_id", "title"],
+	"properties": {
+		"user_id": {"type": "integer", "minimum": 1},
+		"title": {"type": "string", "maxLength": 8}
+	}
+}`
+
+func TestSchemaValidation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schema.json")
+	if err := os.WriteFile(path, []byte(testSchema), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	schema, err := compileSchema(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := payloadSchema
+	payloadSchema = schema
+	defer func() { payloadSchema = prev }()
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantCode   string
+		wantAt     string
+	}{
+		{"valid", `{"user_id":1,"title":"ok"}`, http.StatusAccepted, "", ""},
+		{"missing field", `{"user_id":1}`, http.StatusUnprocessableEntity, "schema_violation", ""},
+		{"wrong type", `{"user_id":"1","title":"ok"}`, http.StatusUnprocessableEntity, "schema_violation", "/user_id"},
+		{"too long", `{"user_id":1,"title":"far too long"}`, http.StatusUnprocessableEntity, "schema_violation", "/title"},
+		{"not json", `{"user_id":`, http.StatusBadRequest, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := captureQueue(t)
+			rec, e := postLog(t, tt.body)
+			if rec.Code != tt.wantStatus || e.Error != tt.wantCode {
+				t.Fatalf("got %d %q, want %d %q", rec.Code, e.Error, tt.wantStatus, tt.wantCode)
+			}
+
+			wantQueued := 0
+			if tt.wantStatus == http.StatusAccepted {
+				wantQueued = 1
+			}
+			if n := len(queued(p)); n != wantQueued {
+				t.Errorf("enqueued %d payloads, want %d", n, wantQueued)
+			}
+
+			if tt.wantAt == "" {
+				return
+			}
+			details, _ := e.Details.([]interface{})
+			for _, d := range details {
+				if v, _ := d.(map[string]interface{}); v["instance_location"] == tt.wantAt {
+					return
+				}
+			}
+			t.Errorf("no violation at %s in %v", tt.wantAt, e.Details)
+		})
+	}
+}
+
+func TestCompileSchemaRejectsInvalidSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schema.json")
+	if err := os.WriteFile(path, []byte(`{"type": 12}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := compileSchema(path); err == nil {
+		t.Error("compiled a schema with an invalid type")
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	// Attach an X-Batch-Sequence header to each outgoing batch
+	enableBatchSequence = envBool("BATCH_SEQUENCE", false)
+
+	// File persisting the last assigned sequence across restarts, optional
+	batchSequenceFile = os.Getenv("BATCH_SEQUENCE_FILE")
+
+	// Sequencer, nil when BATCH_SEQUENCE is disabled
+	batchSequence *batchSequencer
+)
+
+// batchSequencer hands out gap-free, monotonically increasing batch
+// sequence numbers, optionally persisting the last one to a counter file
+type batchSequencer struct {
+	path string
+
+	mu   sync.Mutex
+	last uint64
+}
+
+// newBatchSequencer resumes from the counter file at path, if any
+func newBatchSequencer(path string) (*batchSequencer, error) {
+	s := &batchSequencer{path: path}
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if s.last, err = strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Next assigns the next sequence number. The number is returned even
+// when persisting it fails, so delivery isn't held up by the counter file.
+func (s *batchSequencer) Next() (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.last++
+	if s.path == "" {
+		return s.last, nil
+	}
+	return s.last, writeFileAtomic(s.path, []byte(strconv.FormatUint(s.last, 10)+"\n"))
+}
+
+// writeFileAtomic replaces path with data via a synced temp file and rename,
+// so a crash never leaves a partially written file behind
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
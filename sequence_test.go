@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+func TestBatchSequencerResumesFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sequence")
+	s, err := newBatchSequencer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for want := uint64(1); want <= 3; want++ {
+		if got, err := s.Next(); got != want || err != nil {
+			t.Fatalf("Next = %d, %v, want %d", got, err, want)
+		}
+	}
+
+	resumed, err := newBatchSequencer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := resumed.Next(); got != 4 {
+		t.Errorf("resumed sequence at %d, want 4", got)
+	}
+}
+
+func TestBatchSequenceHeader(t *testing.T) {
+	s, err := newBatchSequencer("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := batchSequence
+	batchSequence = s
+	defer func() { batchSequence = prev }()
+
+	d := startDownstream(t, http.StatusOK, "")
+	for i := 0; i < 2; i++ {
+		batch := newBatch([]LogPayload{{UserID: 1}})
+		unsent.Remove(batch)
+		if _, err := d.sink(formatJSON).Send(context.Background(), batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i, req := range d.Requests() {
+		want := []string{"1", "2"}[i]
+		if got := req.header.Get("X-Batch-Sequence"); got != want {
+			t.Errorf("request %d carried sequence %q, want %q", i, got, want)
+		}
+	}
+}
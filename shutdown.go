@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// Time allowed for in-flight requests and queued batches to drain on exit
+	shutdownTimeout = envDuration("SHUTDOWN_TIMEOUT", 30*time.Second)
+
+	// Drain and exit after running this long, so the orchestrator restarts
+	// the process; 0 runs until signalled
+	maxProcessLifetime = envDuration("MAX_PROCESS_LIFETIME", 0)
+)
+
+// Reasons a shutdown was initiated
+const (
+	shutdownSignal   = "signal"
+	shutdownLifetime = "max_process_lifetime"
+)
+
+// waitForShutdown blocks until SIGINT/SIGTERM arrives or the process has
+// run for lifetime, returning the reason
+func waitForShutdown(lifetime time.Duration) string {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	var expired <-chan time.Time
+	if lifetime > 0 {
+		timer := time.NewTimer(lifetime)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case sig := <-signals:
+		logger.Info("Received shutdown signal", zap.String("signal", sig.String()))
+		return shutdownSignal
+	case <-expired:
+		logger.Info("Maximum process lifetime reached", zap.Duration("max_process_lifetime", lifetime))
+		return shutdownLifetime
+	}
+}
+
+// shutdown stops accepting requests, lets in-flight ones finish, then
+// drains every partition's buffered and queued payloads and waits for
+// their sends, so nothing accepted is lost
+func shutdown(server *http.Server, reason string) {
+	logger.Info("Shutting down", zap.String("reason", reason), zap.Duration("shutdown_timeout", shutdownTimeout))
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		logger.Error("Failed to finish in-flight requests", zap.Error(err))
+	}
+
+	// Upload partially filled archive windows, releasing the sends waiting
+	// on them, so partitions can drain
+	for _, s := range objectSinks {
+		s.Flush()
+	}
+
+	// No handlers remain, so buffered payloads can be handed over one last time
+	for _, p := range partitions {
+		if p.ingest != nil {
+			p.ingest.Flush()
+		}
+		close(p.stop)
+	}
+
+	for i, p := range partitions {
+		select {
+		case <-p.done:
+		case <-ctx.Done():
+			logger.Error("Timed out draining partition", zap.Int("partition", i))
+		}
+	}
+
+	// Wait for isolated oversized payloads
+	sent := make(chan struct{})
+	go func() {
+		oversizedSends.Wait()
+		close(sent)
+	}()
+	select {
+	case <-sent:
+	case <-ctx.Done():
+		logger.Error("Timed out sending oversized payloads")
+	}
+
+	// Record whatever the grace period didn't leave time to deliver. Once
+	// drained, a partition's batch and coalesced payloads are all in
+	// batches, so only what is still queued or buffered is left over.
+	if shutdownDropFile != "" {
+		var leftovers []LogPayload
+		for _, p := range partitions {
+			<-p.drained
+			leftovers = append(leftovers, p.leftovers()...)
+		}
+		dropped, inFlight, err := unsent.WriteDrops(shutdownDropFile, time.Now(), leftovers)
+		if err != nil {
+			logger.Error("Failed to write shutdown drops",
+				zap.String("shutdown_drop_file", shutdownDropFile),
+				zap.Error(err))
+		}
+		if dropped > 0 || inFlight > 0 {
+			logger.Warn("Dropped unsent payloads at shutdown",
+				zap.String("shutdown_drop_file", shutdownDropFile),
+				zap.Int("dropped", dropped),
+				zap.Int("in_flight", inFlight))
+		}
+	}
+
+	if audit != nil {
+		if err := audit.Close(); err != nil {
+			logger.Error("Failed to close audit file", zap.Error(err))
+		}
+	}
+
+	if deadLetters != nil {
+		if err := deadLetters.Close(); err != nil {
+			logger.Error("Failed to close dead-letter files", zap.Error(err))
+		}
+	}
+
+	logger.Info("Shutdown complete", zap.String("reason", reason))
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestWaitForShutdownLifetime(t *testing.T) {
+	done := make(chan string, 1)
+	go func() { done <- waitForShutdown(20 * time.Millisecond) }()
+
+	select {
+	case reason := <-done:
+		if reason != shutdownLifetime {
+			t.Errorf("reason %q, want %q", reason, shutdownLifetime)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("lifetime did not end the wait")
+	}
+}
+
+func TestShutdownDrainsQueuedPayloads(t *testing.T) {
+	d := startDownstream(t, http.StatusOK, "")
+	startPipeline(t, 100, d.sink(formatJSON))
+	for i := 0; i < 3; i++ {
+		postLog(t, `{"user_id":1}`)
+	}
+
+	shutdown(&http.Server{}, shutdownLifetime)
+
+	var delivered int
+	for _, req := range d.Requests() {
+		var payloads []LogPayload
+		if err := json.Unmarshal(req.body, &payloads); err != nil {
+			t.Fatal(err)
+		}
+		delivered += len(payloads)
+	}
+	if delivered != 3 {
+		t.Errorf("delivered %d payloads before exiting, want all 3", delivered)
+	}
+}
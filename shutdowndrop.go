@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// File recording batches still unsent when the shutdown grace period ran out,
+// kept apart from dead letters so restart losses can be counted and replayed
+var shutdownDropFile = os.Getenv("SHUTDOWN_DROP_FILE")
+
+// Reason recorded for batches dropped at shutdown
+const shutdownDropReason = "shutdown grace period exceeded before delivery completed"
+
+// States of shutdown-drop records: whether sending had started, so the
+// batch may have reached the downstream, or the payloads were never sent
+const (
+	dropStateInFlight = "in_flight"
+	dropStateDropped  = "dropped"
+)
+
+// Batches created but not yet through sendBatch
+var unsent = &unsentBatches{batches: make(map[*Batch]time.Time)}
+
+// shutdownDropRecord is one line of the shutdown-drop file. An in-flight
+// batch may have reached some or all of its sinks. Payloads that never
+// made it into a batch are recorded without a batch id.
+type shutdownDropRecord struct {
+	Time     time.Time    `json:"time"`
+	Reason   string       `json:"reason"`
+	State    string       `json:"state"`
+	BatchID  string       `json:"batch_id,omitempty"`
+	Sequence uint64       `json:"sequence,omitempty"`
+	Batch    []LogPayload `json:"batch"`
+}
+
+// unsentBatches is the set of batches whose send hasn't finished, with
+// the enqueue time of each batch's oldest payload
+type unsentBatches struct {
+	mu      sync.Mutex
+	batches map[*Batch]time.Time
+}
+
+func (u *unsentBatches) Add(b *Batch) {
+	oldest := oldestPending(b.Payloads)
+	u.mu.Lock()
+	u.batches[b] = oldest
+	u.mu.Unlock()
+}
+
+func (u *unsentBatches) Remove(b *Batch) {
+	u.mu.Lock()
+	delete(u.batches, b)
+	u.mu.Unlock()
+}
+
+// Oldest returns the enqueue time of the oldest unsent payload, or zero
+func (u *unsentBatches) Oldest() time.Time {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	var oldest time.Time
+	for _, t := range u.batches {
+		if !t.IsZero() && (oldest.IsZero() || t.Before(oldest)) {
+			oldest = t
+		}
+	}
+	return oldest
+}
+
+// WriteDrops appends a record per still unsent batch to path, plus one
+// for leftovers, payloads never batched. It returns the number of
+// payloads dropped and of those in batches already being sent.
+func (u *unsentBatches) WriteDrops(path string, now time.Time, leftovers []LogPayload) (dropped, inFlight int, err error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if len(u.batches) == 0 && len(leftovers) == 0 {
+		return 0, 0, nil
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	enc := json.NewEncoder(f)
+	for b := range u.batches {
+		rec := shutdownDropRecord{
+			Time:     now.UTC(),
+			Reason:   shutdownDropReason,
+			State:    dropStateDropped,
+			BatchID:  b.ID,
+			Sequence: b.Sequence,
+			Batch:    b.Payloads,
+		}
+		if atomic.LoadInt32(&b.sending) == 1 {
+			rec.State = dropStateInFlight
+		}
+		if err := enc.Encode(rec); err != nil {
+			f.Close()
+			return dropped, inFlight, err
+		}
+		if rec.State == dropStateInFlight {
+			inFlight += len(b.Payloads)
+		} else {
+			dropped += len(b.Payloads)
+		}
+	}
+
+	if len(leftovers) > 0 {
+		rec := shutdownDropRecord{
+			Time:   now.UTC(),
+			Reason: shutdownDropReason,
+			State:  dropStateDropped,
+			Batch:  leftovers,
+		}
+		if err := enc.Encode(rec); err != nil {
+			f.Close()
+			return dropped, inFlight, err
+		}
+		dropped += len(leftovers)
+	}
+	return dropped, inFlight, f.Close()
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriteDropsRecordsEveryUndeliveredPayload(t *testing.T) {
+	u := &unsentBatches{batches: make(map[*Batch]time.Time)}
+	queued := &Batch{ID: "queued", Payloads: []LogPayload{{UserID: 1}, {UserID: 2}}}
+	sending := &Batch{ID: "sending", Payloads: []LogPayload{{UserID: 3}}, sending: 1}
+	u.Add(queued)
+	u.Add(sending)
+
+	p := newPartitions(1)[0]
+	p.payloads, p.bulk = make(chan LogPayload, 1), make(chan []LogPayload, 2)
+	p.ingest = newIngestBuffer(10, 2, p.bulk)
+	p.ingest.Add(LogPayload{UserID: 4})
+	p.payloads <- LogPayload{UserID: 5}
+	p.bulk <- []LogPayload{{UserID: 6}, {UserID: 7}}
+	leftovers := p.leftovers()
+
+	path := filepath.Join(t.TempDir(), "drops.ndjson")
+	dropped, inFlight, err := u.WriteDrops(path, time.Now(), leftovers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dropped != 6 || inFlight != 1 {
+		t.Errorf("dropped %d, in flight %d, want 6, 1", dropped, inFlight)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	states := make(map[string]string)
+	users := make(map[int64]bool)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec shutdownDropRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatal(err)
+		}
+		states[rec.BatchID] = rec.State
+		for _, payload := range rec.Batch {
+			users[payload.UserID] = true
+		}
+	}
+
+	want := map[string]string{"queued": dropStateDropped, "sending": dropStateInFlight, "": dropStateDropped}
+	for id, state := range want {
+		if states[id] != state {
+			t.Errorf("batch %q recorded as %q, want %q", id, states[id], state)
+		}
+	}
+	for user := int64(1); user <= 7; user++ {
+		if !users[user] {
+			t.Errorf("user %d missing from the drop file", user)
+		}
+	}
+	if len(p.leftovers()) != 0 {
+		t.Error("leftovers not removed from the partition")
+	}
+}
+
+func TestWriteDropsSkipsFileWhenNothingUnsent(t *testing.T) {
+	u := &unsentBatches{batches: make(map[*Batch]time.Time)}
+	path := filepath.Join(t.TempDir(), "drops.ndjson")
+	if _, _, err := u.WriteDrops(path, time.Now(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("drop file created with nothing to record: %v", err)
+	}
+}
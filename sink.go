@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Supported sink types
+const (
+	sinkTypeHTTP  = "http"
+	sinkTypeKafka = "kafka"
+	sinkTypeFile  = "file"
+
+	// Archives time windows of batches to object storage
+	sinkTypeObject = "object"
+
+	// Unary calls to a gRPC collector
+	sinkTypeGRPC = "grpc"
+)
+
+var (
+	sinkType = envString("SINK_TYPE", sinkTypeHTTP)
+
+	// JSON list of sink configs, overriding SINK_TYPE when set
+	sinksConfig = os.Getenv("SINKS")
+
+	// Destinations for every batch, built at startup
+	sinks []Sink
+)
+
+// Sink delivers batches downstream
+type Sink interface {
+	// Send delivers batch, returning the downstream status code (0 when no
+	// response was received, 200 for a non-HTTP sink that succeeded) and a
+	// non-nil error when delivery failed
+	Send(ctx context.Context, batch *Batch) (int, error)
+
+	// Destination names the sink's target, e.g. for dead-letter files
+	Destination() string
+}
+
+// sinkConfig configures one entry of SINKS
+type sinkConfig struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Format string `json:"format"`
+
+	// http
+	URL       string `json:"url"`
+	URLIssuer string `json:"url_issuer"`
+	Encoding  string `json:"encoding"`
+
+	// file
+	Path string `json:"path"`
+
+	// object, reusing url as the store's base URL
+	Auth   string `json:"auth"`
+	Window string `json:"window"`
+
+	// grpc
+	Target string `json:"target"`
+	Method string `json:"method"`
+	TLS    bool   `json:"tls"`
+
+	// kafka
+	Broker string `json:"broker"`
+	Topic  string `json:"topic"`
+}
+
+// namedSink overrides a sink's destination with its configured name
+type namedSink struct {
+	Sink
+	name string
+}
+
+func (s namedSink) Destination() string {
+	return s.name
+}
+
+// newSinks builds the sinks listed in SINKS, or the single sink selected
+// by SINK_TYPE when SINKS is unset
+func newSinks() ([]Sink, error) {
+	if sinksConfig == "" {
+		s, err := newSink(sinkConfig{
+			Type:      sinkType,
+			URL:       postURL,
+			URLIssuer: os.Getenv("URL_ISSUER_ENDPOINT"),
+			Broker:    os.Getenv("KAFKA_BROKER"),
+			Topic:     os.Getenv("KAFKA_TOPIC"),
+			Auth:      os.Getenv("OBJECT_STORE_AUTH"),
+			Window:    os.Getenv("ARCHIVE_WINDOW"),
+			Target:    os.Getenv("GRPC_TARGET"),
+			Method:    os.Getenv("GRPC_METHOD"),
+			TLS:       envBool("GRPC_TLS", false),
+		})
+		if err != nil {
+			return nil, err
+		}
+		return []Sink{s}, nil
+	}
+
+	var configs []sinkConfig
+	if err := json.Unmarshal([]byte(sinksConfig), &configs); err != nil {
+		return nil, fmt.Errorf("parse SINKS: %w", err)
+	}
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("SINKS lists no sinks")
+	}
+
+	built := make([]Sink, 0, len(configs))
+	names := make(map[string]bool)
+	for i, cfg := range configs {
+		s, err := newSink(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("sink %d: %w", i, err)
+		}
+		if cfg.Name != "" {
+			s = namedSink{Sink: s, name: cfg.Name}
+		}
+		if names[s.Destination()] {
+			return nil, fmt.Errorf("sink %d: duplicate destination %q", i, s.Destination())
+		}
+		names[s.Destination()] = true
+		built = append(built, s)
+	}
+	return built, nil
+}
+
+// newSink builds a single sink from its config
+func newSink(cfg sinkConfig) (Sink, error) {
+	switch cfg.Type {
+	case sinkTypeHTTP:
+		format, err := sinkFormat(cfg.Format, formatJSON)
+		if err != nil {
+			return nil, err
+		}
+		encoding, err := sinkEncoding(cfg.Encoding)
+		if err != nil {
+			return nil, err
+		}
+		hs := &httpSink{url: cfg.URL, format: format, encoding: encoding, client: httpClient}
+		if cfg.URLIssuer != "" {
+			hs.presigned = newPresignedURLs(cfg.URLIssuer, urlRefreshMargin, httpClient)
+		} else if cfg.URL == "" {
+			return nil, fmt.Errorf("http sink requires a url or url_issuer")
+		}
+		return hs, nil
+	case sinkTypeFile:
+		format, err := sinkFormat(cfg.Format, formatNDJSON)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.Path == "" {
+			return nil, fmt.Errorf("file sink requires a path")
+		}
+		return &fileSink{path: cfg.Path, format: format}, nil
+	case sinkTypeKafka:
+		if cfg.Broker == "" || cfg.Topic == "" {
+			return nil, fmt.Errorf("kafka sink requires KAFKA_BROKER and KAFKA_TOPIC")
+		}
+		return &kafkaSink{
+			producer: &restProducer{brokerURL: cfg.Broker, client: httpClient},
+			topic:    cfg.Topic,
+		}, nil
+	case sinkTypeObject:
+		format, err := sinkFormat(cfg.Format, formatNDJSON)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("object sink requires a url")
+		}
+		u, err := url.Parse(cfg.URL)
+		if err != nil {
+			return nil, err
+		}
+		window := defaultArchiveWindow
+		if cfg.Window != "" {
+			if window, err = time.ParseDuration(cfg.Window); err != nil || window <= 0 {
+				return nil, fmt.Errorf("invalid archive window %q", cfg.Window)
+			}
+		}
+		archive := &objectSink{
+			store:       &httpObjectStore{baseURL: cfg.URL, auth: cfg.Auth, client: httpClient},
+			destination: "object-" + u.Host + u.Path,
+			format:      format,
+			window:      window,
+		}
+		objectSinks = append(objectSinks, archive)
+		return archive, nil
+	case sinkTypeGRPC:
+		if cfg.Target == "" {
+			return nil, fmt.Errorf("grpc sink requires a target")
+		}
+		return newGRPCSink(cfg.Target, cfg.Method, cfg.TLS)
+	}
+	return nil, fmt.Errorf("unknown sink type %q", cfg.Type)
+}
+
+// httpSink POSTs encoded batches to an HTTP endpoint
+type httpSink struct {
+	url      string
+	format   string
+	encoding string
+	client   *http.Client
+
+	// Source of short-lived upload URLs used instead of url, optional
+	presigned *presignedURLs
+}
+
+func (s *httpSink) Destination() string {
+	target := s.url
+	if s.presigned != nil {
+		target = s.presigned.issuer
+	}
+	if u, err := url.Parse(target); err == nil && u.Host != "" {
+		return u.Host + u.Path
+	}
+	return target
+}
+
+func (s *httpSink) Send(ctx context.Context, batch *Batch) (int, error) {
+	data, err := encodeBatch(batch.Payloads, s.format)
+	if err != nil {
+		return 0, err
+	}
+
+	contentType := formatContentType(s.format)
+
+	// Compress serialized batch with the sink's encoding
+	if data, err = compressBytes(data, s.encoding); err != nil {
+		return 0, err
+	}
+
+	// Encrypt serialized batch, after compression
+	if batchCipher != nil {
+		if data, err = encryptBatch(batchCipher, data); err != nil {
+			return 0, err
+		}
+		contentType = "application/octet-stream"
+	}
+
+	// An encrypted body can't be decoded by proxies honouring
+	// Content-Encoding, so its compression is named in the envelope header
+	header := make(http.Header)
+	header.Set("Content-Type", contentType)
+	encodingHeader := "Content-Encoding"
+	if batchCipher != nil {
+		header.Set("X-Encryption", "aes-gcm")
+		encodingHeader = "X-Encryption-Content-Encoding"
+	}
+	if s.encoding != encodingIdentity {
+		header.Set(encodingHeader, s.encoding)
+	}
+	if batchSequence != nil {
+		header.Set("X-Batch-Sequence", strconv.FormatUint(batch.Sequence, 10))
+	}
+	setChecksumHeader(header, batchChecksum, data)
+
+	target := s.url
+	if s.presigned != nil {
+		if target, err = s.presigned.Get(ctx); err != nil {
+			return 0, err
+		}
+	}
+
+	status, err := s.post(ctx, target, header, data, batch)
+
+	// Pre-signed URL rejected, refresh it and try once more
+	if status == http.StatusForbidden && s.presigned != nil {
+		s.presigned.Invalidate(target)
+		if target, err = s.presigned.Get(ctx); err != nil {
+			return 0, err
+		}
+		status, err = s.post(ctx, target, header, data, batch)
+	}
+	return status, err
+}
+
+// post sends one encoded batch to target
+func (s *httpSink) post(ctx context.Context, target string, header http.Header, data []byte, batch *Batch) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+	req.Header = header.Clone()
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	// Read as much of the body as retention and response checks need
+	var body []byte
+	if responses != nil || expectedResponseBody != nil || perRecordResults {
+		limit := responseBodyLimit + 1
+		if (expectedResponseBody != nil || perRecordResults) && limit < maxInspectedResponseBytes {
+			limit = maxInspectedResponseBytes
+		}
+		body, _ = io.ReadAll(io.LimitReader(resp.Body, int64(limit)))
+	}
+
+	// Retain truncated response body for later proof of delivery
+	if responses != nil {
+		rec := responseRecord{
+			BatchID:     batch.ID,
+			Destination: s.Destination(),
+			StatusCode:  resp.StatusCode,
+			Time:        time.Now(),
+		}
+		rec.Body = string(body)
+		if len(body) > responseBodyLimit {
+			rec.Body, rec.Truncated = string(body[:responseBodyLimit]), true
+		}
+		responses.Put(rec)
+	}
+
+	// Drain body so the connection can be reused
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		return resp.StatusCode, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	// Treat a 2xx with the wrong body as a failed send
+	if expectedResponseBody != nil && !responseMatches(body, expectedResponseBody) {
+		return resp.StatusCode, fmt.Errorf("unexpected response body for status code %d", resp.StatusCode)
+	}
+
+	// Report records the downstream didn't accept
+	if perRecordResults {
+		if failure := parseRecordResults(body, len(batch.Payloads)); failure != nil {
+			return resp.StatusCode, failure
+		}
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Split reason reported on batch_splits_total
+const splitSmoothSend = "smooth_send"
+
+var (
+	// Batches larger than this many payloads are split into sub-batches of
+	// this size, sent SMOOTH_SEND_DELAY apart; 0 disables smoothing
+	smoothSendThreshold = envInt("SMOOTH_SEND_THRESHOLD", 0)
+	smoothSendDelay     = envDuration("SMOOTH_SEND_DELAY", 100*time.Millisecond)
+)
+
+// splitPayloads splits payloads into consecutive chunks of at most size
+func splitPayloads(payloads []LogPayload, size int) [][]LogPayload {
+	var chunks [][]LogPayload
+	for len(payloads) > size {
+		chunks = append(chunks, payloads[:size:size])
+		payloads = payloads[size:]
+	}
+	return append(chunks, payloads)
+}
+
+// sendPaced starts sending one batch every delay, or all at once when delay
+// is 0. Each send runs on its own, so a sub-batch stuck retrying doesn't
+// hold back those after it and the pace is kept between send starts.
+func sendPaced(wg *sync.WaitGroup, batches []*Batch, delay time.Duration) {
+	defer wg.Done()
+
+	var tick <-chan time.Time
+	if delay > 0 {
+		ticker := time.NewTicker(delay)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for i, batch := range batches {
+		if i > 0 && tick != nil {
+			<-tick
+		}
+		wg.Add(1)
+		go sendBatch(wg, batch)
+	}
+}
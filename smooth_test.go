@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingSink records when each batch send started, taking slow to
+// return for the first batch
+type recordingSink struct {
+	slow time.Duration
+
+	mu     sync.Mutex
+	starts []time.Time
+}
+
+func (s *recordingSink) Destination() string { return "recording" }
+
+func (s *recordingSink) Send(ctx context.Context, batch *Batch) (int, error) {
+	s.mu.Lock()
+	s.starts = append(s.starts, time.Now())
+	first := len(s.starts) == 1
+	s.mu.Unlock()
+
+	if first {
+		time.Sleep(s.slow)
+	}
+	return 200, nil
+}
+
+func TestSplitPayloads(t *testing.T) {
+	tests := []struct {
+		n, size int
+		want    []int
+	}{
+		{5, 2, []int{2, 2, 1}},
+		{4, 2, []int{2, 2}},
+		{1, 3, []int{1}},
+	}
+	for _, tt := range tests {
+		chunks := splitPayloads(make([]LogPayload, tt.n), tt.size)
+		var got []int
+		for _, c := range chunks {
+			got = append(got, len(c))
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("splitPayloads(%d, %d) sizes = %v, want %v", tt.n, tt.size, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("splitPayloads(%d, %d) sizes = %v, want %v", tt.n, tt.size, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestSendPacedMeasuresBetweenStarts(t *testing.T) {
+	const delay = 50 * time.Millisecond
+	sink := &recordingSink{slow: 500 * time.Millisecond}
+	sinks = []Sink{sink}
+	defer func() { sinks = nil }()
+
+	batches := []*Batch{
+		newBatch([]LogPayload{{UserID: 1}}),
+		newBatch([]LogPayload{{UserID: 2}}),
+		newBatch([]LogPayload{{UserID: 3}}),
+	}
+
+	var wg sync.WaitGroup
+	start := time.Now()
+	wg.Add(1)
+	go sendPaced(&wg, batches, delay)
+	wg.Wait()
+
+	if len(sink.starts) != len(batches) {
+		t.Fatalf("got %d sends, want %d", len(sink.starts), len(batches))
+	}
+	last := sink.starts[len(sink.starts)-1].Sub(start)
+	if last < 2*delay {
+		t.Errorf("last send started after %s, want at least %s", last, 2*delay)
+	}
+	if last >= sink.slow {
+		t.Errorf("last send started after %s, held back by the slow first send", last)
+	}
+}
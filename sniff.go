@@ -0,0 +1,27 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+)
+
+// Reject bodies whose leading bytes show they aren't JSON, before decoding
+var validateContentSniff = envBool("VALIDATE_CONTENT_SNIFF", false)
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// sniffNonJSON describes why body is clearly not JSON, or returns "" when
+// it may be. Only the leading bytes are inspected; empty bodies are left
+// for the decoder to report.
+func sniffNonJSON(body []byte) string {
+	if bytes.HasPrefix(body, gzipMagic) {
+		return "body is gzip-compressed"
+	}
+
+	trimmed := bytes.TrimLeft(body, " \t\r\n")
+	if len(trimmed) == 0 || trimmed[0] == '{' || trimmed[0] == '[' {
+		return ""
+	}
+	return fmt.Sprintf("body looks like %s, not JSON", http.DetectContentType(body))
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestSniffNonJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		wantJSON bool
+		wantIn   string
+	}{
+		{"object", `{"user_id":1}`, true, ""},
+		{"leading whitespace", " \n\t{}", true, ""},
+		{"array", `[1]`, true, ""},
+		{"empty", ``, true, ""},
+		{"gzip", "\x1f\x8b\x08\x00", false, "gzip"},
+		{"png", "\x89PNG\r\n\x1a\n", false, "image/png"},
+		{"html", "<html><body>hi</body></html>", false, "text/html"},
+		{"form", "user_id=1&title=a", false, "text/plain"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason := sniffNonJSON([]byte(tt.body))
+			if (reason == "") != tt.wantJSON || !strings.Contains(reason, tt.wantIn) {
+				t.Errorf("sniffNonJSON = %q, want JSON %v mentioning %q", reason, tt.wantJSON, tt.wantIn)
+			}
+		})
+	}
+}
+
+func TestContentSniffHandler(t *testing.T) {
+	prev := validateContentSniff
+	validateContentSniff = true
+	defer func() { validateContentSniff = prev }()
+	captureQueue(t)
+
+	rec, e := postLog(t, "<html></html>")
+	if rec.Code != http.StatusUnsupportedMediaType || e.Error != "unsupported_media_type" {
+		t.Errorf("got %d %q, want 415 unsupported_media_type", rec.Code, e.Error)
+	}
+	if rec, _ := postLog(t, `{"user_id":1}`); rec.Code != http.StatusAccepted {
+		t.Errorf("JSON body answered %d, want 202", rec.Code)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"io"
+	"net"
+	"time"
+)
+
+// Abort /log body reads only after this long without receiving any bytes,
+// so slow but progressing uploads survive; 0 disables it
+var stallTimeout = envDuration("STALL_TIMEOUT", 0)
+
+// progressReader pushes the connection's read deadline forward by stall
+// before every read, so only a transfer that stops making progress times
+// out. The deadline never moves past limit, the overall DECODE_TIMEOUT
+// deadline, when set.
+type progressReader struct {
+	io.ReadCloser
+	conn  net.Conn
+	stall time.Duration
+	limit time.Time
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	deadline := time.Now().Add(r.stall)
+	if !r.limit.IsZero() && r.limit.Before(deadline) {
+		deadline = r.limit
+	}
+	if err := r.conn.SetReadDeadline(deadline); err != nil {
+		return 0, err
+	}
+	return r.ReadCloser.Read(p)
+}
+
+// Stalled reports whether a timed out read hit the stall timeout rather
+// than the overall limit
+func (r *progressReader) Stalled(now time.Time) bool {
+	return r.limit.IsZero() || now.Before(r.limit)
+}
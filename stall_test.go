@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestStallTimeout(t *testing.T) {
+	const body = `{"user_id":1}`
+	tests := []struct {
+		name          string
+		decodeTimeout time.Duration
+		chunks        []string
+		gap           time.Duration
+		wantStatus    int
+		wantError     string
+	}{
+		{"slow but progressing", 0, []string{body[:3], body[3:6], body[6:9], body[9:]}, 80 * time.Millisecond, http.StatusAccepted, ""},
+		{"stalled mid-body", 0, []string{body[:5]}, 0, http.StatusRequestTimeout, "body_stalled"},
+		{"progressing past the decode timeout", 250 * time.Millisecond, []string{body[:3], body[3:6], body[6:9], body[9:12]}, 80 * time.Millisecond, http.StatusRequestTimeout, "decode_timeout"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prevStall, prevDecode := stallTimeout, decodeTimeout
+			stallTimeout, decodeTimeout = 200*time.Millisecond, tt.decodeTimeout
+			defer func() { stallTimeout, decodeTimeout = prevStall, prevDecode }()
+			captureQueue(t)
+
+			status, code := trickledPost(t, startLogServer(t), len(body), tt.chunks, tt.gap)
+			if status != tt.wantStatus || code != tt.wantError {
+				t.Errorf("got %d %q, want %d %q", status, code, tt.wantStatus, tt.wantError)
+			}
+		})
+	}
+}
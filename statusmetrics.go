@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Count send attempts by downstream status code on /metrics
+var statusCodeMetrics = envBool("STATUS_CODE_METRICS", false)
+
+// Status codes given their own label value; the rest count as "other"
+var knownStatusCodes = map[int]bool{
+	http.StatusOK:                    true,
+	http.StatusCreated:               true,
+	http.StatusAccepted:              true,
+	http.StatusNoContent:             true,
+	http.StatusMultiStatus:           true,
+	http.StatusBadRequest:            true,
+	http.StatusUnauthorized:          true,
+	http.StatusForbidden:             true,
+	http.StatusNotFound:              true,
+	http.StatusRequestTimeout:        true,
+	http.StatusConflict:              true,
+	http.StatusRequestEntityTooLarge: true,
+	http.StatusUnprocessableEntity:   true,
+	http.StatusTooManyRequests:       true,
+	http.StatusInternalServerError:   true,
+	http.StatusBadGateway:            true,
+	http.StatusServiceUnavailable:    true,
+	http.StatusGatewayTimeout:        true,
+}
+
+var sendStatusCodes = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "send_status_codes_total",
+	Help: "Batch send attempts by downstream status code; \"none\" means no response was received.",
+}, []string{"code"})
+
+// statusCodeLabel buckets status into a bounded set of label values
+func statusCodeLabel(status int) string {
+	switch {
+	case status == 0:
+		return "none"
+	case knownStatusCodes[status]:
+		return strconv.Itoa(status)
+	}
+	return "other"
+}
+
+// observeSendStatus counts one send attempt that ended with status
+func observeSendStatus(status int) {
+	if statusCodeMetrics {
+		sendStatusCodes.WithLabelValues(statusCodeLabel(status)).Inc()
+	}
+}
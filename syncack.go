@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+var (
+	// Hold /log responses until the payload's batch is delivered
+	syncAck        = envBool("SYNC_ACK", false)
+	syncAckTimeout = envDuration("SYNC_ACK_TIMEOUT", 30*time.Second)
+)
+
+// acknowledge reports the batch's delivery outcome to every payload
+// waiting on it and to delivery status tracking. Records a sink rejected
+// were dead-lettered, and fail on their own even when the rest of the
+// batch was delivered. The ack channels are buffered, so clients that
+// already timed out don't block the sender.
+func (b *Batch) acknowledge(delivered, sinks int, rejected map[int]bool) {
+	var err error
+	if delivered < sinks {
+		err = fmt.Errorf("batch delivered to %d of %d sinks", delivered, sinks)
+	}
+
+	// Failed sends are dead-lettered when enabled, fatal otherwise
+	state := deliveryDelivered
+	switch {
+	case err == nil:
+	case deadLetters != nil:
+		state = deliveryDeadLettered
+	default:
+		state = deliveryFailed
+	}
+
+	for i, payload := range b.Payloads {
+		payloadErr, payloadState := err, state
+		if rejected[i] {
+			payloadErr, payloadState = errRecordRejected, deliveryDeadLettered
+		}
+		setDeliveryState(b.Payloads[i:i+1], payloadState)
+		if payload.ack != nil {
+			payload.ack <- payloadErr
+		}
+	}
+}
+
+// awaitDelivery waits up to SYNC_ACK_TIMEOUT for the batches of every
+// payload in the request to be delivered and writes the outcome as the
+// response, failing it when any payload failed
+func awaitDelivery(w http.ResponseWriter, r *http.Request, acks ...chan error) {
+	timer := time.NewTimer(syncAckTimeout)
+	defer timer.Stop()
+
+	for i, ack := range acks {
+		select {
+		case err := <-ack:
+			if err != nil {
+				if len(acks) > 1 {
+					err = fmt.Errorf("object %d: %w", i, err)
+				}
+				writeJSONError(w, http.StatusBadGateway, "delivery_failed", err.Error(), nil)
+				return
+			}
+		case <-timer.C:
+			writeJSONError(w, http.StatusGatewayTimeout, "delivery_timeout",
+				"batch not delivered within "+syncAckTimeout.String(), nil)
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	resp := logResponse{DeliveryState: "delivered"}
+	if echoRequestID {
+		resp.RequestID = middleware.GetReqID(r.Context())
+		w.Header().Set(middleware.RequestIDHeader, resp.RequestID)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSyncAckWaitsForDelivery(t *testing.T) {
+	tests := []struct {
+		name       string
+		downstream int
+		wantStatus int
+		wantError  string
+	}{
+		{"delivered", http.StatusOK, http.StatusOK, ""},
+		{"rejected by the sink", http.StatusBadRequest, http.StatusBadGateway, "delivery_failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prevAck, prevRetry := syncAck, retryOnlyOnConnect
+			syncAck, retryOnlyOnConnect = true, true
+			defer func() { syncAck, retryOnlyOnConnect = prevAck, prevRetry }()
+			useDeadLetters(t)
+
+			d := startDownstream(t, tt.downstream, "")
+			startPipeline(t, 1, d.sink(formatJSON))
+
+			rec, e := postLog(t, `{"user_id":1}`)
+			if rec.Code != tt.wantStatus || e.Error != tt.wantError {
+				t.Fatalf("got %d %q, want %d %q", rec.Code, e.Error, tt.wantStatus, tt.wantError)
+			}
+			if len(d.Requests()) != 1 {
+				t.Errorf("responded before the batch was sent")
+			}
+			if tt.wantError == "" {
+				var resp logResponse
+				if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.DeliveryState != "delivered" {
+					t.Errorf("body %s, want delivered", rec.Body)
+				}
+			}
+		})
+	}
+}
+
+func TestSyncAckTimeout(t *testing.T) {
+	prevAck, prevTimeout := syncAck, syncAckTimeout
+	syncAck, syncAckTimeout = true, 20*time.Millisecond
+	defer func() { syncAck, syncAckTimeout = prevAck, prevTimeout }()
+	captureQueue(t)
+
+	rec, e := postLog(t, `{"user_id":1}`)
+	if rec.Code != http.StatusGatewayTimeout || e.Error != "delivery_timeout" {
+		t.Errorf("got %d %q, want 504 delivery_timeout", rec.Code, e.Error)
+	}
+}
+
+func TestAcknowledge(t *testing.T) {
+	tests := []struct {
+		name      string
+		delivered int
+		rejected  map[int]bool
+		wantErrs  []bool
+	}{
+		{"all delivered", 2, nil, []bool{false, false}},
+		{"one sink failed", 1, nil, []bool{true, true}},
+		{"one record rejected", 2, map[int]bool{1: true}, []bool{false, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			batch := &Batch{Payloads: []LogPayload{{ack: make(chan error, 1)}, {ack: make(chan error, 1)}}}
+			batch.acknowledge(tt.delivered, 2, tt.rejected)
+			for i, payload := range batch.Payloads {
+				if err := <-payload.ack; (err != nil) != tt.wantErrs[i] {
+					t.Errorf("payload %d acked with %v, want error %v", i, err, tt.wantErrs[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Handling of data after the first JSON object in a /log body
+const (
+	trailingDataReject = "reject"
+	trailingDataNDJSON = "ndjson"
+)
+
+// TRAILING_DATA_MODE: reject (400 trailing_data) or ndjson (ingest each object)
+var trailingDataMode = os.Getenv("TRAILING_DATA_MODE")
+
+// validTrailingDataMode reports whether mode is a supported TRAILING_DATA_MODE
+func validTrailingDataMode(mode string) bool {
+	switch mode {
+	case "", trailingDataReject, trailingDataNDJSON:
+		return true
+	}
+	return false
+}
+
+// splitJSONValues splits body into its whitespace-separated JSON values.
+// A body whose first value doesn't parse is returned whole, leaving the
+// error to the payload decoder; one that goes bad later is an error.
+func splitJSONValues(body []byte) ([][]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	var values [][]byte
+	for {
+		var value json.RawMessage
+		err := dec.Decode(&value)
+		if err == io.EOF {
+			return values, nil
+		}
+		if err != nil {
+			if len(values) == 0 {
+				return [][]byte{body}, nil
+			}
+			return nil, fmt.Errorf("invalid JSON after object %d: %v", len(values), err)
+		}
+		values = append(values, value)
+	}
+}
+
+// trailingDataMessage describes a rejected body with trailing data
+func trailingDataMessage(err error) string {
+	if err != nil && trailingDataMode == trailingDataNDJSON {
+		return err.Error()
+	}
+	return "unexpected data after the first JSON object; send one object per request"
+}
+
+// ingestValues ingests each object of an implicit NDJSON body in order.
+// Every object is validated before any is enqueued, so the body is either
+// refused whole, answering with the first invalid object's response, or
+// ingested whole, answering with the last object's response. In sync-ack
+// mode every object is enqueued before waiting on their deliveries together.
+func ingestValues(w http.ResponseWriter, r *http.Request, values [][]byte, decodeStart time.Time) {
+	payloads := make([]LogPayload, len(values))
+	for i, value := range values {
+		rec := &bufferedResponse{header: http.Header{}, status: http.StatusOK}
+		payload, body, ok := decodePayload(rec, r, value, decodeStart)
+		if !ok {
+			rec.writeTo(w)
+			return
+		}
+		payloads[i], values[i] = payload, body
+	}
+
+	var acks []chan error
+	var rec *bufferedResponse
+	for i := range payloads {
+		rec = &bufferedResponse{header: http.Header{}, status: http.StatusOK}
+		if ack := queuePayload(rec, r, payloads[i], values[i]); ack != nil {
+			acks = append(acks, ack)
+		}
+	}
+	if len(acks) > 0 {
+		awaitDelivery(w, r, acks...)
+		return
+	}
+	rec.writeTo(w)
+}
+
+// bufferedResponse holds a response until it's known to be the one to send
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header { return b.header }
+
+func (b *bufferedResponse) Write(p []byte) (int, error) { return b.body.Write(p) }
+
+func (b *bufferedResponse) WriteHeader(status int) { b.status = status }
+
+// writeTo copies the buffered response onto w
+func (b *bufferedResponse) writeTo(w http.ResponseWriter) {
+	for k, v := range b.header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(b.status)
+	if _, err := w.Write(b.body.Bytes()); err != nil {
+		logger.Error("Failed to write", zap.Error(err))
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestTrailingData(t *testing.T) {
+	const (
+		one   = `{"user_id":1,"title":"a"}`
+		two   = `{"user_id":2,"title":"b"}`
+		three = `{"user_id":3,"title":"c"}`
+		bad   = `{"user_id":"not a number"}`
+	)
+	tests := []struct {
+		name       string
+		mode       string
+		body       string
+		wantStatus int
+		wantCode   string
+		wantUsers  []int64
+	}{
+		{"single object", trailingDataNDJSON, one, http.StatusAccepted, "", []int64{1}},
+		{"concatenated rejected", trailingDataReject, one + two, http.StatusBadRequest, "trailing_data", nil},
+		{"concatenated rejected by default", "", one + " " + two, http.StatusBadRequest, "trailing_data", nil},
+		{"concatenated as ndjson", trailingDataNDJSON, one + two, http.StatusAccepted, "", []int64{1, 2}},
+		{"ndjson", trailingDataNDJSON, one + "\n" + two + "\n" + three + "\n", http.StatusAccepted, "", []int64{1, 2, 3}},
+		{"ndjson with an invalid object", trailingDataNDJSON, one + "\n" + bad + "\n" + three, http.StatusBadRequest, "", nil},
+		{"trailing garbage", trailingDataReject, one + " garbage", http.StatusBadRequest, "trailing_data", nil},
+		{"trailing garbage as ndjson", trailingDataNDJSON, one + "\n" + two + "\ngarbage", http.StatusBadRequest, "trailing_data", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prevMode := trailingDataMode
+			trailingDataMode = tt.mode
+			partitions = newPartitions(1)
+			partitions[0].payloads = make(chan LogPayload, 10)
+			defer func() {
+				trailingDataMode = prevMode
+				partitions = nil
+			}()
+
+			rec := httptest.NewRecorder()
+			handleLog(rec, httptest.NewRequest(http.MethodPost, "/log", strings.NewReader(tt.body)))
+
+			var e errorResponse
+			_ = json.Unmarshal(rec.Body.Bytes(), &e)
+			if rec.Code != tt.wantStatus || e.Error != tt.wantCode {
+				t.Errorf("got %d %q, want %d %q", rec.Code, e.Error, tt.wantStatus, tt.wantCode)
+			}
+
+			close(partitions[0].payloads)
+			var users []int64
+			for payload := range partitions[0].payloads {
+				users = append(users, payload.UserID)
+			}
+			if len(users) != len(tt.wantUsers) {
+				t.Fatalf("enqueued users %v, want %v", users, tt.wantUsers)
+			}
+			for i := range users {
+				if users[i] != tt.wantUsers[i] {
+					t.Errorf("enqueued users %v, want %v", users, tt.wantUsers)
+				}
+			}
+		})
+	}
+}
+
+func TestTrailingDataSyncAck(t *testing.T) {
+	const body = `{"user_id":1}` + "\n" + `{"user_id":2}` + "\n" + `{"user_id":3}`
+	tests := []struct {
+		name       string
+		batchSize  int
+		failUser   string // batches holding this user are rejected
+		wantStatus int
+		wantError  string
+		wantSends  int
+	}{
+		{"one batch", 3, "", http.StatusOK, "", 1},
+		{"batch per object", 1, "", http.StatusOK, "", 3},
+		{"first object fails", 1, `"user_id":1,`, http.StatusBadGateway, "delivery_failed", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prevMode, prevAck, prevRetry := trailingDataMode, syncAck, retryOnlyOnConnect
+			trailingDataMode, syncAck, retryOnlyOnConnect = trailingDataNDJSON, true, true
+			// Restored after the pipeline drains, since sends outlive a failed response
+			t.Cleanup(func() { trailingDataMode, syncAck, retryOnlyOnConnect = prevMode, prevAck, prevRetry })
+			useDeadLetters(t)
+
+			var sends int32
+			d := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&sends, 1)
+				data, _ := io.ReadAll(r.Body)
+				if tt.failUser != "" && strings.Contains(string(data), tt.failUser) {
+					w.WriteHeader(http.StatusBadRequest)
+				}
+			}))
+			t.Cleanup(d.Close)
+			startPipeline(t, tt.batchSize, &httpSink{url: d.URL, format: formatJSON, encoding: encodingIdentity, client: d.Client()})
+
+			rec, e := postLog(t, body)
+			if rec.Code != tt.wantStatus || e.Error != tt.wantError {
+				t.Fatalf("got %d %q, want %d %q", rec.Code, e.Error, tt.wantStatus, tt.wantError)
+			}
+			if got := atomic.LoadInt32(&sends); int(got) < tt.wantSends {
+				t.Errorf("responded after %d sends, want %d", got, tt.wantSends)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"container/heap"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+var (
+	// Users tracked for top-talker counts, 0 disables tracking
+	userCountsCapacity = envInt("USER_COUNTS_CAPACITY", 0)
+
+	// Per-user payload counts, nil when USER_COUNTS_CAPACITY is unset
+	userCounts *topUsers
+)
+
+// userCount is an approximate payload count for a user. The true count
+// lies between Count-Error and Count.
+type userCount struct {
+	UserID int64  `json:"user_id"`
+	Count  uint64 `json:"count"`
+	Error  uint64 `json:"error,omitempty"`
+
+	index int
+}
+
+// topUsers counts payloads per user with the Space-Saving algorithm: at
+// most capacity users are tracked, and a new user replaces the one with the
+// lowest count, inheriting that count as its error bound. Heavy hitters are
+// always retained, however many distinct users are seen.
+type topUsers struct {
+	capacity int
+
+	mu     sync.Mutex
+	byUser map[int64]*userCount
+	counts userCountHeap
+}
+
+func newTopUsers(capacity int) *topUsers {
+	return &topUsers{
+		capacity: capacity,
+		byUser:   make(map[int64]*userCount, capacity),
+	}
+}
+
+// Add counts one payload for userID
+func (t *topUsers) Add(userID int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if uc, ok := t.byUser[userID]; ok {
+		uc.Count++
+		heap.Fix(&t.counts, uc.index)
+		return
+	}
+
+	if len(t.counts) < t.capacity {
+		uc := &userCount{UserID: userID, Count: 1}
+		t.byUser[userID] = uc
+		heap.Push(&t.counts, uc)
+		return
+	}
+
+	// Replace the least counted user
+	min := t.counts[0]
+	delete(t.byUser, min.UserID)
+	min.UserID, min.Error = userID, min.Count
+	min.Count++
+	t.byUser[userID] = min
+	heap.Fix(&t.counts, 0)
+}
+
+// Top returns up to n users with the highest counts
+func (t *topUsers) Top(n int) []userCount {
+	t.mu.Lock()
+	top := make([]userCount, 0, len(t.counts))
+	for _, uc := range t.counts {
+		top = append(top, *uc)
+	}
+	t.mu.Unlock()
+
+	sort.Slice(top, func(i, j int) bool { return top[i].Count > top[j].Count })
+	if len(top) > n {
+		top = top[:n]
+	}
+	return top
+}
+
+// userCountHeap is a min-heap of counts
+type userCountHeap []*userCount
+
+func (h userCountHeap) Len() int           { return len(h) }
+func (h userCountHeap) Less(i, j int) bool { return h[i].Count < h[j].Count }
+func (h userCountHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index, h[j].index = i, j
+}
+
+func (h *userCountHeap) Push(x interface{}) {
+	uc := x.(*userCount)
+	uc.index = len(*h)
+	*h = append(*h, uc)
+}
+
+func (h *userCountHeap) Pop() interface{} {
+	old := *h
+	uc := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return uc
+}
+
+// Report the noisiest users
+
+func getTopUsersHandler(w http.ResponseWriter, r *http.Request) {
+	if userCounts == nil {
+		writeJSONError(w, http.StatusNotFound, "not_enabled", "per-user counts are disabled", nil)
+		return
+	}
+
+	limit := 10
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeJSONError(w, http.StatusBadRequest, "invalid_limit", "limit must be a positive integer", nil)
+			return
+		}
+		limit = n
+	}
+	writeJSON(w, http.StatusOK, userCounts.Top(limit))
+}
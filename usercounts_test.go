@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestTopUsersKeepsHeavyHitters(t *testing.T) {
+	top := newTopUsers(3)
+	for i := 0; i < 50; i++ {
+		top.Add(1)
+		if i%2 == 0 {
+			top.Add(2)
+		}
+		// A trickle of one-off users competing for the remaining slot
+		if i%4 == 0 {
+			top.Add(int64(100 + i))
+		}
+	}
+
+	got := top.Top(2)
+	if len(got) != 2 || got[0].UserID != 1 || got[1].UserID != 2 {
+		t.Fatalf("top users %+v, want 1 then 2", got)
+	}
+	if got[0].Count != 50 || got[0].Error != 0 {
+		t.Errorf("user 1 counted %d±%d, want exactly 50", got[0].Count, got[0].Error)
+	}
+	if n := len(top.Top(10)); n != 3 {
+		t.Errorf("tracking %d users, want the capacity of 3", n)
+	}
+}
+
+func TestTopUsersHandler(t *testing.T) {
+	prev := userCounts
+	userCounts = newTopUsers(10)
+	defer func() { userCounts = prev }()
+	captureQueue(t)
+
+	for _, body := range []string{`{"user_id":5}`, `{"user_id":5}`, `{"user_id":6}`} {
+		postLog(t, body)
+	}
+
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantUsers  int
+	}{
+		{"/admin/users/top", http.StatusOK, 2},
+		{"/admin/users/top?limit=1", http.StatusOK, 1},
+		{"/admin/users/top?limit=0", http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		rec := adminRequest(t, http.MethodGet, tt.path, "")
+		if rec.Code != tt.wantStatus {
+			t.Errorf("%s answered %d, want %d", tt.path, rec.Code, tt.wantStatus)
+			continue
+		}
+		if tt.wantStatus != http.StatusOK {
+			continue
+		}
+		var users []userCount
+		if err := json.Unmarshal(rec.Body.Bytes(), &users); err != nil {
+			t.Fatal(err)
+		}
+		if len(users) != tt.wantUsers || users[0].UserID != 5 || users[0].Count != 2 {
+			t.Errorf("%s returned %+v", tt.path, users)
+		}
+	}
+}
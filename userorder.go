@@ -0,0 +1,60 @@
+package main
+
+import "sync"
+
+var (
+	// Keep each user's batches in order while sending disjoint users in parallel
+	orderedPerUser = envBool("ORDERED_PER_USER", false)
+
+	// Dependency tracker, nil when ORDERED_PER_USER is disabled
+	userOrdering *userOrder
+)
+
+// userOrder tracks, per user, the latest batch containing them. A batch
+// may only be sent once every earlier batch sharing one of its users has
+// finished, so a user's events never overtake each other.
+type userOrder struct {
+	mu    sync.Mutex
+	tails map[int64]chan struct{}
+}
+
+func newUserOrder() *userOrder {
+	return &userOrder{tails: make(map[int64]chan struct{})}
+}
+
+// Reserve registers a batch of payloads in creation order. It returns the
+// completion channels of earlier batches to wait for, and a release func
+// to call once the batch is finished.
+func (o *userOrder) Reserve(payloads []LogPayload) ([]chan struct{}, func()) {
+	done := make(chan struct{})
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var waitFor []chan struct{}
+	seen := make(map[int64]bool)
+	for _, payload := range payloads {
+		if seen[payload.UserID] {
+			continue
+		}
+		seen[payload.UserID] = true
+
+		if prev, ok := o.tails[payload.UserID]; ok {
+			waitFor = append(waitFor, prev)
+		}
+		o.tails[payload.UserID] = done
+	}
+
+	release := func() {
+		close(done)
+
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		for userID := range seen {
+			if o.tails[userID] == done {
+				delete(o.tails, userID)
+			}
+		}
+	}
+	return waitFor, release
+}
@@ -0,0 +1,57 @@
+package main
+
+import "testing"
+
+func TestUserOrderReserve(t *testing.T) {
+	tests := []struct {
+		name      string
+		earlier   [][]int64
+		users     []int64
+		wantWaits int
+	}{
+		{"first batch", nil, []int64{1, 2}, 0},
+		{"disjoint users", [][]int64{{1}, {2}}, []int64{3}, 0},
+		{"shared user", [][]int64{{1, 2}}, []int64{2, 2}, 1},
+		{"two earlier batches", [][]int64{{1}, {2}}, []int64{1, 2}, 2},
+		{"only the latest batch per user", [][]int64{{1}, {1}}, []int64{1}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newUserOrder()
+			for _, users := range tt.earlier {
+				o.Reserve(payloadsFor(users))
+			}
+			waitFor, _ := o.Reserve(payloadsFor(tt.users))
+			if len(waitFor) != tt.wantWaits {
+				t.Errorf("waiting on %d batches, want %d", len(waitFor), tt.wantWaits)
+			}
+		})
+	}
+}
+
+func TestUserOrderRelease(t *testing.T) {
+	o := newUserOrder()
+	_, releaseFirst := o.Reserve(payloadsFor([]int64{1}))
+	waitFor, releaseSecond := o.Reserve(payloadsFor([]int64{1}))
+
+	select {
+	case <-waitFor[0]:
+		t.Fatal("second batch released before the first finished")
+	default:
+	}
+	releaseFirst()
+	<-waitFor[0]
+
+	releaseSecond()
+	if waitFor, _ := o.Reserve(payloadsFor([]int64{1})); len(waitFor) != 0 {
+		t.Errorf("waiting on %d finished batches", len(waitFor))
+	}
+}
+
+func payloadsFor(users []int64) []LogPayload {
+	payloads := make([]LogPayload, len(users))
+	for i, userID := range users {
+		payloads[i].UserID = userID
+	}
+	return payloads
+}